@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// name the custom dockerfile is shipped under in remote build contexts
+const remoteDockerfileName = ".lord.Dockerfile"
+
+// buildContextDir returns the build context directory, defaulting to the project root
+func buildContextDir(c *Config) string {
+	if c.Build.Context == "" {
+		return "."
+	}
+	return c.Build.Context
+}
+
+// imageTags returns every tag the built image gets: the local image name, the deploy tag and any extra tags
+func imageTags(c *Config, tag string) []string {
+	tags := []string{c.Name}
+	if tag != c.Name {
+		tags = append(tags, tag)
+	}
+	return append(tags, c.Build.Tags...)
+}
+
+// imageRepository is the repository app images are tagged in, images loaded directly onto the host use a
+// lorddirect/ prefix
+func imageRepository(c *Config) string {
+	if c.Registry == "" {
+		return fmt.Sprintf("lorddirect/%s", c.Name)
+	}
+	return fmt.Sprintf("%s/%s", c.Registry, c.Name)
+}
+
+// deployImageTag returns the image a deploy runs: the prebuilt image, the commit tag of the checkout or latest
+func deployImageTag(c *Config, git *GitState) string {
+	if c.Image != "" {
+		return c.Image
+	}
+	if git != nil {
+		return fmt.Sprintf("%s:%s", imageRepository(c), git.ImageTag())
+	}
+	return fmt.Sprintf("%s:latest", imageRepository(c))
+}
+
+// buildSecretFlag maps a secret from the config onto a buildkit --secret value. secrets are either given as
+// id=path (i.e. npmrc=./.npmrc) or in the full buildkit form (i.e. id=token,env=API_TOKEN).
+func buildSecretFlag(secret string) (string, error) {
+	if strings.HasPrefix(secret, "id=") {
+		return secret, nil
+	}
+
+	parts := strings.SplitN(secret, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("malformed build secret %q, expected id=path", secret)
+	}
+
+	_, err := os.Stat(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("build secret file for %s not found: %v", parts[0], err)
+	}
+
+	return fmt.Sprintf("id=%s,src=%s", parts[0], parts[1]), nil
+}
+
+// commonBuildFlags returns the build flags shared by local and remote builds
+func commonBuildFlags(c *Config, tags []string, buildArgs map[string]string, created time.Time) []string {
+	flags := []string{}
+
+	for _, tag := range tags {
+		flags = append(flags, "-t", tag)
+	}
+
+	// label the image so old releases can be found and pruned on the host
+	flags = append(flags, "--label", fmt.Sprintf("%s=%s", lordAppLabel, c.Name))
+	flags = append(flags, "--label", fmt.Sprintf("%s=%s", ociCreatedLabel, created.UTC().Format(time.RFC3339)))
+	for _, label := range c.Build.Labels {
+		flags = append(flags, "--label", label)
+	}
+
+	keys := []string{}
+	for key := range buildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flags = append(flags, "--build-arg", fmt.Sprintf("%s=%s", key, buildArgs[key]))
+	}
+
+	if c.Target != "" {
+		flags = append(flags, "--target", c.Target)
+	}
+
+	if c.Build.NoCache {
+		flags = append(flags, "--no-cache")
+	}
+
+	return flags
+}
+
+// multiPlatform reports whether the config builds for more than one platform, i.e. linux/amd64,linux/arm64
+func multiPlatform(c *Config) bool {
+	return strings.Contains(c.Platform, ",")
+}
+
+// localBuildCommand maps the build config onto a buildx invocation. single platform images are loaded into the
+// local docker daemon so they can be saved or pushed afterwards. the daemon can't hold a multi-platform image,
+// so those are pushed to the registry by buildx directly, without the local-only name tag.
+func localBuildCommand(c *Config, tag string, buildArgs map[string]string, created time.Time) ([]string, error) {
+	output := "--load"
+	tags := imageTags(c, tag)
+	if multiPlatform(c) {
+		output = "--push"
+		tags = tags[1:]
+	}
+
+	args := []string{"docker", "buildx", "build", "--progress=plain", output, "--platform", c.Platform}
+
+	if c.Build.Builder != "" {
+		args = append(args, "--builder", c.Build.Builder)
+	}
+
+	if c.Build.Dockerfile != "" {
+		args = append(args, "-f", c.Build.Dockerfile)
+	}
+
+	for _, cache := range c.Build.CacheFrom {
+		args = append(args, "--cache-from", cache)
+	}
+	for _, cache := range c.Build.CacheTo {
+		args = append(args, "--cache-to", cache)
+	}
+
+	for _, secret := range c.Build.Secrets {
+		secretFlag, err := buildSecretFlag(secret)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--secret", secretFlag)
+	}
+
+	for _, ssh := range c.Build.Ssh {
+		args = append(args, "--ssh", ssh)
+	}
+
+	args = append(args, commonBuildFlags(c, tags, buildArgs, created)...)
+	args = append(args, buildContextDir(c))
+
+	return args, nil
+}
+
+// remoteBuildCommand builds the docker build command run on the server. no platform is passed so the image
+// is built for the host's native architecture.
+func remoteBuildCommand(c *Config, tag string, buildArgs map[string]string, created time.Time) string {
+	args := []string{"sudo", "docker", "build", "--progress=plain"}
+
+	if c.Build.Dockerfile != "" {
+		args = append(args, "-f", remoteDockerfileName)
+	}
+
+	// registry caches can be read by the default builder on the server
+	for _, cache := range c.Build.CacheFrom {
+		args = append(args, "--cache-from", cache)
+	}
+
+	args = append(args, commonBuildFlags(c, imageTags(c, tag), buildArgs, created)...)
+	args = append(args, ".")
+
+	return shellCommand(args...)
+}
+
+// localOnlyBuildOptions lists the configured build options that need local files or a local agent and are
+// not applied to remote builds
+func localOnlyBuildOptions(c *Config) []string {
+	options := []string{}
+	if len(c.Build.Secrets) > 0 {
+		options = append(options, "secrets")
+	}
+	if len(c.Build.Ssh) > 0 {
+		options = append(options, "ssh")
+	}
+	if len(c.Build.CacheTo) > 0 {
+		options = append(options, "cacheto")
+	}
+	if c.Build.Builder != "" {
+		options = append(options, "builder")
+	}
+	return options
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageTags(t *testing.T) {
+	c := &Config{Name: "myapp", Build: BuildConfig{Tags: []string{"ghcr.io/me/myapp:stable"}}}
+
+	assert.Equal(t, []string{"myapp", "ghcr.io/me/myapp:latest", "ghcr.io/me/myapp:stable"}, imageTags(c, "ghcr.io/me/myapp:latest"))
+	assert.Equal(t, []string{"myapp", "ghcr.io/me/myapp:stable"}, imageTags(c, "myapp"))
+}
+
+func TestBuildSecretFlag(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), ".npmrc")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("token"), 0600))
+
+	flag, err := buildSecretFlag("npmrc=" + secretFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "id=npmrc,src="+secretFile, flag)
+
+	flag, err = buildSecretFlag("id=token,env=API_TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "id=token,env=API_TOKEN", flag)
+
+	_, err = buildSecretFlag("npmrc=/does/not/exist")
+	assert.Error(t, err)
+
+	_, err = buildSecretFlag("npmrc")
+	assert.Error(t, err)
+}
+
+func TestLocalBuildCommand(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	c := &Config{
+		Name:     "myapp",
+		Platform: "linux/amd64",
+		Target:   "production",
+	}
+
+	cmd, err := localBuildCommand(c, "lorddirect/myapp:latest", map[string]string{"B": "2", "A": "1 two"}, created)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker", "buildx", "build", "--progress=plain", "--load", "--platform", "linux/amd64", "-t", "myapp", "-t", "lorddirect/myapp:latest", "--label", "lord.app=myapp", "--label", "org.opencontainers.image.created=2024-05-01T10:30:00Z", "--build-arg", "A=1 two", "--build-arg", "B=2", "--target", "production", "."}, cmd)
+
+	c.Build = BuildConfig{
+		Dockerfile: "docker/Dockerfile",
+		Context:    "app",
+		CacheFrom:  []string{"type=local,src=.buildcache"},
+		CacheTo:    []string{"type=local,dest=.buildcache"},
+		Secrets:    []string{"id=token,env=API_TOKEN"},
+		Ssh:        []string{"default"},
+		Tags:       []string{"myapp:stable"},
+		Labels:     []string{"team=web"},
+		NoCache:    true,
+		Builder:    "lordbuilder",
+	}
+	c.Target = ""
+
+	cmd, err = localBuildCommand(c, "lorddirect/myapp:latest", map[string]string{}, created)
+	assert.NoError(t, err)
+	assert.Equal(t, "docker buildx build --progress=plain --load --platform linux/amd64 --builder lordbuilder -f docker/Dockerfile --cache-from type=local,src=.buildcache --cache-to type=local,dest=.buildcache --secret id=token,env=API_TOKEN --ssh default -t myapp -t lorddirect/myapp:latest -t myapp:stable --label lord.app=myapp --label org.opencontainers.image.created=2024-05-01T10:30:00Z --label team=web --no-cache app", strings.Join(cmd, " "))
+}
+
+func TestLocalBuildCommandMultiPlatform(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	c := &Config{
+		Name:     "myapp",
+		Platform: "linux/amd64,linux/arm64",
+		Registry: "registry.example.com",
+		Build:    BuildConfig{Tags: []string{"registry.example.com/myapp:stable"}},
+	}
+
+	cmd, err := localBuildCommand(c, "registry.example.com/myapp:latest", map[string]string{}, created)
+	assert.NoError(t, err)
+	assert.Equal(t, "docker buildx build --progress=plain --push --platform linux/amd64,linux/arm64 -t registry.example.com/myapp:latest -t registry.example.com/myapp:stable --label lord.app=myapp --label org.opencontainers.image.created=2024-05-01T10:30:00Z .", strings.Join(cmd, " "))
+}
+
+func TestRemoteBuildCommand(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	c := &Config{Name: "myapp", Target: "production"}
+
+	cmd := remoteBuildCommand(c, "lorddirect/myapp:latest", map[string]string{"B": "2", "A": "1"}, created)
+	assert.Equal(t, "sudo docker build --progress=plain -t myapp -t lorddirect/myapp:latest --label lord.app=myapp --label org.opencontainers.image.created=2024-05-01T10:30:00Z --build-arg A=1 --build-arg B=2 --target production .", cmd)
+
+	c.Build = BuildConfig{Dockerfile: "docker/Dockerfile", Secrets: []string{"npmrc=.npmrc"}, CacheTo: []string{"type=inline"}}
+	cmd = remoteBuildCommand(c, "lorddirect/myapp:latest", map[string]string{}, created)
+	assert.Equal(t, "sudo docker build --progress=plain -f .lord.Dockerfile -t myapp -t lorddirect/myapp:latest --label lord.app=myapp --label org.opencontainers.image.created=2024-05-01T10:30:00Z --target production .", cmd)
+
+	assert.Equal(t, []string{"secrets", "cacheto"}, localOnlyBuildOptions(c))
+
+	// build args are passed verbatim to the remote shell only after quoting
+	cmd = remoteBuildCommand(&Config{Name: "myapp"}, "myapp:latest", map[string]string{"MESSAGE": "hello $(whoami); it's"}, created)
+	assert.Equal(t, `sudo docker build --progress=plain -t myapp -t myapp:latest --label lord.app=myapp --label org.opencontainers.image.created=2024-05-01T10:30:00Z --build-arg 'MESSAGE=hello $(whoami); it'\''s' .`, cmd)
+}
+
+func TestDeployImageTag(t *testing.T) {
+	c := &Config{Name: "myapp"}
+	assert.Equal(t, "lorddirect/myapp:latest", deployImageTag(c, nil))
+
+	c.Registry = "registry.example.com"
+	assert.Equal(t, "registry.example.com/myapp:0123456789ab", deployImageTag(c, &GitState{Commit: "0123456789abcdef"}))
+
+	c.Image = "grafana/grafana:11.0.0"
+	assert.Equal(t, "grafana/grafana:11.0.0", deployImageTag(c, &GitState{Commit: "0123456789abcdef"}))
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// certificates expiring within this window are flagged in the report
+const certExpiryWarningWindow = 21 * 24 * time.Hour
+
+const acmeStoragePath = "/etc/traefik/acme.json"
+
+// AcmeStore mirrors the layout of the traefik acme.json file, keyed by resolver name
+type AcmeStore map[string]*AcmeResolverStore
+
+type AcmeResolverStore struct {
+	Account      json.RawMessage    `json:"Account"`
+	Certificates []*AcmeCertificate `json:"Certificates"`
+}
+
+type AcmeCertificate struct {
+	Domain      AcmeDomain `json:"domain"`
+	Certificate string     `json:"certificate"`
+	Key         string     `json:"key"`
+	Store       string     `json:"Store"`
+}
+
+type AcmeDomain struct {
+	Main string   `json:"main"`
+	SANs []string `json:"sans,omitempty"`
+}
+
+type CertificateInfo struct {
+	Domain   string
+	Issuer   string
+	NotAfter time.Time
+	App      string
+	Missing  bool
+}
+
+func parseAcmeStore(content []byte) (AcmeStore, error) {
+	store := AcmeStore{}
+
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return store, nil
+	}
+
+	err := json.Unmarshal(content, &store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse acme storage: %v", err)
+	}
+
+	return store, nil
+}
+
+// parseAcmeCertificate decodes the base64 pem bundle traefik stores and returns the leaf certificate
+func parseAcmeCertificate(encoded string) (*x509.Certificate, error) {
+	pemBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode certificate: %v", err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found in certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+var hostRuleRegex = regexp.MustCompile("Host\\(([^)]*)\\)")
+var backtickValueRegex = regexp.MustCompile("`([^`]+)`")
+
+// extractHostsFromRule returns every hostname referenced by Host() matchers in a traefik router rule
+func extractHostsFromRule(rule string) []string {
+	hosts := []string{}
+
+	for _, match := range hostRuleRegex.FindAllStringSubmatch(rule, -1) {
+		for _, value := range backtickValueRegex.FindAllStringSubmatch(match[1], -1) {
+			hosts = append(hosts, value[1])
+		}
+	}
+
+	return hosts
+}
+
+// mapHostsToApps parses `docker inspect` output lines of the form "/<name> <labels json>" into a hostname -> app map
+func mapHostsToApps(inspectOutput string) map[string]string {
+	hostApps := map[string]string{}
+
+	for _, line := range strings.Split(strings.TrimSpace(inspectOutput), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		app := strings.TrimPrefix(parts[0], "/")
+
+		var labels map[string]string
+		err := json.Unmarshal([]byte(parts[1]), &labels)
+		if err != nil {
+			continue
+		}
+
+		for key, value := range labels {
+			if strings.HasPrefix(key, "traefik.http.routers.") && strings.HasSuffix(key, ".rule") {
+				for _, host := range extractHostsFromRule(value) {
+					hostApps[host] = app
+				}
+			}
+		}
+	}
+
+	return hostApps
+}
+
+// buildCertificateReport merges the stored certificates with the hostnames routed by running containers
+func buildCertificateReport(store AcmeStore, hostApps map[string]string) []CertificateInfo {
+	report := []CertificateInfo{}
+	covered := map[string]bool{}
+
+	for _, resolver := range store {
+		if resolver == nil {
+			continue
+		}
+
+		for _, cert := range resolver.Certificates {
+			domains := append([]string{cert.Domain.Main}, cert.Domain.SANs...)
+
+			info := CertificateInfo{Issuer: "unknown"}
+			parsed, err := parseAcmeCertificate(cert.Certificate)
+			if err == nil {
+				info.Issuer = parsed.Issuer.CommonName
+				if info.Issuer == "" && len(parsed.Issuer.Organization) > 0 {
+					info.Issuer = parsed.Issuer.Organization[0]
+				}
+				info.NotAfter = parsed.NotAfter
+			}
+
+			for _, domain := range domains {
+				if domain == "" || covered[domain] {
+					continue
+				}
+				covered[domain] = true
+
+				entry := info
+				entry.Domain = domain
+				entry.App = hostApps[domain]
+				report = append(report, entry)
+			}
+		}
+	}
+
+	for host, app := range hostApps {
+		if !covered[host] {
+			report = append(report, CertificateInfo{Domain: host, App: app, Missing: true})
+		}
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Domain < report[j].Domain
+	})
+
+	return report
+}
+
+func (ci *CertificateInfo) status(now time.Time) string {
+	if ci.Missing {
+		return "MISSING"
+	}
+	if ci.NotAfter.IsZero() {
+		return "UNREADABLE"
+	}
+	if now.After(ci.NotAfter) {
+		return "EXPIRED"
+	}
+	if ci.NotAfter.Sub(now) < certExpiryWarningWindow {
+		return "EXPIRING"
+	}
+	return "ok"
+}
+
+// removeAcmeCertificates drops every stored certificate covering the domain, returning how many were removed
+func removeAcmeCertificates(store AcmeStore, domain string) int {
+	removed := 0
+
+	for _, resolver := range store {
+		if resolver == nil {
+			continue
+		}
+
+		kept := []*AcmeCertificate{}
+		for _, cert := range resolver.Certificates {
+			matches := cert.Domain.Main == domain
+			for _, san := range cert.Domain.SANs {
+				if san == domain {
+					matches = true
+				}
+			}
+
+			if matches {
+				removed++
+				continue
+			}
+			kept = append(kept, cert)
+		}
+		resolver.Certificates = kept
+	}
+
+	return removed
+}
+
+func readRemoteAcmeStore(client *ssh.Client) (AcmeStore, error) {
+	content, _, err := runSSHCommandSilent(client, shellCommand("sudo", "cat", acmeStoragePath), "")
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s, is traefik setup on this server? %v", acmeStoragePath, err)
+	}
+
+	return parseAcmeStore([]byte(content))
+}
+
+func (r *remote) listCertificates() error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("reading certificate storage")
+
+		store, err := readRemoteAcmeStore(client)
+		if err != nil {
+			return err
+		}
+
+		inspectOut, _, err := runSSHCommandSilent(client, "sudo docker ps -q --filter label=traefik.enable=true | xargs -r sudo docker inspect --format '{{.Name}} {{json .Config.Labels}}'", "")
+		if err != nil {
+			return fmt.Errorf("failed to inspect web containers: %v", err)
+		}
+
+		report := buildCertificateReport(store, mapHostsToApps(inspectOut))
+		if len(report) == 0 {
+			fmt.Println("no certificates or web domains found on server")
+			return nil
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DOMAIN\tISSUER\tEXPIRES\tAPP\tSTATUS")
+		for _, ci := range report {
+			expires := "-"
+			if !ci.NotAfter.IsZero() {
+				expires = fmt.Sprintf("%s (%dd)", ci.NotAfter.Format("2006-01-02"), int(ci.NotAfter.Sub(now).Hours()/24))
+			}
+
+			issuer := ci.Issuer
+			if ci.Missing {
+				issuer = "-"
+			}
+
+			app := ci.App
+			if app == "" {
+				app = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ci.Domain, issuer, expires, app, ci.status(now))
+		}
+		w.Flush()
+
+		return nil
+	})
+}
+
+func (r *remote) renewCertificate(domain string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Printf("forcing certificate reissue for %s\n", domain)
+
+		store, err := readRemoteAcmeStore(client)
+		if err != nil {
+			return err
+		}
+
+		removed := removeAcmeCertificates(store, domain)
+		if removed == 0 {
+			return fmt.Errorf("no stored certificate found for %s", domain)
+		}
+
+		storeBytes, err := json.MarshalIndent(store, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize acme storage: %v", err)
+		}
+
+		_, _, err = runSSHCommandSilent(client, shellCommand("sudo", "cp", "-p", acmeStoragePath, acmeStoragePath+".bak"), "")
+		if err != nil {
+			return err
+		}
+
+		// the store holds the certificates' private keys
+		err = writeRemoteSecretFile(client, acmeStoragePath, storeBytes, false)
+		if err != nil {
+			return err
+		}
+
+		_, _, err = runSSHCommandSilent(client, "sudo docker restart traefik", "")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("removed %d certificate(s), traefik restarted and will request a new certificate on the next request to %s\n", removed, domain)
+
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestCertificate(t *testing.T, domain string, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test CA"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{domain},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestExtractHostsFromRule(t *testing.T) {
+	t.Run("lord style rule", func(t *testing.T) {
+		hosts := extractHostsFromRule("Host(`myapp.example.com`) || Host(`www.myapp.example.com`)")
+		assert.Equal(t, []string{"myapp.example.com", "www.myapp.example.com"}, hosts)
+	})
+
+	t.Run("multiple hosts in one matcher", func(t *testing.T) {
+		hosts := extractHostsFromRule("Host(`a.example.com`,`b.example.com`) && PathPrefix(`/api`)")
+		assert.Equal(t, []string{"a.example.com", "b.example.com"}, hosts)
+	})
+
+	t.Run("no host matcher", func(t *testing.T) {
+		hosts := extractHostsFromRule("PathPrefix(`/`)")
+		assert.Empty(t, hosts)
+	})
+}
+
+func TestMapHostsToApps(t *testing.T) {
+	output := "/myapp {\"traefik.enable\":\"true\",\"traefik.http.routers.myapp.rule\":\"Host(`myapp.example.com`)\"}\n" +
+		"/other {\"traefik.http.routers.other.rule\":\"Host(`other.example.com`)\"}\n" +
+		"garbage\n"
+
+	hostApps := mapHostsToApps(output)
+	assert.Equal(t, map[string]string{
+		"myapp.example.com": "myapp",
+		"other.example.com": "other",
+	}, hostApps)
+}
+
+func TestBuildCertificateReport(t *testing.T) {
+	now := time.Now()
+	store := AcmeStore{
+		"theresolver": &AcmeResolverStore{
+			Certificates: []*AcmeCertificate{
+				{
+					Domain:      AcmeDomain{Main: "myapp.example.com"},
+					Certificate: encodeTestCertificate(t, "myapp.example.com", now.Add(60*24*time.Hour)),
+				},
+				{
+					Domain:      AcmeDomain{Main: "soon.example.com"},
+					Certificate: encodeTestCertificate(t, "soon.example.com", now.Add(5*24*time.Hour)),
+				},
+			},
+		},
+	}
+
+	hostApps := map[string]string{
+		"myapp.example.com":  "myapp",
+		"nocert.example.com": "nocert",
+		"soon.example.com":   "soon",
+	}
+
+	report := buildCertificateReport(store, hostApps)
+	assert.Len(t, report, 3)
+
+	assert.Equal(t, "myapp.example.com", report[0].Domain)
+	assert.Equal(t, "Test CA", report[0].Issuer)
+	assert.Equal(t, "myapp", report[0].App)
+	assert.Equal(t, "ok", report[0].status(now))
+
+	assert.Equal(t, "nocert.example.com", report[1].Domain)
+	assert.Equal(t, "MISSING", report[1].status(now))
+
+	assert.Equal(t, "soon.example.com", report[2].Domain)
+	assert.Equal(t, "EXPIRING", report[2].status(now))
+}
+
+func TestRemoveAcmeCertificates(t *testing.T) {
+	store := AcmeStore{
+		"theresolver": &AcmeResolverStore{
+			Certificates: []*AcmeCertificate{
+				{Domain: AcmeDomain{Main: "myapp.example.com"}},
+				{Domain: AcmeDomain{Main: "other.example.com", SANs: []string{"www.other.example.com"}}},
+			},
+		},
+	}
+
+	assert.Equal(t, 1, removeAcmeCertificates(store, "www.other.example.com"))
+	assert.Len(t, store["theresolver"].Certificates, 1)
+	assert.Equal(t, "myapp.example.com", store["theresolver"].Certificates[0].Domain.Main)
+
+	assert.Equal(t, 0, removeAcmeCertificates(store, "missing.example.com"))
+}
+
+func TestParseAcmeStore(t *testing.T) {
+	t.Run("empty file", func(t *testing.T) {
+		store, err := parseAcmeStore([]byte(""))
+		assert.NoError(t, err)
+		assert.Empty(t, store)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := parseAcmeStore([]byte("{not json"))
+		assert.Error(t, err)
+	})
+}
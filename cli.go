@@ -0,0 +1,735 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// globalOptions are accepted before or after any command
+type globalOptions struct {
+	Config  string
+	Server  string
+	Verbose bool
+	Json    bool
+}
+
+// commandOptions holds every per-command flag, each command registers only the ones it accepts
+type commandOptions struct {
+	Yes         bool
+	Host        bool
+	Force       bool
+	RemoteBuild bool
+	Image       string
+	Plan        bool
+	Upgrade     bool
+	Dashboard   bool
+	Explain     bool
+	Logs        bool
+	Router      string
+	Since       string
+	Tail        int
+	Renew       string
+	DryRun      bool
+}
+
+// command is a lord subcommand, i.e. lord deploy
+type command struct {
+	Name    string
+	Summary string
+
+	// usage of the positional arguments, i.e. "<on|off>"
+	Args    string
+	MinArgs int
+	// -1 for any number of arguments
+	MaxArgs int
+
+	// allowed values of the first argument, also offered by shell completion
+	Choices []string
+
+	// the single dash flag of earlier versions takes the first argument as its value, i.e. -maintenance on
+	LegacyValue bool
+
+	// prints json on stdout with --json. commands taking --plan print the plan, so --plan is required there
+	Json bool
+
+	Flags func(fs *flag.FlagSet, o *commandOptions)
+
+	// checks combinations of flags and arguments the flag package can't
+	Check func(inv *invocation) error
+}
+
+// invocation is a parsed command line
+type invocation struct {
+	Global  globalOptions
+	Command *command
+	Options commandOptions
+	Args    []string
+}
+
+// usageError is a command line lord can't run, it exits with status 2 and points to the help of the command
+type usageError struct {
+	command string
+	err     error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func registerPlanFlag(fs *flag.FlagSet, o *commandOptions) {
+	fs.BoolVar(&o.Plan, "plan", false, "read the server state and print every command, upload and traefik change that would run without changing anything")
+}
+
+func registerHostFlag(usage string) func(fs *flag.FlagSet, o *commandOptions) {
+	return func(fs *flag.FlagSet, o *commandOptions) {
+		fs.BoolVar(&o.Host, "host", false, usage)
+	}
+}
+
+var commands = []*command{
+	{
+		Name:    "init",
+		Summary: "create lord.yml with a wizard that inspects the project and tests ssh to the server",
+		Args:    "[key=value...]",
+		MaxArgs: -1,
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.BoolVar(&o.Yes, "yes", false, "don't ask anything: use the detected values and key=value arguments (i.e. server=203.0.113.10 web=true hostname=myapp.example.com)")
+		},
+	},
+	{Name: "validate", Summary: "check the config for mistakes without connecting to the server", Json: true},
+	{Name: "config-show", Summary: "print the effective config after extends overlays and defaults are applied"},
+	{
+		Name:        "secrets",
+		Summary:     "manage the encrypted environmentfile: edit, set KEY=value (or KEY to read the value from stdin), get KEY or rotate the key",
+		Args:        "<edit|set|get|rotate> [KEY[=value]]",
+		MinArgs:     1,
+		MaxArgs:     2,
+		Choices:     []string{"edit", "set", "get", "rotate"},
+		LegacyValue: true,
+		Flags:       registerHostFlag("act on the hostenvironmentfile instead of the environmentfile"),
+	},
+	{Name: "secrets-audit", Summary: "report secret files on the server (env files, registry credentials, certificates) that other users can read", Json: true},
+	{
+		Name:    "deploy",
+		Summary: "build and deploy the container",
+		Json:    true,
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.BoolVar(&o.Force, "force", false, "deploy even if the git working tree has uncommitted changes")
+			fs.BoolVar(&o.RemoteBuild, "remotebuild", false, "build the container on the server instead of locally (overrides build.remote in the config)")
+			fs.StringVar(&o.Image, "image", "", "deploy a prebuilt image reference instead of building (overrides image in the config)")
+			registerPlanFlag(fs, o)
+		},
+	},
+	{
+		Name:    "sync",
+		Summary: "recreate the container only if it differs from the config (image, labels, env file, volumes, network), without building",
+		Json:    true,
+		Flags:   registerPlanFlag,
+	},
+	{Name: "drift", Summary: "report how the container and proxy config on the server differ from the config without changing anything", Json: true},
+	{
+		Name:    "server",
+		Summary: "only run and/or check the server setup, including the reverse proxy",
+		Json:    true,
+		Flags:   registerPlanFlag,
+	},
+	{Name: "recover", Summary: "attempt to recover a server that has a bad install"},
+	{
+		Name:    "proxy",
+		Summary: "only run and/or check the reverse proxy setup",
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.BoolVar(&o.Upgrade, "upgrade", false, "pull the pinned traefik version, validate the config and swap the running proxy")
+			fs.BoolVar(&o.Dashboard, "dashboard", false, "open the traefik dashboard via ssh tunnel")
+			fs.BoolVar(&o.Explain, "explain", false, "show which app drives each global proxy setting")
+			fs.BoolVar(&o.Logs, "logs", false, "stream proxy access logs")
+			fs.StringVar(&o.Router, "router", "", "used with --logs, router name to filter access logs by (defaults to the app name, \"all\" for every router)")
+		},
+		Check: func(inv *invocation) error {
+			o := inv.Options
+			count := 0
+			for _, set := range []bool{o.Upgrade, o.Dashboard, o.Explain, o.Logs} {
+				if set {
+					count++
+				}
+			}
+			if count > 1 {
+				return fmt.Errorf("only one of --upgrade, --dashboard, --explain or --logs can be used at a time")
+			}
+			if o.Router != "" && !o.Logs {
+				return fmt.Errorf("--router is used with --logs")
+			}
+			return nil
+		},
+	},
+	{
+		Name:    "registry",
+		Summary: "ensure the container registry can be authenticated on the host, including installing platform specific login tools",
+		Flags:   registerHostFlag("deploy a lord hosted container registry on the server"),
+	},
+	{
+		Name:    "logs",
+		Summary: "stream logs from the running container",
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.StringVar(&o.Since, "since", "", "only show logs since a duration ago (i.e. 1h or 30m) or a timestamp (i.e. 2026-01-02T15:04:05Z)")
+			fs.IntVar(&o.Tail, "tail", 30, "number of lines to show from the end of the logs before following")
+		},
+		Check: func(inv *invocation) error {
+			if inv.Options.Tail < 0 {
+				return fmt.Errorf("--tail must be 0 or more, got %d", inv.Options.Tail)
+			}
+			return validateLogsSince(inv.Options.Since)
+		},
+	},
+	{Name: "logdownload", Summary: "download the full log file of the container from the server"},
+	{Name: "destroy", Summary: "stop and delete the running container"},
+	{Name: "status", Summary: "get the status of the running container", Json: true},
+	{Name: "monitor", Summary: "get system stats from the server"},
+	{Name: "dozzle", Summary: "open the dozzle web ui for monitoring containers via ssh tunnel"},
+	{Name: "diff", Summary: "compare local files with deployed files on the server"},
+	{
+		Name:    "certs",
+		Summary: "list tls certificates on the server with issuer, expiry and owning app",
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.StringVar(&o.Renew, "renew", "", "force reissue of the certificate for the given domain")
+		},
+	},
+	{
+		Name:        "maintenance",
+		Summary:     "turn maintenance mode for a web app on or off",
+		Args:        "<on|off>",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Choices:     []string{"on", "off"},
+		LegacyValue: true,
+	},
+	{
+		Name:    "prune",
+		Summary: "delete old images of lord apps on the server and old app images in the registry, keeping the newest prune.keep",
+		Flags: func(fs *flag.FlagSet, o *commandOptions) {
+			fs.BoolVar(&o.DryRun, "dryrun", false, "list what would be deleted and the space it frees without deleting anything")
+		},
+	},
+	{Name: "version", Summary: "print the lord version"},
+	{Name: "help", Summary: "print help for lord or a command", Args: "[command]", MaxArgs: 1},
+	{
+		Name:    "completion",
+		Summary: "print a shell completion script, i.e. source <(lord completion bash)",
+		Args:    "<bash|zsh|fish>",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Choices: []string{"bash", "zsh", "fish"},
+	},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func commandNames() []string {
+	names := []string{}
+	for _, cmd := range commands {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+// validateLogsSince accepts what docker logs --since does: a duration, an rfc3339 timestamp, a date or unix seconds
+func validateLogsSince(since string) error {
+	if since == "" {
+		return nil
+	}
+
+	_, err := time.ParseDuration(since)
+	if err == nil {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		_, err = time.Parse(layout, since)
+		if err == nil {
+			return nil
+		}
+	}
+
+	_, err = strconv.ParseFloat(since, 64)
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("--since must be a duration (i.e. 1h) or a timestamp (i.e. 2026-01-02T15:04:05Z), got %q", since)
+}
+
+// registerCommon registers the global options with their current values as defaults, the command flag set
+// would otherwise reset options given before the command
+func (g *globalOptions) registerCommon(fs *flag.FlagSet) {
+	fs.StringVar(&g.Config, "config", g.Config, "lord config key to use (i.e. set to \"beta\" to pickup the beta.lord.yml file)")
+	fs.BoolVar(&g.Verbose, "verbose", g.Verbose, "print every command run locally and on the server, including the silent checks")
+	fs.BoolVar(&g.Json, "json", g.Json, "print json on stdout (progress output goes to stderr): the report of status, drift, validate and secrets-audit, or the plan of deploy, server and sync with --plan")
+}
+
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	g.registerCommon(fs)
+	fs.StringVar(&g.Server, "server", g.Server, "server address to use instead of server in the config")
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseInterspersed parses flags that come before, between or after positional arguments. everything after
+// "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		consumed := args[:len(args)-len(rest)]
+		if len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// splitFlagArg splits -name=value or --name into the flag name and value
+func splitFlagArg(arg string) (string, string, bool) {
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	parts := strings.SplitN(name, "=", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1], true
+	}
+	return name, "", false
+}
+
+// serverOptionValue reports whether -server at args[i] is the global --server option and returns its value. the
+// server command of earlier versions was also -server, it is used without a value.
+func serverOptionValue(args []string, i int) (string, int, bool) {
+	_, value, hasValue := splitFlagArg(args[i])
+	if hasValue {
+		_, err := strconv.ParseBool(value)
+		return value, 1, err != nil
+	}
+
+	if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+		return args[i+1], 2, true
+	}
+
+	return "", 1, false
+}
+
+// isLegacyCommandLine detects the single dash flags of earlier versions (lord -deploy). the new form always
+// names the command before any flag other than the global options.
+func isLegacyCommandLine(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return false
+		}
+
+		name, _, hasValue := splitFlagArg(arg)
+		switch name {
+		case "config":
+			if !hasValue {
+				i++
+			}
+		case "verbose", "json", "h", "help":
+		case "server":
+			_, width, isOption := serverOptionValue(args, i)
+			if !isOption {
+				return true
+			}
+			i += width - 1
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// legacyValue records a single dash flag of earlier versions so it can be translated to a command
+type legacyValue struct {
+	isBool bool
+	set    bool
+	value  string
+}
+
+func (v *legacyValue) String() string {
+	return v.value
+}
+
+func (v *legacyValue) Set(value string) error {
+	v.value = value
+	v.set = true
+	return nil
+}
+
+func (v *legacyValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func (v *legacyValue) enabled() bool {
+	if !v.isBool {
+		return v.set
+	}
+	on, err := strconv.ParseBool(v.value)
+	return v.set && err == nil && on
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// translateLegacyArgs rewrites a command line of earlier versions to the subcommand form, i.e.
+// -config beta -deploy -force becomes --config=beta deploy --force. earlier versions silently ran only one
+// of several commands, combining them is now an error.
+func translateLegacyArgs(args []string) ([]string, error) {
+	var global globalOptions
+
+	// the global --server option is taken out first as -server alone is the server command
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		name, _, _ := splitFlagArg(args[i])
+		if strings.HasPrefix(args[i], "-") && name == "server" {
+			value, width, isOption := serverOptionValue(args, i)
+			if isOption {
+				global.Server = value
+				i += width - 1
+				continue
+			}
+		}
+		rest = append(rest, args[i])
+	}
+
+	fs := newFlagSet("lord")
+	global.registerCommon(fs)
+	help := fs.Bool("help", false, "")
+	fs.BoolVar(help, "h", false, "")
+
+	values := map[string]*legacyValue{}
+	define := func(name string, isBool bool) {
+		if _, ok := values[name]; !ok {
+			values[name] = &legacyValue{isBool: isBool}
+			fs.Var(values[name], name, "")
+		}
+	}
+
+	modifiers := []string{}
+	for _, cmd := range commands {
+		if cmd.Name == "help" || cmd.Name == "completion" {
+			continue
+		}
+		define(cmd.Name, !cmd.LegacyValue)
+
+		if cmd.Flags != nil {
+			sub := newFlagSet(cmd.Name)
+			cmd.Flags(sub, &commandOptions{})
+			sub.VisitAll(func(f *flag.Flag) {
+				define(f.Name, isBoolFlag(f))
+				modifiers = append(modifiers, f.Name)
+			})
+		}
+	}
+
+	positional, err := parseInterspersed(fs, rest)
+	if errors.Is(err, flag.ErrHelp) {
+		*help = true
+	} else if err != nil {
+		return nil, err
+	}
+
+	// -logs is the logs command, unless it's used with -proxy
+	isModifier := map[string]bool{}
+	for _, name := range modifiers {
+		isModifier[name] = values[name].enabled()
+	}
+	isModifier["logs"] = values["proxy"].enabled() && values["logs"].enabled()
+
+	selected := []string{}
+	for _, cmd := range commands {
+		value, ok := values[cmd.Name]
+		if ok && value.enabled() && !(cmd.Name == "logs" && isModifier["logs"]) {
+			selected = append(selected, cmd.Name)
+		}
+	}
+
+	if *help {
+		if len(selected) == 1 {
+			return []string{"help", selected[0]}, nil
+		}
+		return []string{"help"}, nil
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no command given")
+	} else if len(selected) > 1 {
+		return nil, fmt.Errorf("-%s can't be combined, run one command at a time", strings.Join(selected, " and -"))
+	}
+
+	translated := []string{}
+	if global.Config != "" {
+		translated = append(translated, "--config="+global.Config)
+	}
+	if global.Server != "" {
+		translated = append(translated, "--server="+global.Server)
+	}
+	if global.Verbose {
+		translated = append(translated, "--verbose")
+	}
+	if global.Json {
+		translated = append(translated, "--json")
+	}
+
+	translated = append(translated, selected[0])
+
+	names := []string{}
+	for name, on := range isModifier {
+		if on {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if values[name].isBool {
+			translated = append(translated, "--"+name)
+		} else {
+			translated = append(translated, fmt.Sprintf("--%s=%s", name, values[name].value))
+		}
+	}
+
+	if findCommand(selected[0]).LegacyValue {
+		positional = append([]string{values[selected[0]].value}, positional...)
+	}
+	if len(positional) > 0 {
+		translated = append(append(translated, "--"), positional...)
+	}
+
+	return translated, nil
+}
+
+// parseCommandLine parses the arguments of lord, in the subcommand form or the single dash flags of earlier
+// versions. --help anywhere is parsed as the help command.
+func parseCommandLine(args []string) (*invocation, error) {
+	if isLegacyCommandLine(args) {
+		translated, err := translateLegacyArgs(args)
+		if err != nil {
+			return nil, &usageError{err: err}
+		}
+		args = translated
+	}
+
+	inv := &invocation{}
+	help := findCommand("help")
+
+	fs := newFlagSet("lord")
+	inv.Global.register(fs)
+
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		inv.Command = help
+		return inv, nil
+	} else if err != nil {
+		return nil, &usageError{err: err}
+	}
+
+	if fs.NArg() == 0 {
+		return nil, &usageError{err: fmt.Errorf("no command given")}
+	}
+
+	name := fs.Arg(0)
+	inv.Command = findCommand(name)
+	if inv.Command == nil {
+		message := fmt.Sprintf("unknown command %q", name)
+		suggestion := suggestKey(name, commandNames())
+		if suggestion != "" {
+			message += fmt.Sprintf(", did you mean %q?", suggestion)
+		}
+		return nil, &usageError{err: errors.New(message)}
+	}
+
+	cfs := newFlagSet("lord " + name)
+	inv.Global.register(cfs)
+	if inv.Command.Flags != nil {
+		inv.Command.Flags(cfs, &inv.Options)
+	}
+
+	inv.Args, err = parseInterspersed(cfs, fs.Args()[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return &invocation{Global: inv.Global, Command: help, Args: []string{name}}, nil
+	} else if err != nil {
+		return nil, &usageError{command: name, err: err}
+	}
+
+	err = checkInvocation(inv)
+	if err != nil {
+		return nil, &usageError{command: name, err: err}
+	}
+
+	return inv, nil
+}
+
+func checkInvocation(inv *invocation) error {
+	cmd := inv.Command
+
+	if len(inv.Args) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(inv.Args) > cmd.MaxArgs) {
+		if cmd.Args == "" {
+			return fmt.Errorf("%s takes no arguments, got %q", cmd.Name, strings.Join(inv.Args, " "))
+		}
+		return fmt.Errorf("usage: lord %s %s", cmd.Name, cmd.Args)
+	}
+
+	if len(cmd.Choices) > 0 && !containsString(cmd.Choices, inv.Args[0]) {
+		return fmt.Errorf("unknown %s argument %q, expected %s", cmd.Name, inv.Args[0], strings.Join(cmd.Choices, ", "))
+	}
+
+	if cmd.Name == "help" && len(inv.Args) == 1 && findCommand(inv.Args[0]) == nil {
+		return fmt.Errorf("unknown command %q", inv.Args[0])
+	}
+
+	if inv.Global.Json && !cmd.Json {
+		return fmt.Errorf("--json is supported by %s", strings.Join(jsonCommandUsages(), ", "))
+	}
+
+	if inv.Global.Json && cmd.hasFlag("plan") && !inv.Options.Plan {
+		return fmt.Errorf("--json is used with --plan on %s", cmd.Name)
+	}
+
+	if cmd.Check != nil {
+		return cmd.Check(inv)
+	}
+
+	return nil
+}
+
+func (cmd *command) hasFlag(name string) bool {
+	if cmd.Flags == nil {
+		return false
+	}
+	fs := newFlagSet(cmd.Name)
+	cmd.Flags(fs, &commandOptions{})
+	return fs.Lookup(name) != nil
+}
+
+// jsonCommandUsages lists the commands printing json, i.e. status or deploy --plan
+func jsonCommandUsages() []string {
+	usages := []string{}
+	for _, cmd := range commands {
+		if !cmd.Json {
+			continue
+		}
+		if cmd.hasFlag("plan") {
+			usages = append(usages, cmd.Name+" --plan")
+		} else {
+			usages = append(usages, cmd.Name)
+		}
+	}
+	return usages
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFlagUsage lists flags as --name type followed by the usage on the next line
+func writeFlagUsage(out io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		kind, usage := flag.UnquoteUsage(f)
+		if kind != "" {
+			kind = " " + kind
+		}
+		if f.DefValue != "" && f.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(out, "  --%s%s\n      %s\n", f.Name, kind, usage)
+	})
+}
+
+func writeMainUsage(out io.Writer) {
+	fmt.Fprintln(out, "usage: lord [global flags] <command> [flags] [arguments]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "commands:")
+
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.Name))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-*s  %s\n", width, cmd.Name, cmd.Summary)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "global flags:")
+	fs := newFlagSet("lord")
+	(&globalOptions{}).register(fs)
+	writeFlagUsage(out, fs)
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "run lord help <command> for the flags of a command. the single dash flags of earlier versions")
+	fmt.Fprintln(out, "(i.e. lord -deploy -force) still work.")
+}
+
+func writeCommandUsage(out io.Writer, cmd *command) {
+	usage := "lord " + cmd.Name
+	if cmd.Flags != nil {
+		usage += " [flags]"
+	}
+	if cmd.Args != "" {
+		usage += " " + cmd.Args
+	}
+
+	fmt.Fprintf(out, "usage: %s\n\n%s\n", usage, cmd.Summary)
+
+	if cmd.Flags != nil {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "flags:")
+		fs := newFlagSet(cmd.Name)
+		cmd.Flags(fs, &commandOptions{})
+		writeFlagUsage(out, fs)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "global flags:")
+	fs := newFlagSet("lord")
+	(&globalOptions{}).register(fs)
+	writeFlagUsage(out, fs)
+}
+
+// writeHelp prints the usage of lord or of the command named in args
+func writeHelp(out io.Writer, args []string) {
+	if len(args) == 1 {
+		writeCommandUsage(out, findCommand(args[0]))
+		return
+	}
+	writeMainUsage(out)
+}
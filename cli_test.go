@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	inv, err := parseCommandLine([]string{"--config", "beta", "logs", "--since", "1h", "--tail=100", "--verbose"})
+	assert.NoError(t, err)
+	assert.Equal(t, "logs", inv.Command.Name)
+	assert.Equal(t, globalOptions{Config: "beta", Verbose: true}, inv.Global)
+	assert.Equal(t, "1h", inv.Options.Since)
+	assert.Equal(t, 100, inv.Options.Tail)
+
+	// flags may follow arguments
+	inv, err = parseCommandLine([]string{"secrets", "set", "API_TOKEN", "--host"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"set", "API_TOKEN"}, inv.Args)
+	assert.True(t, inv.Options.Host)
+
+	inv, err = parseCommandLine([]string{"--server", "10.0.0.9", "deploy", "--plan", "--json"})
+	assert.NoError(t, err)
+	assert.Equal(t, globalOptions{Server: "10.0.0.9", Json: true}, inv.Global)
+	assert.True(t, inv.Options.Plan)
+
+	// reports print json without --plan
+	for _, name := range []string{"status", "drift", "validate", "secrets-audit"} {
+		inv, err = parseCommandLine([]string{name, "--json"})
+		assert.NoError(t, err, name)
+		assert.True(t, inv.Global.Json)
+	}
+
+	inv, err = parseCommandLine([]string{"logs"})
+	assert.NoError(t, err)
+	assert.Equal(t, 30, inv.Options.Tail)
+}
+
+func TestParseCommandLineHelp(t *testing.T) {
+	for _, args := range [][]string{{"help"}, {"--help"}, {"-h"}} {
+		inv, err := parseCommandLine(args)
+		assert.NoError(t, err)
+		assert.Equal(t, "help", inv.Command.Name)
+		assert.Empty(t, inv.Args)
+	}
+
+	for _, args := range [][]string{{"help", "deploy"}, {"deploy", "--help"}, {"-deploy", "-help"}} {
+		inv, err := parseCommandLine(args)
+		assert.NoError(t, err)
+		assert.Equal(t, "help", inv.Command.Name)
+		assert.Equal(t, []string{"deploy"}, inv.Args)
+	}
+}
+
+func TestParseCommandLineInvalidUsage(t *testing.T) {
+	cases := []struct {
+		args    []string
+		command string
+		err     string
+	}{
+		{[]string{}, "", "no command given"},
+		{[]string{"deploi"}, "", `unknown command "deploi", did you mean "deploy"?`},
+		{[]string{"deploy", "--dryrun"}, "deploy", "flag provided but not defined: -dryrun"},
+		{[]string{"status", "myapp"}, "status", `status takes no arguments, got "myapp"`},
+		{[]string{"maintenance"}, "maintenance", "usage: lord maintenance <on|off>"},
+		{[]string{"maintenance", "maybe"}, "maintenance", `unknown maintenance argument "maybe", expected on, off`},
+		{[]string{"logs", "--tail", "-1"}, "logs", "--tail must be 0 or more, got -1"},
+		{[]string{"proxy", "--logs", "--upgrade"}, "proxy", "only one of --upgrade, --dashboard, --explain or --logs can be used at a time"},
+		{[]string{"proxy", "--router", "all"}, "proxy", "--router is used with --logs"},
+		{[]string{"logs", "--json"}, "logs", "--json is supported by validate, secrets-audit, deploy --plan, sync --plan, drift, server --plan, status"},
+		{[]string{"deploy", "--json"}, "deploy", "--json is used with --plan on deploy"},
+		{[]string{"help", "nope"}, "help", `unknown command "nope"`},
+		{[]string{"-deploy", "-logs"}, "", "-deploy and -logs can't be combined, run one command at a time"},
+		{[]string{"-plan"}, "", "no command given"},
+	}
+
+	for _, tc := range cases {
+		_, err := parseCommandLine(tc.args)
+
+		var usage *usageError
+		if assert.ErrorAs(t, err, &usage, "%v", tc.args) {
+			assert.Equal(t, tc.err, usage.Error(), "%v", tc.args)
+			assert.Equal(t, tc.command, usage.command, "%v", tc.args)
+		}
+	}
+}
+
+func TestTranslateLegacyArgs(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-deploy"}, []string{"deploy"}},
+		{[]string{"-config", "beta", "-deploy", "-force", "-image", "grafana/grafana:11.0.0"}, []string{"--config=beta", "deploy", "--force", "--image=grafana/grafana:11.0.0"}},
+		{[]string{"-deploy", "-plan", "-json"}, []string{"--json", "deploy", "--plan"}},
+		{[]string{"-proxy", "-logs", "-router", "all"}, []string{"proxy", "--logs", "--router=all"}},
+		{[]string{"-registry", "-host"}, []string{"registry", "--host"}},
+		{[]string{"-host", "-secrets", "set", "API_TOKEN"}, []string{"secrets", "--host", "--", "set", "API_TOKEN"}},
+		{[]string{"-maintenance", "on"}, []string{"maintenance", "--", "on"}},
+		{[]string{"-init", "-yes", "server=10.0.0.5"}, []string{"init", "--yes", "--", "server=10.0.0.5"}},
+		{[]string{"-prune", "-dryrun=false"}, []string{"prune"}},
+		{[]string{"-version"}, []string{"version"}},
+	}
+
+	for _, tc := range cases {
+		assert.True(t, isLegacyCommandLine(tc.args), "%v", tc.args)
+
+		translated, err := translateLegacyArgs(tc.args)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, translated)
+
+		// every translation parses in the subcommand form
+		_, err = parseCommandLine(tc.args)
+		assert.NoError(t, err, "%v", tc.args)
+	}
+}
+
+func TestServerOptionOrCommand(t *testing.T) {
+	// -server alone is the server command of earlier versions
+	for _, args := range [][]string{{"-server"}, {"-server", "-plan"}, {"-config", "beta", "-server"}, {"--server=true"}} {
+		inv, err := parseCommandLine(args)
+		assert.NoError(t, err, "%v", args)
+		assert.Equal(t, "server", inv.Command.Name, "%v", args)
+		assert.Equal(t, "", inv.Global.Server, "%v", args)
+	}
+
+	// with a value it's the global option
+	for _, args := range [][]string{{"--server", "10.0.0.9", "status"}, {"-server=10.0.0.9", "status"}, {"-status", "-server", "10.0.0.9"}} {
+		inv, err := parseCommandLine(args)
+		assert.NoError(t, err, "%v", args)
+		assert.Equal(t, "status", inv.Command.Name, "%v", args)
+		assert.Equal(t, "10.0.0.9", inv.Global.Server, "%v", args)
+	}
+
+	inv, err := parseCommandLine([]string{"--server", "10.0.0.9", "server", "--plan"})
+	assert.NoError(t, err)
+	assert.Equal(t, "server", inv.Command.Name)
+	assert.Equal(t, "10.0.0.9", inv.Global.Server)
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := newFlagSet("test")
+	verbose := fs.Bool("v", false, "")
+
+	args, err := parseInterspersed(fs, []string{"a", "-v", "b", "--", "-c"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, []string{"a", "b", "-c"}, args)
+
+	_, err = parseInterspersed(fs, []string{"-h"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestValidateLogsSince(t *testing.T) {
+	for _, since := range []string{"", "1h", "90m", "2026-01-02T15:04:05Z", "2026-01-02", "1767366245"} {
+		assert.NoError(t, validateLogsSince(since), since)
+	}
+	assert.Error(t, validateLogsSince("yesterday"))
+}
+
+func TestWriteHelp(t *testing.T) {
+	var out bytes.Buffer
+	writeHelp(&out, nil)
+	for _, cmd := range commands {
+		assert.Contains(t, out.String(), "  "+cmd.Name+" ")
+	}
+
+	out.Reset()
+	writeHelp(&out, []string{"logs"})
+	assert.True(t, strings.HasPrefix(out.String(), "usage: lord logs [flags]\n"))
+	assert.Contains(t, out.String(), "  --tail int\n      number of lines to show from the end of the logs before following (default 30)\n")
+	assert.Contains(t, out.String(), "  --config string\n")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// completionFlag is a flag offered by shell completion
+type completionFlag struct {
+	Name  string
+	Usage string
+	// takes a value, completion doesn't offer anything after it except for --config
+	Value bool
+}
+
+func flagSetCompletions(fs *flag.FlagSet) []completionFlag {
+	flags := []completionFlag{}
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, completionFlag{Name: f.Name, Usage: f.Usage, Value: !isBoolFlag(f)})
+	})
+	return flags
+}
+
+func globalCompletionFlags() []completionFlag {
+	fs := newFlagSet("lord")
+	(&globalOptions{}).register(fs)
+	return flagSetCompletions(fs)
+}
+
+func commandCompletionFlags(cmd *command) []completionFlag {
+	if cmd.Flags == nil {
+		return []completionFlag{}
+	}
+	fs := newFlagSet(cmd.Name)
+	cmd.Flags(fs, &commandOptions{})
+	return flagSetCompletions(fs)
+}
+
+// completionChoices are the values completed for the first argument of a command
+func completionChoices(cmd *command) []string {
+	if cmd.Name == "help" {
+		return commandNames()
+	}
+	return cmd.Choices
+}
+
+func completionFlagNames(flags []completionFlag) []string {
+	names := []string{}
+	for _, f := range flags {
+		names = append(names, "--"+f.Name)
+	}
+	return names
+}
+
+// valueFlagPattern is a shell case pattern matching every flag that takes a value, i.e. --config|--image
+func valueFlagPattern() string {
+	seen := map[string]bool{}
+	patterns := []string{}
+
+	flags := globalCompletionFlags()
+	for _, cmd := range commands {
+		flags = append(flags, commandCompletionFlags(cmd)...)
+	}
+
+	for _, f := range flags {
+		if f.Value && !seen[f.Name] {
+			seen[f.Name] = true
+			patterns = append(patterns, "--"+f.Name, "-"+f.Name)
+		}
+	}
+
+	return strings.Join(patterns, "|")
+}
+
+// writeCompletion prints the completion script for a shell, generated from the command table
+func writeCompletion(out io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		writeBashCompletion(out)
+	case "zsh":
+		writeZshCompletion(out)
+	case "fish":
+		writeFishCompletion(out)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+	return nil
+}
+
+// the shared part of the bash and zsh scripts: find the command in the words typed so far, skipping flags and
+// the values of flags that take one
+func writeFindCommand(out io.Writer, words string, first string, current string) {
+	fmt.Fprintf(out, "    local cmd=\"\" i\n")
+	fmt.Fprintf(out, "    for ((i = %s; i < %s; i++)); do\n", first, current)
+	fmt.Fprintf(out, "        case \"${%s[i]}\" in\n", words)
+	fmt.Fprintf(out, "            %s) ((i++)) ;;\n", valueFlagPattern())
+	fmt.Fprintf(out, "            -*) ;;\n")
+	fmt.Fprintf(out, "            *) cmd=\"${%s[i]}\"; break ;;\n", words)
+	fmt.Fprintf(out, "        esac\n")
+	fmt.Fprintf(out, "    done\n")
+}
+
+func writeBashCompletion(out io.Writer) {
+	globals := strings.Join(completionFlagNames(globalCompletionFlags()), " ")
+
+	fmt.Fprintln(out, "# bash completion for lord, load it with: source <(lord completion bash)")
+	fmt.Fprintln(out, "_lord() {")
+	fmt.Fprintln(out, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "    # config keys are the prefixes of <key>.lord.yml files")
+	fmt.Fprintln(out, "    if [[ \"$prev\" == \"--config\" || \"$prev\" == \"-config\" ]]; then")
+	fmt.Fprintln(out, "        COMPREPLY=($(compgen -W \"$(ls *.lord.yml *.lord.yaml 2>/dev/null | sed -E 's/\\.lord\\.ya?ml$//')\" -- \"$cur\"))")
+	fmt.Fprintln(out, "        return")
+	fmt.Fprintln(out, "    fi")
+	fmt.Fprintln(out)
+	writeFindCommand(out, "COMP_WORDS", "1", "COMP_CWORD")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "    local words")
+	fmt.Fprintln(out, "    case \"$cmd\" in")
+	fmt.Fprintf(out, "        \"\") words=\"%s %s\" ;;\n", strings.Join(commandNames(), " "), globals)
+	for _, cmd := range commands {
+		words := append([]string{}, completionChoices(cmd)...)
+		words = append(words, completionFlagNames(commandCompletionFlags(cmd))...)
+		words = append(words, globals)
+		fmt.Fprintf(out, "        %s) words=\"%s\" ;;\n", cmd.Name, strings.Join(words, " "))
+	}
+	fmt.Fprintln(out, "    esac")
+	fmt.Fprintln(out, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))")
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "complete -F _lord lord")
+}
+
+// zshDescribe renders name:description entries for _describe, colons in the name are escaped
+func zshDescribe(name string, description string) string {
+	return shellQuote(strings.ReplaceAll(name, ":", "\\:") + ":" + description)
+}
+
+func writeZshCompletion(out io.Writer) {
+	writeEntries := func(indent string, flags []completionFlag) {
+		for _, f := range flags {
+			fmt.Fprintf(out, "%s%s\n", indent, zshDescribe("--"+f.Name, f.Usage))
+		}
+	}
+
+	fmt.Fprintln(out, "#compdef lord")
+	fmt.Fprintln(out, "# zsh completion for lord, load it with: source <(lord completion zsh)")
+	fmt.Fprintln(out, "_lord() {")
+	fmt.Fprintln(out, "    local -a commands globals entries")
+	fmt.Fprintln(out, "    commands=(")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "        %s\n", zshDescribe(cmd.Name, cmd.Summary))
+	}
+	fmt.Fprintln(out, "    )")
+	fmt.Fprintln(out, "    globals=(")
+	writeEntries("        ", globalCompletionFlags())
+	fmt.Fprintln(out, "    )")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "    if [[ \"${words[CURRENT-1]}\" == \"--config\" || \"${words[CURRENT-1]}\" == \"-config\" ]]; then")
+	fmt.Fprintln(out, "        local -a keys")
+	fmt.Fprintln(out, "        keys=(${${(f)\"$(ls *.lord.yml *.lord.yaml 2>/dev/null)\"}%.lord.y*ml})")
+	fmt.Fprintln(out, "        compadd -a keys")
+	fmt.Fprintln(out, "        return")
+	fmt.Fprintln(out, "    fi")
+	fmt.Fprintln(out)
+	writeFindCommand(out, "words", "2", "CURRENT")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "    if [[ -z \"$cmd\" ]]; then")
+	fmt.Fprintln(out, "        if [[ \"${words[CURRENT]}\" == -* ]]; then")
+	fmt.Fprintln(out, "            _describe 'global flag' globals")
+	fmt.Fprintln(out, "        else")
+	fmt.Fprintln(out, "            _describe 'command' commands")
+	fmt.Fprintln(out, "        fi")
+	fmt.Fprintln(out, "        return")
+	fmt.Fprintln(out, "    fi")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "    case \"$cmd\" in")
+	for _, cmd := range commands {
+		flags := commandCompletionFlags(cmd)
+		choices := completionChoices(cmd)
+		if len(flags) == 0 && len(choices) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "        %s)\n", cmd.Name)
+		fmt.Fprintln(out, "            entries=(")
+		for _, choice := range choices {
+			fmt.Fprintf(out, "                %s\n", shellQuote(choice))
+		}
+		writeEntries("                ", flags)
+		fmt.Fprintln(out, "            )")
+		fmt.Fprintln(out, "            ;;")
+	}
+	fmt.Fprintln(out, "    esac")
+	fmt.Fprintln(out, "    _describe 'argument' entries -- globals")
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "compdef _lord lord")
+}
+
+// fishQuote quotes a string for fish, where only \ and ' are special inside single quotes
+func fishQuote(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	return "'" + strings.ReplaceAll(value, "'", "\\'") + "'"
+}
+
+func writeFishCompletion(out io.Writer) {
+	names := strings.Join(commandNames(), " ")
+
+	writeFlag := func(condition string, f completionFlag) {
+		line := "complete -c lord"
+		if condition != "" {
+			line += " -n " + fishQuote(condition)
+		}
+		line += " -l " + f.Name
+		if f.Value {
+			line += " -r"
+		}
+		if f.Name == "config" {
+			// config keys are the prefixes of <key>.lord.yml files, fish only allows globs without matches in a for loop
+			line += " -a " + fishQuote(`(for f in *.lord.yml *.lord.yaml; string replace -r "\.lord\.ya?ml\$" "" -- $f; end)`)
+		}
+		fmt.Fprintf(out, "%s -d %s\n", line, fishQuote(f.Usage))
+	}
+
+	fmt.Fprintln(out, "# fish completion for lord, load it with: lord completion fish | source")
+	fmt.Fprintln(out, "complete -c lord -f")
+	for _, f := range globalCompletionFlags() {
+		writeFlag("", f)
+	}
+
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "complete -c lord -n %s -a %s -d %s\n", fishQuote("not __fish_seen_subcommand_from "+names), cmd.Name, fishQuote(cmd.Summary))
+	}
+
+	for _, cmd := range commands {
+		condition := "__fish_seen_subcommand_from " + cmd.Name
+		for _, f := range commandCompletionFlags(cmd) {
+			writeFlag(condition, f)
+		}
+
+		choices := completionChoices(cmd)
+		if len(choices) > 0 {
+			fmt.Fprintf(out, "complete -c lord -n %s -a %s\n", fishQuote(condition), fishQuote(strings.Join(choices, " ")))
+		}
+	}
+}
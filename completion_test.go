@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var out bytes.Buffer
+		assert.NoError(t, writeCompletion(&out, shell))
+
+		for _, cmd := range commands {
+			assert.Contains(t, out.String(), cmd.Name, shell)
+		}
+		assert.Contains(t, out.String(), "since", shell)
+	}
+
+	assert.Error(t, writeCompletion(&bytes.Buffer{}, "powershell"))
+}
+
+func TestBashCompletionSyntax(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, writeCompletion(&out, "bash"))
+	assert.Contains(t, out.String(), "        logs) words=\"--since --tail --config --json --server --verbose\" ;;\n")
+	assert.Contains(t, out.String(), "        maintenance) words=\"on off --config --json --server --verbose\" ;;\n")
+
+	_, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	cmd := exec.Command("bash", "-n")
+	cmd.Stdin = &out
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+}
+
+func TestCompletionQuoting(t *testing.T) {
+	assert.Equal(t, `'it\'s a \\ test'`, fishQuote(`it's a \ test`))
+	assert.Equal(t, `'--yes:don'\''t ask'`, zshDescribe("--yes", "don't ask"))
+	assert.Equal(t, `'a\:b:c'`, zshDescribe("a:b", "c"))
+}
@@ -1,39 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-var baseConfig = `name: myapp
-server: 0.0.0.0
-
-# optional fields
-# email: user@example.com                # email for tls certificates
-# registry: my.realregistry.com/me       # container registry url (optional if using direct deployments)
-# authfile: ./config.json                # docker registry auth file (required if using fixed login/auth for registry)
-# platform: linux/amd64                  # build platform
-# target: production                     # docker build target stage
-# web: false                             # enable web service with traefik (defaults to false)
-# hostname: myapp.example.com            # domain name (required if web: true)
-# environmentfile: .env                  # environment variables file
-# buildargfile: build.args               # docker build arguments file
-# hostenvironmentfile: host.env          # host environment variables file (required if using a registry with dynamic login)
-# user: root                             # ssh login user
-# sshkeyfile: /path/to/private/key       # custom ssh private key file (uses system default if not specified)
-# volumes:                               # additional volume mounts
-#   - /host/data:/container/data
-#   - /etc/config:/app/config
-# webadvancedconfig:                     # advanced reverse proxy timeout and buffer settings (optional)
-#   maxrequestbodybytes: 1048576         # maximum allowed size in bytes of the request body
-#   maxresponsebodybytes: 1048576        # maximum allowed size in bytes of the response body
-#   memrequestbodybytes: 1048576         # threshold in bytes after which request body is buffered to disk
-#   # DANGER: the config settings below will modify the global reverse proxy settings for all containers on the server
-#   readtimeout: 60                      # maximum duration in seconds for reading the entire request
-#   writetimeout: 60                     # maximum duration in seconds before timing out writes of the response
-#   idletimeout: 180                     # maximum duration in seconds an idle connection is kept alive
-`
+// port web containers are expected to listen on when none is configured
+const defaultWebPort = 80
+
+// email used for tls certificate notifications when none is configured
+const defaultEmail = "admin@localhost.com"
+
+// traefik version used on hosts without a running proxy when proxy.version isn't set
+const defaultTraefikVersion = "v3.3"
 
 type WebAdvancedConfig struct {
 	// maximum duration in seconds for reading the entire request (optional)
@@ -55,6 +37,88 @@ type WebAdvancedConfig struct {
 	MemRequestBodyBytes int
 }
 
+type ProxyConfig struct {
+	// pinned traefik image version, defaults to the version running on the host or v3.3 on new hosts (optional)
+	Version string
+
+	// email for the host's tls certificate resolver, replaces the email kept from the first app set up on the host (optional)
+	Email string
+
+	// enable the traefik api/dashboard bound to localhost on the host (optional)
+	Dashboard bool
+
+	// enable json access logs written to /var/log/traefik/access.log on the host (optional)
+	AccessLog bool
+}
+
+type MaintenanceConfig struct {
+	// html file served while the app is in maintenance mode, a generic page is used if not set (optional)
+	Page string
+
+	// seconds sent in the Retry-After header of maintenance responses, defaults to 3600 (optional)
+	RetryAfter int
+
+	// client ips or cidr ranges that still reach the real app while in maintenance mode (optional)
+	AllowIps []string
+}
+
+type BuildConfig struct {
+	// build the image on the server instead of locally, using the host's native architecture (optional)
+	Remote bool
+
+	// path to the dockerfile, defaults to Dockerfile in the build context (optional)
+	Dockerfile string
+
+	// build context directory, defaults to the project root (optional)
+	Context string
+
+	// buildx cache sources, i.e. type=registry,ref=... or type=local,src=.buildcache (optional)
+	CacheFrom []string
+
+	// buildx cache exports, i.e. type=registry,ref=...,mode=max or type=local,dest=.buildcache (optional)
+	CacheTo []string
+
+	// buildkit secrets mounted during the build as id=path or the full buildkit form (optional)
+	Secrets []string
+
+	// ssh agent sockets or keys forwarded to the build, i.e. default (optional)
+	Ssh []string
+
+	// additional tags applied to the image, pushed along with the deploy tag when using a registry (optional)
+	Tags []string
+
+	// additional image labels as key=value (optional)
+	Labels []string
+
+	// build without using the layer cache (optional)
+	NoCache bool
+
+	// buildx builder instance to build with, required for some cache exports (optional)
+	Builder string
+}
+
+type PruneConfig struct {
+	// number of most recent images kept per app on the host and in the registry, defaults to 3 (optional)
+	Keep int
+
+	// prune old images on the host after every successful deploy (optional)
+	AfterDeploy bool
+}
+
+type RegistryHostConfig struct {
+	// public hostname the registry is served on (required for lord registry --host)
+	Hostname string
+
+	// username for registry access, defaults to lord (optional)
+	Username string
+}
+
+type SecretsConfig struct {
+	// file holding the base64 key for encrypted env files, defaults to .lord.key. the LORD_SECRETS_KEY
+	// environment variable takes precedence (optional)
+	KeyFile string
+}
+
 type Config struct {
 	// name of the application/container, must be unique per remote host (required)
 	Name string
@@ -74,7 +138,12 @@ type Config struct {
 	// ip address of remote host server. the deployment machine must have ssh access (required)
 	Server string
 
-	// platform to build containers for, must match remote host. defaults to linux/amd64 (optional)
+	// prebuilt image reference to deploy instead of building the local Dockerfile. pulled on the host when using a
+	// registry, saved from the local docker daemon for direct deployments (optional)
+	Image string
+
+	// platform to build containers for, must match remote host. defaults to linux/amd64. a comma separated list
+	// builds a multi-platform image, which needs a registry (optional)
 	Platform string
 
 	// any additional volumes to mount on the remote host, follows docker convention (optional)
@@ -83,9 +152,12 @@ type Config struct {
 	// hostname to use for web applications and tls certs (optional, required if web is true)
 	Hostname string
 
-	// whether or not the application is a web service. if true, must expose port 80 from the docker container and specify a hostname
+	// whether or not the application is a web service. if true, must specify a hostname
 	Web bool
 
+	// port the container serves web traffic on, between 1 and 65535. defaults to 80 (optional)
+	Port int
+
 	// environment variable file (optional)
 	EnvironmentFile string
 
@@ -101,24 +173,81 @@ type Config struct {
 	// host environment file containing variables to source on the remote host (optional)
 	HostEnvironmentFile string
 
+	// .env style file with variables for ${VAR} references in the config, the local environment takes precedence (optional)
+	VarsFile string
+
 	// advanced web configuration for traefik timeouts and buffer settings (optional)
 	WebAdvancedConfig WebAdvancedConfig
+
+	// reverse proxy settings for the host (optional)
+	Proxy ProxyConfig
+
+	// maintenance mode settings for web apps (optional)
+	Maintenance MaintenanceConfig
+
+	// container build settings (optional)
+	Build BuildConfig
+
+	// image retention settings for the host and registry (optional)
+	Prune PruneConfig
+
+	// settings for a lord hosted registry deployed with lord registry --host (optional)
+	RegistryHost RegistryHostConfig
+
+	// encrypted env file settings used by lord secrets and deploys (optional)
+	Secrets SecretsConfig
+
+	// registry credentials resolved at runtime for lord:// registries, never read from the config file
+	registryUsername string
+	registryPassword string
 }
 
-func loadConfig(configKey string) (*Config, error) {
+// loadConfig reads lord.yml, or <configKey>.lord.yml. a non empty server replaces the server in the config
+// (--server).
+func loadConfig(configKey string, server string) (*Config, error) {
 	configName := "lord"
 	if configKey != "" {
 		configName = fmt.Sprintf("%s.lord", configKey)
 	}
 
-	viper.SetConfigName(configName)
+	configFile, err := findConfigFile(configName)
+	if err != nil {
+		return nil, err
+	}
+
+	// overlays are merged onto the config they extend before viper reads the result
+	sources := configSources{}
+	root, err := loadConfigTree(configFile, sources, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	// ${VAR} references are expanded before validation so the expanded values are what get checked
+	err = interpolateConfigTree(configFile, root, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	// applied after interpolation so the address is taken as given
+	if server != "" {
+		root = mergeConfigNodes(root, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "server"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: server},
+		}})
+	}
+
+	merged, err := marshalConfigTree(root)
+	if err != nil {
+		return nil, err
+	}
+
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
 
 	viper.SetDefault("target", "")
 	viper.SetDefault("platform", "linux/amd64")
 	viper.SetDefault("web", false)
-	viper.SetDefault("email", "admin@localhost.com")
+	viper.SetDefault("port", defaultWebPort)
+	viper.SetDefault("email", defaultEmail)
 	viper.SetDefault("user", "root")
 
 	// set defaults for webadvancedconfig to -1 to indicate unset
@@ -129,7 +258,30 @@ func loadConfig(configKey string) (*Config, error) {
 	viper.SetDefault("webadvancedconfig.maxresponsebodybytes", -1)
 	viper.SetDefault("webadvancedconfig.memrequestbodybytes", -1)
 
-	err := viper.ReadInConfig()
+	viper.SetDefault("proxy.version", "")
+	viper.SetDefault("proxy.email", "")
+	viper.SetDefault("proxy.dashboard", false)
+	viper.SetDefault("proxy.accesslog", false)
+
+	viper.SetDefault("maintenance.retryafter", 3600)
+
+	viper.SetDefault("build.remote", false)
+	viper.SetDefault("build.nocache", false)
+
+	viper.SetDefault("prune.keep", 3)
+	viper.SetDefault("prune.afterdeploy", false)
+
+	viper.SetDefault("registryhost.username", "lord")
+
+	viper.SetDefault("secrets.keyfile", ".lord.key")
+
+	err = viper.ReadConfig(bytes.NewReader(merged))
+	if err != nil {
+		return nil, err
+	}
+
+	// validate before anything connects to a server so mistakes surface with their position in the file
+	positions, err := validateConfigSchema(configFile, root, sources)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +292,11 @@ func loadConfig(configKey string) (*Config, error) {
 		return nil, err
 	}
 
+	err = validateConfigValues(configFile, &c, positions)
+	if err != nil {
+		return nil, err
+	}
+
 	fmt.Println("config loaded")
 
 	return &c, nil
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// key an overlay config uses to name the config it builds on
+const extendsKey = "extends"
+
+// tag on a list in an overlay that replaces the base list instead of appending to it
+const replaceTag = "!replace"
+
+// configSources records which file each yaml node was read from, so issues in merged configs point at the
+// file that set the value
+type configSources map[*yaml.Node]string
+
+func (cs configSources) record(node *yaml.Node, file string) {
+	if node == nil {
+		return
+	}
+	cs[node] = file
+	for _, child := range node.Content {
+		cs.record(child, file)
+	}
+}
+
+// findConfigFile returns the config file for a name, accepting both yaml extensions
+func findConfigFile(configName string) (string, error) {
+	for _, ext := range []string{"yml", "yaml"} {
+		path := fmt.Sprintf("%s.%s", configName, ext)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("config file %s.yml not found in the current directory", configName)
+}
+
+func mappingValue(node *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return i, node.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+func sameScalar(a *yaml.Node, b *yaml.Node) bool {
+	return a.Kind == yaml.ScalarNode && b.Kind == yaml.ScalarNode && a.Value == b.Value
+}
+
+// mergeConfigNodes deep merges an overlay onto a base config. mappings are merged key by key, lists are
+// appended to (skipping values already present) unless tagged !replace, anything else is replaced.
+func mergeConfigNodes(base *yaml.Node, overlay *yaml.Node) *yaml.Node {
+	base = resolveAlias(base)
+	overlay = resolveAlias(overlay)
+
+	if base.Kind == yaml.MappingNode && overlay.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(overlay.Content); i += 2 {
+			key := overlay.Content[i]
+			value := overlay.Content[i+1]
+
+			index, existing := mappingValue(base, key.Value)
+			if existing == nil {
+				base.Content = append(base.Content, key, value)
+				continue
+			}
+
+			base.Content[index] = key
+			base.Content[index+1] = mergeConfigNodes(existing, value)
+		}
+		return base
+	}
+
+	if base.Kind == yaml.SequenceNode && overlay.Kind == yaml.SequenceNode {
+		if overlay.Tag == replaceTag {
+			return overlay
+		}
+
+		for _, item := range overlay.Content {
+			present := false
+			for _, existing := range base.Content {
+				if sameScalar(existing, item) {
+					present = true
+				}
+			}
+			if !present {
+				base.Content = append(base.Content, item)
+			}
+		}
+		return base
+	}
+
+	return overlay
+}
+
+// clearReplaceTags drops the !replace tags once merged so they aren't passed on to the config decoder
+func clearReplaceTags(node *yaml.Node) {
+	if node.Tag == replaceTag {
+		node.Tag = ""
+	}
+	for _, child := range node.Content {
+		clearReplaceTags(child)
+	}
+}
+
+// loadConfigTree reads a config file and, when it extends another config, merges it onto its base.
+// extends paths are relative to the file declaring them.
+func loadConfigTree(path string, sources configSources, chain []string) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seen := range chain {
+		if seen == absPath {
+			names := []string{}
+			for _, file := range append(chain, absPath) {
+				names = append(names, filepath.Base(file))
+			}
+			return nil, fmt.Errorf("extends cycle: %s", strings.Join(names, " -> "))
+		}
+	}
+	chain = append(chain, absPath)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	err = yaml.Unmarshal(content, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+
+	if len(root.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+
+	doc := root.Content[0]
+	sources.record(doc, path)
+
+	if doc.Kind != yaml.MappingNode {
+		return doc, nil
+	}
+
+	index, extends := mappingValue(doc, extendsKey)
+	if extends == nil {
+		clearReplaceTags(doc)
+		return doc, nil
+	}
+
+	if extends.Kind != yaml.ScalarNode || extends.Value == "" {
+		return nil, fmt.Errorf("%s:%d:%d: extends must be the path of the base config file", filepath.Base(path), extends.Line, extends.Column)
+	}
+
+	basePath := extends.Value
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(path), basePath)
+	}
+
+	base, err := loadConfigTree(basePath, sources, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	// the extends key itself is not part of the effective config
+	doc.Content = append(doc.Content[:index], doc.Content[index+2:]...)
+
+	merged := mergeConfigNodes(base, doc)
+	clearReplaceTags(merged)
+
+	return merged, nil
+}
+
+// marshalConfigTree renders a merged config tree so it can be read by viper
+func marshalConfigTree(node *yaml.Node) ([]byte, error) {
+	return yaml.Marshal(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}})
+}
+
+// showConfig prints the effective config after overlays and defaults are applied
+func showConfig(c *Config) error {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Print(string(out))
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func parseTestNode(t *testing.T, content string) *yaml.Node {
+	var root yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(content), &root))
+	return root.Content[0]
+}
+
+func renderTestNode(t *testing.T, node *yaml.Node) string {
+	out, err := marshalConfigTree(node)
+	assert.NoError(t, err)
+	return string(out)
+}
+
+func TestMergeConfigNodes(t *testing.T) {
+	base := parseTestNode(t, `name: myapp
+server: 10.0.0.5
+volumes:
+  - /data:/data
+build:
+  labels:
+    - team=web
+  nocache: false
+`)
+	overlay := parseTestNode(t, `Server: 10.0.0.6
+volumes:
+  - /data:/data
+  - /cache:/cache
+build:
+  nocache: true
+`)
+
+	merged := mergeConfigNodes(base, overlay)
+	assert.Equal(t, `name: myapp
+Server: 10.0.0.6
+volumes:
+    - /data:/data
+    - /cache:/cache
+build:
+    labels:
+        - team=web
+    nocache: true
+`, renderTestNode(t, merged))
+}
+
+func TestMergeConfigNodesReplace(t *testing.T) {
+	base := parseTestNode(t, `volumes:
+  - /data:/data
+  - /cache:/cache
+`)
+	overlay := parseTestNode(t, `volumes: !replace
+  - /beta:/data
+`)
+
+	merged := mergeConfigNodes(base, overlay)
+	clearReplaceTags(merged)
+	assert.Equal(t, `volumes:
+    - /beta:/data
+`, renderTestNode(t, merged))
+}
+
+func TestLoadConfigTreeExtends(t *testing.T) {
+	dir := chdirTemp(t)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "envs"), 0755))
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("name: myapp\nserver: 10.0.0.5\nweb: true\nhostname: myapp.com\n"), 0644))
+	assert.NoError(t, os.WriteFile("envs/staging.yml", []byte("extends: ../lord.yml\nhostname: staging.myapp.com\n"), 0644))
+	assert.NoError(t, os.WriteFile("beta.lord.yml", []byte("extends: envs/staging.yml\nname: myapp-beta\nserver: 10.0.0.6\n"), 0644))
+
+	sources := configSources{}
+	root, err := loadConfigTree("beta.lord.yml", sources, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, `name: myapp-beta
+server: 10.0.0.6
+web: true
+hostname: staging.myapp.com
+`, renderTestNode(t, root))
+
+	// keys report the file that set them
+	_, web := mappingValue(root, "web")
+	assert.Equal(t, "lord.yml", sources[web])
+	_, hostname := mappingValue(root, "hostname")
+	assert.Equal(t, filepath.Join("envs", "staging.yml"), sources[hostname])
+}
+
+func TestLoadConfigTreeCycle(t *testing.T) {
+	chdirTemp(t)
+
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("extends: beta.lord.yml\nname: myapp\n"), 0644))
+	assert.NoError(t, os.WriteFile("beta.lord.yml", []byte("extends: lord.yml\n"), 0644))
+
+	_, err := loadConfigTree("lord.yml", configSources{}, []string{})
+	assert.EqualError(t, err, "extends cycle: lord.yml -> beta.lord.yml -> lord.yml")
+}
+
+func TestValidateConfigSchemaOverlayFile(t *testing.T) {
+	chdirTemp(t)
+
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("name: myapp\nserver: 10.0.0.5\nweb: maybe\n"), 0644))
+	assert.NoError(t, os.WriteFile("beta.lord.yml", []byte("extends: lord.yml\nservr: 10.0.0.6\n"), 0644))
+
+	_, err := loadTestConfigSchema("beta.lord.yml")
+	assert.EqualError(t, err, `lord.yml:3:6: web must be true or false, got a string
+beta.lord.yml:2:1: unknown key "servr", did you mean "server"?`)
+}
+
+func TestLoadConfigTreeReplace(t *testing.T) {
+	chdirTemp(t)
+
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("volumes:\n  - /data:/data\n"), 0644))
+	assert.NoError(t, os.WriteFile("beta.lord.yml", []byte("extends: lord.yml\nvolumes: !replace\n  - /beta:/data\nbuild:\n  tags: !replace\n    - beta\n"), 0644))
+
+	root, err := loadConfigTree("beta.lord.yml", configSources{}, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, `volumes:
+    - /beta:/data
+build:
+    tags:
+        - beta
+`, renderTestNode(t, root))
+}
+
+func TestLoadConfigServerOverride(t *testing.T) {
+	writeTestConfig(t, "name: myapp\n")
+
+	// the server is required, --server can provide it
+	_, err := loadConfig("", "")
+	assert.Error(t, err)
+
+	c, err := loadConfig("", "10.0.0.9")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.9", c.Server)
+
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("name: myapp\nserver: 10.0.0.5\n"), 0644))
+	c, err = loadConfig("", "10.0.0.9")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.9", c.Server)
+}
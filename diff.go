@@ -27,14 +27,14 @@ func (r *remote) diffLocalAndRemote(name string) error {
 		}
 
 		// check if container is running
-		_, _, err := runSSHCommand(client, fmt.Sprintf("sudo docker inspect %s", name), "")
+		_, _, err := runSSHCommand(client, shellCommand("sudo", "docker", "inspect", name), "")
 		if err != nil {
 			return fmt.Errorf("container %s is not running or doesn't exist", name)
 		}
 
 		// get the working directory of the container
 		workdir, _, err := runSSHCommand(client,
-			fmt.Sprintf("sudo docker inspect -f '{{.Config.WorkingDir}}' %s", name), "")
+			shellCommand("sudo", "docker", "inspect", "-f", "{{.Config.WorkingDir}}", name), "")
 		if err != nil {
 			return fmt.Errorf("failed to get container working directory: %v", err)
 		}
@@ -145,28 +145,6 @@ func (r *remote) diffLocalAndRemote(name string) error {
 	})
 }
 
-// loadDockerIgnorePatterns reads .dockerignore and returns patterns
-func loadDockerIgnorePatterns() []string {
-	patterns := []string{}
-
-	content, err := os.ReadFile(".dockerignore")
-	if err != nil {
-		return patterns // file doesn't exist, return empty
-	}
-
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		// skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		patterns = append(patterns, line)
-	}
-
-	return patterns
-}
-
 // parseDockerfileCopyPatterns extracts COPY/ADD source patterns from Dockerfile
 func parseDockerfileCopyPatterns() []string {
 	patterns := []string{}
@@ -311,14 +289,8 @@ func shouldSkipFile(path string, dockerignorePatterns []string) bool {
 		}
 	}
 
-	// check dockerignore patterns
-	for _, pattern := range dockerignorePatterns {
-		if matchesPattern(path, pattern) {
-			return true
-		}
-	}
-
-	return false
+	// dockerignore patterns are matched the same way the remote build context is packaged
+	return matchesDockerIgnore(path, dockerignorePatterns)
 }
 
 // matchesPattern checks if a path matches a dockerignore-style pattern
@@ -361,7 +333,7 @@ func matchesPattern(path, pattern string) bool {
 // getContainerFiles lists all files in the container's working directory
 func getContainerFiles(client *ssh.Client, containerName, workdir string, files map[string]string, ignorePatterns []string) error {
 	// use find to list all files in the container
-	cmd := fmt.Sprintf("sudo docker exec %s find %s -type f 2>/dev/null || true", containerName, workdir)
+	cmd := shellCommand("sudo", "docker", "exec", containerName, "find", workdir, "-type", "f") + " 2>/dev/null || true"
 	output, _, err := runSSHCommandSilent(client, cmd, "")
 	if err != nil {
 		return err
@@ -396,7 +368,7 @@ func compareLocalWithContainer(client *ssh.Client, containerName, localPath, con
 	}
 
 	// read file from container using docker exec
-	cmd := fmt.Sprintf("sudo docker exec %s cat %s 2>/dev/null", containerName, containerPath)
+	cmd := shellCommand("sudo", "docker", "exec", containerName, "cat", containerPath) + " 2>/dev/null"
 	containerContent, _, err := runSSHCommandSilent(client, cmd, "")
 	if err != nil {
 		return false, fmt.Errorf("failed to read container file: %v", err)
@@ -415,7 +387,7 @@ func showContainerFileDiff(client *ssh.Client, containerName, localPath, contain
 	}
 
 	// read file from container
-	cmd := fmt.Sprintf("sudo docker exec %s cat %s 2>/dev/null", containerName, containerPath)
+	cmd := shellCommand("sudo", "docker", "exec", containerName, "cat", containerPath) + " 2>/dev/null"
 	containerContent, _, err := runSSHCommandSilent(client, cmd, "")
 	if err != nil {
 		return fmt.Errorf("failed to read container file: %v", err)
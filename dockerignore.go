@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadDockerIgnorePatterns reads .dockerignore and returns patterns
+func loadDockerIgnorePatterns() []string {
+	return loadDockerIgnorePatternsFrom(".")
+}
+
+// loadDockerIgnorePatternsFrom reads the .dockerignore in a build context directory
+func loadDockerIgnorePatternsFrom(dir string) []string {
+	patterns := []string{}
+
+	content, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return patterns // file doesn't exist, return empty
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		// skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns
+}
+
+// matchesDockerIgnore applies .dockerignore patterns the way docker does: patterns match the path or any of
+// its parent directories, "**" matches any number of directories and the last matching pattern wins, so a
+// later "!" pattern re-includes a path.
+func matchesDockerIgnore(path string, patterns []string) bool {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+
+	ignored := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(strings.TrimSpace(pattern))), "/")
+
+		if pattern == "" || pattern == "." {
+			continue
+		}
+
+		if matchesDockerIgnorePattern(path, pattern) {
+			ignored = !negate
+		}
+	}
+
+	return ignored
+}
+
+func matchesDockerIgnorePattern(path string, pattern string) bool {
+	pathParts := strings.Split(path, "/")
+
+	// a pattern matching a directory also matches everything inside it
+	for i := 1; i <= len(pathParts); i++ {
+		if matchGlobParts(strings.Split(pattern, "/"), pathParts[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlobParts matches path segments against pattern segments where a "**" segment matches zero or more
+// path segments
+func matchGlobParts(patternParts []string, pathParts []string) bool {
+	if len(patternParts) == 0 {
+		return len(pathParts) == 0
+	}
+
+	if patternParts[0] == "**" {
+		for i := 0; i <= len(pathParts); i++ {
+			if matchGlobParts(patternParts[1:], pathParts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathParts) == 0 {
+		return false
+	}
+
+	matched, err := filepath.Match(patternParts[0], pathParts[0])
+	if err != nil || !matched {
+		return false
+	}
+
+	return matchGlobParts(patternParts[1:], pathParts[1:])
+}
+
+func hasNegatedPattern(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			return true
+		}
+	}
+	return false
+}
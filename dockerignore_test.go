@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesDockerIgnore(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		expected bool
+	}{
+		{"node_modules", []string{"node_modules"}, true},
+		{"node_modules/react/index.js", []string{"node_modules"}, true},
+		{"web/node_modules/react/index.js", []string{"node_modules"}, false},
+		{"web/node_modules/react/index.js", []string{"**/node_modules"}, true},
+		{".github/workflows/ci.yml", []string{".git"}, false},
+		{".git/config", []string{".git"}, true},
+		{"debug.log", []string{"*.log"}, true},
+		{"logs/debug.log", []string{"*.log"}, false},
+		{"logs/debug.log", []string{"**/*.log"}, true},
+		{"docs/keep.md", []string{"docs", "!docs/keep.md"}, false},
+		{"docs/other.md", []string{"docs", "!docs/keep.md"}, true},
+		{"secret.env", []string{"/secret.env"}, true},
+		{"main.go", []string{}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, matchesDockerIgnore(tt.path, tt.patterns), "%s %v", tt.path, tt.patterns)
+	}
+}
+
+func TestShouldSkipFileUsesDockerIgnore(t *testing.T) {
+	// lord diff skips the same files the remote build leaves out of the context
+	patterns := []string{"docs", "!docs/keep.md", "*.tmp"}
+	for _, path := range []string{"docs/keep.md", "docs/other.md", "cache.tmp", "src/cache.tmp", "main.go"} {
+		assert.Equal(t, matchesDockerIgnore(path, patterns), shouldSkipFile(path, patterns), path)
+	}
+}
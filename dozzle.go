@@ -30,7 +30,7 @@ func startDozzleUI(server string, config *Config) error {
 	defer cancel()
 
 	go func() {
-		err := createSSHTunnel(ctx, client, localPort, remoteSocket)
+		err := createSSHTunnel(ctx, client, localPort, "unix", remoteSocket)
 		if err != nil {
 			fmt.Printf("ssh tunnel error: %v\n", err)
 		}
@@ -41,13 +41,12 @@ func startDozzleUI(server string, config *Config) error {
 
 	// cleanup any existing dozzle container
 	fmt.Println("cleaning up existing dozzle container")
-	_, _, _ = runLocalCommand("docker stop dozzle")
-	_, _, _ = runLocalCommand("docker rm dozzle")
+	_, _, _ = runLocalCommandSilent("docker", "stop", "dozzle")
+	_, _, _ = runLocalCommandSilent("docker", "rm", "dozzle")
 
 	// start dozzle container
 	fmt.Println("starting dozzle container")
-	dozzleCmd := fmt.Sprintf("docker run -d --name dozzle -p 8888:8080 -e DOCKER_HOST=tcp://host.docker.internal:%d amir20/dozzle:latest", localPort)
-	_, _, err = runLocalCommand(dozzleCmd)
+	_, _, err = runLocalCommand("docker", "run", "-d", "--name", "dozzle", "-p", "8888:8080", "-e", fmt.Sprintf("DOCKER_HOST=tcp://host.docker.internal:%d", localPort), "amir20/dozzle:latest")
 	if err != nil {
 		return fmt.Errorf("failed to start dozzle container: %v", err)
 	}
@@ -70,7 +69,9 @@ func startDozzleUI(server string, config *Config) error {
 	select {}
 }
 
-func createSSHTunnel(ctx context.Context, client *ssh.Client, localPort int, remoteSocket string) error {
+// createSSHTunnel forwards connections on a local port to a remote address dialed through the ssh client.
+// network is "unix" for sockets or "tcp" for host:port addresses.
+func createSSHTunnel(ctx context.Context, client *ssh.Client, localPort int, remoteNetwork string, remoteAddress string) error {
 	// listen on local port
 	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", localPort))
 	if err != nil {
@@ -95,10 +96,10 @@ func createSSHTunnel(ctx context.Context, client *ssh.Client, localPort int, rem
 		go func() {
 			defer conn.Close()
 
-			// connect to remote docker socket
-			remoteConn, err := client.Dial("unix", remoteSocket)
+			// connect to remote address
+			remoteConn, err := client.Dial(remoteNetwork, remoteAddress)
 			if err != nil {
-				fmt.Printf("failed to connect to remote socket: %v\n", err)
+				fmt.Printf("failed to connect to remote %s: %v\n", remoteAddress, err)
 				return
 			}
 			defer remoteConn.Close()
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// label keys stamped onto deployed containers, except the created label which is set on the image at build time
+const (
+	ociRevisionLabel = "org.opencontainers.image.revision"
+	ociSourceLabel   = "org.opencontainers.image.source"
+	ociCreatedLabel  = "org.opencontainers.image.created"
+	lordBranchLabel  = "lord.branch"
+	lordDeployer     = "lord.deployer"
+	lordDeployedAt   = "lord.deployed"
+)
+
+// GitState is the state of the local git checkout being deployed
+type GitState struct {
+	Commit string
+	Branch string
+	Dirty  bool
+	Source string
+}
+
+func (g *GitState) ShortCommit() string {
+	if len(g.Commit) > 12 {
+		return g.Commit[:12]
+	}
+	return g.Commit
+}
+
+// ImageTag is the tag used for images built from this state, dirty trees get a suffix so they are never
+// mistaken for the committed revision
+func (g *GitState) ImageTag() string {
+	if g.Dirty {
+		return fmt.Sprintf("%s-dirty", g.ShortCommit())
+	}
+	return g.ShortCommit()
+}
+
+var scpLikeGitUrl = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// normalizeGitSource turns a git remote into a browsable https url and strips any embedded credentials
+func normalizeGitSource(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return ""
+	}
+
+	if match := scpLikeGitUrl.FindStringSubmatch(remote); match != nil {
+		remote = fmt.Sprintf("https://%s/%s", match[1], match[2])
+	}
+
+	parsed, err := url.Parse(remote)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+
+	parsed.User = nil
+	if parsed.Scheme == "ssh" || parsed.Scheme == "git" {
+		parsed.Scheme = "https"
+		parsed.Host = parsed.Hostname()
+	}
+
+	return strings.TrimSuffix(parsed.String(), ".git")
+}
+
+// gitStatusArgs lists changes anywhere in the checkout except the ignored local paths, such as the secrets key
+func gitStatusArgs(ignored []string) []string {
+	args := []string{"status", "--porcelain", "--", ":/"}
+	for _, path := range ignored {
+		if path != "" && filepath.IsLocal(path) {
+			args = append(args, fmt.Sprintf(":(exclude)%s", filepath.ToSlash(path)))
+		}
+	}
+	return args
+}
+
+// readGitState returns the git state of the current directory, or nil when it isn't a git checkout. changes
+// to the ignored paths don't make the tree dirty.
+func readGitState(ignored ...string) (*GitState, error) {
+	commit, _, err := runLocalCommandSilent("git", "rev-parse", "HEAD")
+	if err != nil {
+		return nil, nil
+	}
+
+	branch, _, err := runLocalCommandSilent("git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git branch: %v", err)
+	}
+
+	status, _, err := runLocalCommandSilent("git", gitStatusArgs(ignored)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git status: %v", err)
+	}
+
+	// a missing remote isn't an error, the source label is just left out
+	remote, _, _ := runLocalCommandSilent("git", "config", "--get", "remote.origin.url")
+
+	return &GitState{
+		Commit: strings.TrimSpace(commit),
+		Branch: strings.TrimSpace(branch),
+		Dirty:  strings.TrimSpace(status) != "",
+		Source: normalizeGitSource(remote),
+	}, nil
+}
+
+// ignoreInGit keeps a local file out of version control. a tracked file is refused, an untracked one is added
+// to the .gitignore of the current directory unless git already ignores it. outside a git checkout, or for
+// paths outside the current directory, nothing is done.
+func ignoreInGit(path string) error {
+	_, _, err := runLocalCommandSilent("git", "rev-parse", "--is-inside-work-tree")
+	if err != nil || !filepath.IsLocal(path) {
+		return nil
+	}
+
+	_, _, err = runLocalCommandSilent("git", "ls-files", "--error-unmatch", "--", path)
+	if err == nil {
+		return fmt.Errorf("%s is tracked by git, remove it with git rm --cached %s and add it to .gitignore", path, path)
+	}
+
+	_, _, err = runLocalCommandSilent("git", "check-ignore", "-q", "--", path)
+	if err == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(".gitignore")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .gitignore: %v", err)
+	}
+
+	entry := fmt.Sprintf("/%s\n", filepath.ToSlash(path))
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		entry = "\n" + entry
+	}
+
+	file, err := os.OpenFile(".gitignore", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to update .gitignore: %v", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(entry)
+	if err != nil {
+		return fmt.Errorf("failed to update .gitignore: %v", err)
+	}
+
+	fmt.Printf("added %s to .gitignore\n", path)
+
+	return nil
+}
+
+// localDeployer identifies who ran the deploy, preferring the git identity
+func localDeployer() string {
+	name, _, err := runLocalCommandSilent("git", "config", "--get", "user.name")
+	if err == nil && strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name)
+	}
+
+	current, err := user.Current()
+	if err == nil {
+		return current.Username
+	}
+
+	return "unknown"
+}
+
+// deployLabels returns the provenance labels stamped onto the deployed container
+func deployLabels(git *GitState, deployer string, now time.Time) []string {
+	timestamp := now.UTC().Format(time.RFC3339)
+
+	labels := []string{
+		fmt.Sprintf("%s=%s", lordDeployer, deployer),
+		fmt.Sprintf("%s=%s", lordDeployedAt, timestamp),
+	}
+
+	if git != nil {
+		revision := git.Commit
+		if git.Dirty {
+			revision += "-dirty"
+		}
+
+		labels = append(labels,
+			fmt.Sprintf("%s=%s", ociRevisionLabel, revision),
+			fmt.Sprintf("%s=%s", lordBranchLabel, git.Branch),
+		)
+
+		if git.Source != "" {
+			labels = append(labels, fmt.Sprintf("%s=%s", ociSourceLabel, git.Source))
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// dockerfile locations lord init looks at, in order
+var dockerfileCandidates = []string{"Dockerfile", "docker/Dockerfile", "build/Dockerfile"}
+
+var exposePattern = regexp.MustCompile(`(?i)^\s*EXPOSE\s+(.+)$`)
+
+var invalidAppNameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// ProjectInfo is what lord init detects about the project in the current directory
+type ProjectInfo struct {
+	Name string
+
+	// dockerfile path relative to the project root, empty when none was found
+	Dockerfile   string
+	ExposedPorts []int
+
+	EnvironmentFiles []string
+}
+
+// InitAnswers are the values lord init writes to lord.yml, detected or answered by the user
+type InitAnswers struct {
+	Name            string
+	Server          string
+	User            string
+	Web             bool
+	Hostname        string
+	Port            int
+	Email           string
+	Registry        string
+	EnvironmentFile string
+	Dockerfile      string
+}
+
+// parseExposedPorts returns the ports of every EXPOSE instruction, i.e. EXPOSE 80 443/tcp. ports set from
+// build args can't be resolved and are skipped.
+func parseExposedPorts(dockerfile string) []int {
+	ports := []int{}
+
+	for _, line := range strings.Split(dockerfile, "\n") {
+		match := exposePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		for _, field := range strings.Fields(match[1]) {
+			port, err := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+			if err == nil && port > 0 && port <= 65535 {
+				ports = append(ports, port)
+			}
+		}
+	}
+
+	return ports
+}
+
+// appNameFromDir suggests an app name from the project directory name
+func appNameFromDir(dir string) string {
+	name := invalidAppNameChars.ReplaceAllString(strings.ToLower(filepath.Base(dir)), "-")
+	name = strings.Trim(name, "_.-")
+	if name == "" {
+		return "myapp"
+	}
+	return name
+}
+
+// isEnvironmentFileName matches .env, .env.production and prod.env style names, skipping examples
+func isEnvironmentFileName(name string) bool {
+	if name != ".env" && !strings.HasPrefix(name, ".env.") && !strings.HasSuffix(name, ".env") {
+		return false
+	}
+
+	for _, skip := range []string{"example", "sample", "template", "host.env"} {
+		if strings.Contains(name, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// detectProject inspects a project directory for its dockerfile, the ports it exposes and env files
+func detectProject(dir string) (ProjectInfo, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ProjectInfo{}, err
+	}
+
+	info := ProjectInfo{Name: appNameFromDir(abs), ExposedPorts: []int{}, EnvironmentFiles: []string{}}
+
+	for _, candidate := range dockerfileCandidates {
+		content, err := os.ReadFile(filepath.Join(dir, candidate))
+		if err == nil {
+			info.Dockerfile = candidate
+			info.ExposedPorts = parseExposedPorts(string(content))
+			break
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return info, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && isEnvironmentFileName(entry.Name()) {
+			info.EnvironmentFiles = append(info.EnvironmentFiles, entry.Name())
+		}
+	}
+
+	return info, nil
+}
+
+// defaultInitAnswers fills in everything that could be detected. an exposed port suggests a web app.
+func defaultInitAnswers(info ProjectInfo) InitAnswers {
+	answers := InitAnswers{Name: info.Name, User: "root", Port: defaultWebPort, Dockerfile: info.Dockerfile}
+
+	if len(info.ExposedPorts) > 0 {
+		answers.Web = true
+		answers.Port = info.ExposedPorts[0]
+	}
+
+	if len(info.EnvironmentFiles) > 0 {
+		answers.EnvironmentFile = info.EnvironmentFiles[0]
+	}
+
+	return answers
+}
+
+func validateAppName(name string) error {
+	if !appNamePattern.MatchString(name) {
+		return fmt.Errorf("name %q must start with a letter or number and only contain letters, numbers, _, . or -", name)
+	}
+	return nil
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("port %q must be a number between 1 and 65535", value)
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if email != "" && !strings.Contains(email, "@") {
+		return fmt.Errorf("email %q is not a valid email address", email)
+	}
+	return nil
+}
+
+func requireAnswer(value string) error {
+	if value == "" {
+		return fmt.Errorf("a value is required")
+	}
+	return nil
+}
+
+// validateInitAnswers checks answers given as arguments, interactive answers are checked as they are given
+func validateInitAnswers(answers InitAnswers) error {
+	err := validateAppName(answers.Name)
+	if err != nil {
+		return err
+	}
+
+	if answers.Server == "" {
+		return fmt.Errorf("server is required")
+	}
+
+	if answers.Web && answers.Hostname == "" {
+		return fmt.Errorf("hostname is required when web is true")
+	}
+
+	err = validatePort(strconv.Itoa(answers.Port))
+	if err != nil {
+		return err
+	}
+
+	return validateEmail(answers.Email)
+}
+
+// setInitAnswer applies a key=value argument given to lord init --yes
+func setInitAnswer(answers *InitAnswers, arg string) error {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected key=value, got %q", arg)
+	}
+
+	key, value := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+
+	switch key {
+	case "name":
+		answers.Name = value
+	case "server":
+		answers.Server = value
+	case "user":
+		answers.User = value
+	case "web":
+		web, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("web must be true or false, got %q", value)
+		}
+		answers.Web = web
+	case "hostname":
+		answers.Hostname = value
+	case "port":
+		err := validatePort(value)
+		if err != nil {
+			return err
+		}
+		answers.Port, _ = strconv.Atoi(value)
+	case "email":
+		answers.Email = value
+	case "registry":
+		answers.Registry = value
+	case "environmentfile":
+		answers.EnvironmentFile = value
+	case "dockerfile":
+		answers.Dockerfile = value
+	default:
+		return fmt.Errorf("unknown key %q, expected name, server, user, web, hostname, port, email, registry, environmentfile or dockerfile", key)
+	}
+
+	return nil
+}
+
+// prompter asks questions on a terminal, re-asking until an answer is valid
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// ask returns the answer to a question, or the default when the answer is left empty
+func (p *prompter) ask(question string, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no answer to %q", question)
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+
+		if validate != nil {
+			invalid := validate(answer)
+			if invalid != nil {
+				// input ended, asking again would never get an answer
+				if err != nil {
+					return "", invalid
+				}
+
+				fmt.Fprintln(p.out, invalid)
+				continue
+			}
+		}
+
+		return answer, nil
+	}
+}
+
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	answer, err := p.ask(fmt.Sprintf("%s (%s)", question, hint), "", func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "", "y", "yes", "n", "no":
+			return nil
+		}
+		return fmt.Errorf("answer y or n")
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return def, nil
+}
+
+// askInitAnswers walks through the questions of the init wizard, suggesting what was detected
+func askInitAnswers(p *prompter, info ProjectInfo) (InitAnswers, error) {
+	answers := defaultInitAnswers(info)
+	var err error
+
+	answers.Name, err = p.ask("app name", answers.Name, validateAppName)
+	if err != nil {
+		return answers, err
+	}
+
+	answers.Server, err = p.ask("server ip or hostname", "", requireAnswer)
+	if err != nil {
+		return answers, err
+	}
+
+	answers.User, err = p.ask("ssh user", answers.User, requireAnswer)
+	if err != nil {
+		return answers, err
+	}
+
+	answers.Web, err = p.confirm("serve the app over https with traefik?", answers.Web)
+	if err != nil {
+		return answers, err
+	}
+
+	if answers.Web {
+		answers.Hostname, err = p.ask("hostname, i.e. myapp.example.com", "", requireAnswer)
+		if err != nil {
+			return answers, err
+		}
+
+		port, err := p.ask("port the container listens on", strconv.Itoa(answers.Port), validatePort)
+		if err != nil {
+			return answers, err
+		}
+		answers.Port, _ = strconv.Atoi(port)
+
+		answers.Email, err = p.ask("email for tls certificate notices (optional)", "", validateEmail)
+		if err != nil {
+			return answers, err
+		}
+	}
+
+	answers.Registry, err = p.ask("container registry, i.e. ghcr.io/me (leave empty to copy images to the server)", "", nil)
+	if err != nil {
+		return answers, err
+	}
+
+	if len(info.EnvironmentFiles) == 1 {
+		use, err := p.confirm(fmt.Sprintf("pass %s to the container as environment variables?", info.EnvironmentFiles[0]), true)
+		if err != nil {
+			return answers, err
+		}
+		if !use {
+			answers.EnvironmentFile = ""
+		}
+	} else if len(info.EnvironmentFiles) > 1 {
+		file, err := p.ask(fmt.Sprintf("environment file for the container (%s or none)", strings.Join(info.EnvironmentFiles, ", ")), answers.EnvironmentFile, nil)
+		if err != nil {
+			return answers, err
+		}
+		if file == "none" {
+			file = ""
+		}
+		answers.EnvironmentFile = file
+	}
+
+	return answers, nil
+}
+
+// yamlValue renders a string as a yaml scalar, quoting it only when needed
+func yamlValue(value string) string {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return strconv.Quote(value)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// renderInitConfig writes a minimal lord.yml with a comment for every section
+func renderInitConfig(answers InitAnswers) string {
+	var b strings.Builder
+
+	b.WriteString("# lord config, see the configuration reference in the lord readme for every option.\n")
+	b.WriteString("# lord validate checks this file and lord config-show prints it with every default applied.\n")
+	fmt.Fprintf(&b, "name: %s\n", yamlValue(answers.Name))
+	fmt.Fprintf(&b, "server: %s\n", yamlValue(answers.Server))
+	if answers.User != "" && answers.User != "root" {
+		fmt.Fprintf(&b, "user: %s\n", yamlValue(answers.User))
+	}
+
+	b.WriteString("\n")
+	if answers.Web {
+		b.WriteString("# served over https by traefik, requests for the hostname are routed to port of the container\n")
+		b.WriteString("web: true\n")
+		fmt.Fprintf(&b, "hostname: %s\n", yamlValue(answers.Hostname))
+		if answers.Port != defaultWebPort {
+			fmt.Fprintf(&b, "port: %d\n", answers.Port)
+		}
+		if answers.Email != "" {
+			fmt.Fprintf(&b, "email: %s\n", yamlValue(answers.Email))
+		}
+	} else {
+		b.WriteString("# set web: true and a hostname to serve the app over https with traefik\n")
+		b.WriteString("# web: true\n")
+		b.WriteString("# hostname: myapp.example.com\n")
+	}
+
+	b.WriteString("\n")
+	if answers.Registry != "" {
+		b.WriteString("# images are pushed to the registry and pulled on the server\n")
+		fmt.Fprintf(&b, "registry: %s\n", yamlValue(answers.Registry))
+	} else {
+		b.WriteString("# images are copied to the server directly, set a registry to push and pull through it instead\n")
+		b.WriteString("# registry: ghcr.io/me\n")
+	}
+
+	if answers.EnvironmentFile != "" {
+		b.WriteString("\n# environment variables passed to the container, encrypt it with lord secrets edit\n")
+		fmt.Fprintf(&b, "environmentfile: %s\n", yamlValue(answers.EnvironmentFile))
+	}
+
+	if answers.Dockerfile != "" && answers.Dockerfile != "Dockerfile" {
+		b.WriteString("\nbuild:\n")
+		fmt.Fprintf(&b, "  dockerfile: %s\n", yamlValue(answers.Dockerfile))
+	}
+
+	return b.String()
+}
+
+// checkServerConnection connects to the server with the ssh user and key lord would use
+func checkServerConnection(answers InitAnswers) error {
+	c := &Config{Server: answers.Server, User: answers.User}
+
+	// getSSHClient panics without a key, report it as a failed check instead
+	_, err := getAuthMethod(c)
+	if err != nil {
+		return err
+	}
+
+	return withSSHClient(c.Server, c, func(client *ssh.Client) error {
+		_, _, err := runSSHQuery(client, "true", "")
+		return err
+	})
+}
+
+// printProjectInfo reports what lord init detected before asking anything
+func printProjectInfo(info ProjectInfo) {
+	if info.Dockerfile == "" {
+		fmt.Println("no Dockerfile found, add one or set image in lord.yml to deploy a prebuilt image")
+	} else if len(info.ExposedPorts) == 0 {
+		fmt.Printf("found %s, it doesn't EXPOSE a port\n", info.Dockerfile)
+	} else {
+		ports := []string{}
+		for _, port := range info.ExposedPorts {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		fmt.Printf("found %s exposing port %s\n", info.Dockerfile, strings.Join(ports, ", "))
+	}
+
+	if len(info.EnvironmentFiles) > 0 {
+		fmt.Printf("found env files: %s\n", strings.Join(info.EnvironmentFiles, ", "))
+	}
+	fmt.Println()
+}
+
+// initLocalProject writes lord.yml for the project in the current directory. it asks for every value,
+// suggesting what it detected, or with nonInteractive takes the detected values and key=value arguments.
+func initLocalProject(nonInteractive bool, args []string) error {
+	_, err := os.Stat("lord.yml")
+	if err == nil {
+		fmt.Println("lord already initialized in current directory")
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error initializing lord config: %v", err)
+	}
+
+	if len(args) > 0 && !nonInteractive {
+		return fmt.Errorf("key=value answers are used with --yes, i.e. lord init --yes server=203.0.113.10")
+	}
+
+	info, err := detectProject(".")
+	if err != nil {
+		return err
+	}
+
+	printProjectInfo(info)
+
+	var answers InitAnswers
+	if nonInteractive {
+		answers = defaultInitAnswers(info)
+		for _, arg := range args {
+			err = setInitAnswer(&answers, arg)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		answers, err = askInitAnswers(newPrompter(os.Stdin, os.Stdout), info)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateInitAnswers(answers)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nchecking ssh connection to %s@%s\n", answers.User, answers.Server)
+	err = checkServerConnection(answers)
+	if err != nil {
+		fmt.Printf("warning: could not connect to the server: %v\n", err)
+		fmt.Println("check the server address, ssh user and key (set sshkeyfile in lord.yml to use a specific key)")
+	} else {
+		fmt.Println("ssh connection ok")
+	}
+
+	err = os.WriteFile("lord.yml", []byte(renderInitConfig(answers)), 0644)
+	if err != nil {
+		return fmt.Errorf("error initializing lord config: %v", err)
+	}
+
+	fmt.Println("lord initialized successfully in current directory, run lord server --plan to see what setting up the server does")
+	return nil
+}
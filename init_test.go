@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExposedPorts(t *testing.T) {
+	assert.Equal(t, []int{3000}, parseExposedPorts("FROM node:20\nEXPOSE 3000\nCMD [\"node\", \"server.js\"]\n"))
+	assert.Equal(t, []int{80, 443, 53}, parseExposedPorts("expose 80 443/tcp\n  EXPOSE 53/udp\n"))
+	assert.Equal(t, []int{}, parseExposedPorts("FROM alpine\nEXPOSE $PORT\n# EXPOSE 80\n"))
+}
+
+func TestAppNameFromDir(t *testing.T) {
+	assert.Equal(t, "my-app", appNameFromDir("/home/me/My App"))
+	assert.Equal(t, "api.v2", appNameFromDir("/src/-api.v2"))
+	assert.Equal(t, "myapp", appNameFromDir("/"))
+}
+
+func TestDetectProject(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "docker"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "docker", "Dockerfile"), []byte("FROM nginx\nEXPOSE 8080\n"), 0644))
+	for _, name := range []string{".env", ".env.production", "worker.env", ".env.example", "host.env", "notes.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("KEY=value\n"), 0644))
+	}
+
+	info, err := detectProject(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectInfo{
+		Name:             appNameFromDir(dir),
+		Dockerfile:       "docker/Dockerfile",
+		ExposedPorts:     []int{8080},
+		EnvironmentFiles: []string{".env", ".env.production", "worker.env"},
+	}, info)
+
+	answers := defaultInitAnswers(info)
+	assert.True(t, answers.Web)
+	assert.Equal(t, 8080, answers.Port)
+	assert.Equal(t, ".env", answers.EnvironmentFile)
+}
+
+func TestSetInitAnswer(t *testing.T) {
+	answers := defaultInitAnswers(ProjectInfo{Name: "myapp"})
+
+	for _, arg := range []string{"server=10.0.0.5", "web=true", "hostname=myapp.example.com", "port=3000", "Registry=ghcr.io/me"} {
+		assert.NoError(t, setInitAnswer(&answers, arg))
+	}
+	assert.NoError(t, validateInitAnswers(answers))
+	assert.Equal(t, InitAnswers{Name: "myapp", Server: "10.0.0.5", User: "root", Web: true, Hostname: "myapp.example.com", Port: 3000, Registry: "ghcr.io/me"}, answers)
+
+	assert.EqualError(t, setInitAnswer(&answers, "server"), `expected key=value, got "server"`)
+	assert.EqualError(t, setInitAnswer(&answers, "web=maybe"), `web must be true or false, got "maybe"`)
+	assert.Error(t, setInitAnswer(&answers, "port=http"))
+	assert.Error(t, setInitAnswer(&answers, "hostnmae=x"))
+
+	assert.EqualError(t, validateInitAnswers(InitAnswers{Name: "myapp", Port: 80}), "server is required")
+	assert.EqualError(t, validateInitAnswers(InitAnswers{Name: "myapp", Server: "10.0.0.5", Web: true, Port: 80}), "hostname is required when web is true")
+}
+
+func TestAskInitAnswers(t *testing.T) {
+	info := ProjectInfo{Name: "myapp", Dockerfile: "Dockerfile", ExposedPorts: []int{3000}, EnvironmentFiles: []string{".env"}}
+
+	// empty answers take the suggestion, invalid ones are asked again
+	input := strings.Join([]string{
+		"",                  // app name
+		"",                  // server is required
+		"10.0.0.5",          // server
+		"ubuntu",            // ssh user
+		"",                  // web, suggested from EXPOSE
+		"myapp.example.com", // hostname
+		"70000",             // port out of range
+		"",                  // port from EXPOSE
+		"me@example.com",    // email
+		"",                  // registry
+		"n",                 // env file
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	answers, err := askInitAnswers(newPrompter(strings.NewReader(input), &out), info)
+	assert.NoError(t, err)
+	assert.Equal(t, InitAnswers{
+		Name:       "myapp",
+		Server:     "10.0.0.5",
+		User:       "ubuntu",
+		Web:        true,
+		Hostname:   "myapp.example.com",
+		Port:       3000,
+		Email:      "me@example.com",
+		Dockerfile: "Dockerfile",
+	}, answers)
+	assert.Contains(t, out.String(), "app name [myapp]: ")
+	assert.Contains(t, out.String(), "a value is required")
+	assert.Contains(t, out.String(), `port "70000" must be a number between 1 and 65535`)
+
+	// running out of input is an error instead of a loop
+	_, err = askInitAnswers(newPrompter(strings.NewReader("myapp\n"), &out), info)
+	assert.Error(t, err)
+}
+
+func TestRenderInitConfig(t *testing.T) {
+	chdirTemp(t)
+	assert.NoError(t, os.WriteFile(".env", []byte("KEY=value\n"), 0644))
+	assert.NoError(t, os.MkdirAll("docker", 0755))
+	assert.NoError(t, os.WriteFile("docker/Dockerfile", []byte("FROM nginx\n"), 0644))
+
+	config := renderInitConfig(InitAnswers{
+		Name:            "myapp",
+		Server:          "10.0.0.5",
+		User:            "ubuntu",
+		Web:             true,
+		Hostname:        "myapp.example.com",
+		Port:            3000,
+		Registry:        "ghcr.io/me",
+		EnvironmentFile: ".env",
+		Dockerfile:      "docker/Dockerfile",
+	})
+	assert.NoError(t, os.WriteFile("lord.yml", []byte(config), 0644))
+
+	// the written config is valid and loads with the answers
+	c, err := loadConfig("", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "myapp", c.Name)
+	assert.Equal(t, "ubuntu", c.User)
+	assert.Equal(t, 3000, c.Port)
+	assert.Equal(t, "ghcr.io/me", c.Registry)
+	assert.Equal(t, "docker/Dockerfile", c.Build.Dockerfile)
+
+	// defaults are left out to keep it minimal
+	minimal := renderInitConfig(InitAnswers{Name: "myapp", Server: "10.0.0.5", User: "root", Port: 80, Dockerfile: "Dockerfile"})
+	assert.NotContains(t, minimal, "user:")
+	assert.NotContains(t, minimal, "port:")
+	assert.NotContains(t, minimal, "build:")
+	assert.Contains(t, minimal, "# web: true\n")
+
+	// values yaml would read as another type are quoted
+	assert.Contains(t, renderInitConfig(InitAnswers{Name: "123", Server: "yes"}), "name: \"123\"\nserver: \"yes\"\n")
+}
+
+func TestInitLocalProjectAlreadyInitialized(t *testing.T) {
+	chdirTemp(t)
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("name: myapp\n"), 0644))
+
+	assert.NoError(t, initLocalProject(true, []string{"server=10.0.0.5"}))
+	content, err := os.ReadFile("lord.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "name: myapp\n", string(content))
+}
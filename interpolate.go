@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config key naming the file variables are read from, the one value that is never interpolated
+const varsFileKey = "varsfile"
+
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variableLookup resolves a variable by name, reporting whether it is set
+type variableLookup func(name string) (string, bool)
+
+// configVariableLookup resolves variables from the local environment first, then the vars file so ci can
+// override anything kept in the file
+func configVariableLookup(vars map[string]string) variableLookup {
+	return func(name string) (string, bool) {
+		value, exists := os.LookupEnv(name)
+		if exists {
+			return value, true
+		}
+
+		value, exists = vars[name]
+		return value, exists
+	}
+}
+
+// interpolateValue expands ${VAR} and ${VAR:-default} references in a config value. the default is used when
+// the variable is unset or empty, $$ is a literal $ and a $ not followed by { is left as is.
+func interpolateValue(value string, lookup variableLookup) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			out.WriteByte(value[i])
+			continue
+		}
+
+		if value[i+1] == '$' {
+			out.WriteByte('$')
+			i++
+			continue
+		}
+
+		if value[i+1] != '{' {
+			out.WriteByte('$')
+			continue
+		}
+
+		end := strings.IndexByte(value[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed variable reference %q", value[i:])
+		}
+		expression := value[i+2 : i+2+end]
+
+		name, fallback, hasFallback := strings.Cut(expression, ":-")
+		if !variableNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid variable reference \"${%s}\", expected ${NAME} or ${NAME:-default}", expression)
+		}
+
+		variable, exists := lookup(name)
+		if hasFallback && variable == "" {
+			variable = fallback
+		} else if !exists {
+			return "", fmt.Errorf("variable %s is not set, set it in the environment or the vars file or use ${%s:-default}", name, name)
+		}
+
+		out.WriteString(variable)
+		i += end + 2
+	}
+
+	return out.String(), nil
+}
+
+// interpolateConfigNode expands variables in every scalar value of a config tree. keys are left as is.
+func interpolateConfigNode(node *yaml.Node, path string, lookup variableLookup, sources configSources) []ConfigIssue {
+	issues := []ConfigIssue{}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := strings.ToLower(node.Content[i].Value)
+			if path == "" && key == varsFileKey {
+				continue
+			}
+
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			issues = append(issues, interpolateConfigNode(node.Content[i+1], keyPath, lookup, sources)...)
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			issues = append(issues, interpolateConfigNode(item, fmt.Sprintf("%s[%d]", path, i), lookup, sources)...)
+		}
+
+	case yaml.ScalarNode:
+		value, err := interpolateValue(node.Value, lookup)
+		if err != nil {
+			issues = append(issues, ConfigIssue{
+				node:    node,
+				File:    sources[node],
+				Path:    path,
+				Line:    node.Line,
+				Column:  node.Column,
+				Message: fmt.Sprintf("%s: %v", path, err),
+			})
+			return issues
+		}
+
+		if value != node.Value {
+			node.Value = value
+
+			// unquoted values are retyped from what they expand to, so web: ${WEB:-false} is still a bool
+			if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				node.Tag = ""
+				node.Tag = node.ShortTag()
+			}
+		}
+	}
+
+	return issues
+}
+
+// interpolateConfigTree reads the vars file named in the config, if any, and expands variables throughout the
+// merged config tree before it is validated and loaded
+func interpolateConfigTree(configFile string, root *yaml.Node, sources configSources) error {
+	vars := map[string]string{}
+
+	if root.Kind == yaml.MappingNode {
+		_, varsFile := mappingValue(root, varsFileKey)
+		if varsFile != nil && varsFile.Kind == yaml.ScalarNode && varsFile.Value != "" {
+			parsed, err := parseKeyValueFile(varsFile.Value, "vars")
+			if err != nil {
+				return &ConfigIssues{File: configFile, Issues: []ConfigIssue{{
+					File:    sources[varsFile],
+					Path:    varsFileKey,
+					Line:    varsFile.Line,
+					Column:  varsFile.Column,
+					Message: fmt.Sprintf("failed to read varsfile %q: %v", varsFile.Value, err),
+				}}}
+			}
+			vars = parsed
+		}
+	}
+
+	issues := interpolateConfigNode(root, "", configVariableLookup(vars), sources)
+	if len(issues) > 0 {
+		return &ConfigIssues{File: configFile, Issues: issues}
+	}
+
+	return nil
+}
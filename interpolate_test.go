@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolateValue(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		vars := map[string]string{"SERVER_IP": "10.0.0.5", "EMPTY": ""}
+		value, exists := vars[name]
+		return value, exists
+	}
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"${SERVER_IP}", "10.0.0.5"},
+		{"/data/${SERVER_IP}:/data", "/data/10.0.0.5:/data"},
+		{"${MISSING:-fallback}", "fallback"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${EMPTY}", ""},
+		{"${SERVER_IP:-fallback}", "10.0.0.5"},
+		{"${MISSING:-}", ""},
+		{"pa$$word", "pa$word"},
+		{"$HOME and $", "$HOME and $"},
+	}
+
+	for _, test := range tests {
+		value, err := interpolateValue(test.value, lookup)
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, value, test.value)
+	}
+
+	_, err := interpolateValue("${MISSING}", lookup)
+	assert.EqualError(t, err, "variable MISSING is not set, set it in the environment or the vars file or use ${MISSING:-default}")
+
+	_, err = interpolateValue("${SERVER_IP", lookup)
+	assert.EqualError(t, err, `unclosed variable reference "${SERVER_IP"`)
+
+	_, err = interpolateValue("${1BAD}", lookup)
+	assert.EqualError(t, err, `invalid variable reference "${1BAD}", expected ${NAME} or ${NAME:-default}`)
+}
+
+func TestInterpolateConfigTree(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("LORD_TEST_SERVER", "10.0.0.9")
+
+	assert.NoError(t, os.WriteFile("lord.env", []byte("LORD_TEST_SERVER=10.0.0.1\nREGISTRY=reg.example.com\n"), 0644))
+	assert.NoError(t, os.WriteFile("lord.yml", []byte(`name: myapp
+varsfile: lord.env
+server: ${LORD_TEST_SERVER}
+registry: ${REGISTRY}/me
+web: ${LORD_TEST_WEB:-true}
+hostname: "${LORD_TEST_WEB:-true}"
+`), 0644))
+
+	sources := configSources{}
+	root, err := loadConfigTree("lord.yml", sources, []string{})
+	assert.NoError(t, err)
+	assert.NoError(t, interpolateConfigTree("lord.yml", root, sources))
+
+	// the environment overrides the vars file
+	_, server := mappingValue(root, "server")
+	assert.Equal(t, "10.0.0.9", server.Value)
+	_, registry := mappingValue(root, "registry")
+	assert.Equal(t, "reg.example.com/me", registry.Value)
+
+	// unquoted values keep their expanded type, quoted values stay strings
+	_, web := mappingValue(root, "web")
+	assert.Equal(t, "!!bool", web.Tag)
+	_, hostname := mappingValue(root, "hostname")
+	assert.Equal(t, "!!str", hostname.Tag)
+
+	_, err = validateConfigSchema("lord.yml", root, sources)
+	assert.NoError(t, err)
+}
+
+func TestInterpolateConfigTreeUnset(t *testing.T) {
+	chdirTemp(t)
+
+	assert.NoError(t, os.WriteFile("lord.yml", []byte("name: myapp\nserver: ${LORD_TEST_UNSET_SERVER}\nvolumes:\n  - ${LORD_TEST_UNSET_DIR}:/data\n"), 0644))
+
+	sources := configSources{}
+	root, err := loadConfigTree("lord.yml", sources, []string{})
+	assert.NoError(t, err)
+
+	err = interpolateConfigTree("lord.yml", root, sources)
+	assert.EqualError(t, err, `lord.yml:2:9: server: variable LORD_TEST_UNSET_SERVER is not set, set it in the environment or the vars file or use ${LORD_TEST_UNSET_SERVER:-default}
+lord.yml:4:5: volumes[0]: variable LORD_TEST_UNSET_DIR is not set, set it in the environment or the vars file or use ${LORD_TEST_UNSET_DIR:-default}`)
+}
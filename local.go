@@ -2,66 +2,133 @@ package main
 
 import (
 	"bytes"
-	"flag"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
-func runLocalCommand(fullCommand string) (string, string, error) {
-	// Split the full command into parts
-	parts := strings.Fields(fullCommand)
-	if len(parts) == 0 {
-		return "", "", fmt.Errorf("empty command string")
+// localCommandOptions controls how runLocalCommandWithOptions runs a command
+type localCommandOptions struct {
+	// input passed on stdin, never echoed
+	input string
+
+	// stream stdout/stderr to the terminal while the command runs
+	stream bool
+}
+
+// runLocalCommand runs a command from an argument vector, streaming its output live
+func runLocalCommand(name string, args ...string) (string, string, error) {
+	return runLocalCommandWithOptions(localCommandOptions{stream: true}, name, args...)
+}
+
+// runLocalCommandSilent runs a command without printing its output, for output that is parsed or secret
+func runLocalCommandSilent(name string, args ...string) (string, string, error) {
+	return runLocalCommandWithOptions(localCommandOptions{}, name, args...)
+}
+
+// runLocalCommandWithInput runs a command with input passed on stdin, the input is never echoed
+func runLocalCommandWithInput(input string, name string, args ...string) (string, string, error) {
+	return runLocalCommandWithOptions(localCommandOptions{input: input, stream: true}, name, args...)
+}
+
+// runLocalCommandWithOptions runs a command and captures its output. ctrl+c interrupts the child process and
+// kills it if it hasn't exited shortly after.
+//
+// in plan mode only silent commands run, they are used to read state (git, local images, credentials)
+func runLocalCommandWithOptions(options localCommandOptions, name string, args ...string) (string, string, error) {
+	if planning() && options.stream {
+		recordPlanAction(PlanAction{Kind: PlanLocal, Command: redactSecrets(formatCommand(name, args))})
+		return "", "", nil
 	}
 
-	// First part is the command, the rest are the arguments
-	command := parts[0]
-	args := parts[1:]
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
 
-	cmd := exec.Command(command, args...)
+	if options.input != "" {
+		cmd.Stdin = strings.NewReader(options.input)
+	}
 
 	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
+	if options.stream {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
+	} else {
+		cmd.Stdout = &stdoutBuf
+		cmd.Stderr = &stderrBuf
+	}
 
-	fmt.Printf("> %s\n", fullCommand)
+	// silent commands read state and are only echoed with --verbose, same as remote queries
+	if options.stream || verboseOutput {
+		fmt.Printf("> %s\n", redactSecrets(formatCommand(name, args)))
+	}
 
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return stdoutBuf.String(), stderrBuf.String(), fmt.Errorf("%s interrupted", name)
+	}
 	if err != nil {
 		fmt.Println(err)
-		fmt.Println(stderrBuf.String())
+		if !options.stream {
+			fmt.Println(stderrBuf.String())
+		}
 	}
 
 	return stdoutBuf.String(), stderrBuf.String(), err
 }
 
-func BuildContainer(imageName string, tag string, platform string, buildArgFile string, target string) error {
+// formatCommand renders an argument vector for display, quoting arguments that contain whitespace or quotes
+func formatCommand(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+func BuildContainer(c *Config, tag string) error {
 	fmt.Println("building container")
 
-	buildCmd := fmt.Sprintf("docker build --progress=plain --platform %s -t %s", platform, imageName)
-	if buildArgFile != "" {
-		args, err := parseBuildArgFile(buildArgFile)
+	buildArgs := map[string]string{}
+	if c.BuildArgFile != "" {
+		args, err := parseBuildArgFile(c.BuildArgFile)
 		if err != nil {
 			return err
 		}
-
-		for key, value := range args {
-			buildCmd += fmt.Sprintf(" --build-arg %s=%s", key, value)
-		}
-	}
-	if target != "" {
-		buildCmd += fmt.Sprintf(" --target %s", target)
+		buildArgs = args
 	}
-	buildCmd += " ."
 
-	_, _, err := runLocalCommand(buildCmd)
+	buildCmd, err := localBuildCommand(c, tag, buildArgs, time.Now())
 	if err != nil {
 		return err
 	}
 
-	_, _, err = runLocalCommand(fmt.Sprintf("docker tag %s %s", imageName, tag))
+	_, stderr, err := runLocalCommand(buildCmd[0], buildCmd[1:]...)
+	if err != nil && multiPlatform(c) && isRegistryAuthError(stderr) {
+		fmt.Println("push was not authorized, logging into the registry locally")
+
+		loginErr := localRegistryLogin(c)
+		if loginErr != nil {
+			return fmt.Errorf("docker build err: %s, local registry login failed: %v", err, loginErr)
+		}
+
+		_, _, err = runLocalCommand(buildCmd[0], buildCmd[1:]...)
+	}
 	if err != nil {
 		return err
 	}
@@ -69,34 +136,80 @@ func BuildContainer(imageName string, tag string, platform string, buildArgFile
 	return nil
 }
 
-func BuildAndPushContainer(imageName string, tag string, platform string, buildArgFile string, target string) error {
-	err := BuildContainer(imageName, tag, platform, buildArgFile, target)
+func BuildAndPushContainer(c *Config, tag string) error {
+	err := BuildContainer(c, tag)
 	if err != nil {
 		return err
 	}
 
+	// multi-platform builds are pushed by buildx
+	if multiPlatform(c) {
+		return nil
+	}
+
+	for _, pushTag := range append([]string{tag}, c.Build.Tags...) {
+		err = pushContainer(c, pushTag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pushContainer(c *Config, tag string) error {
 	fmt.Println("pushing container to registry")
 
-	_, _, err = runLocalCommand(fmt.Sprintf("docker push %s", tag))
+	_, stderr, err := runLocalCommand("docker", "push", tag)
+	if err != nil && isRegistryAuthError(stderr) {
+		fmt.Println("push was not authorized, logging into the registry locally")
+
+		loginErr := localRegistryLogin(c)
+		if loginErr != nil {
+			return fmt.Errorf("docker push err: %s, local registry login failed: %v", err, loginErr)
+		}
+
+		_, _, err = runLocalCommand("docker", "push", tag)
+	}
 	if err != nil {
-		return fmt.Errorf(
-			"docker push err: %s, ENSURE YOU ARE LOGGED INTO YOUR REGISTRY LOCALLY. lord only authenticates the registry on the remote server, not your local machine",
-			err,
-		)
+		return fmt.Errorf("docker push err: %s", err)
 	}
 
 	return nil
 }
 
-func BuildAndSaveContainer(imageName string, tag string, platform string, buildArgFile string, target string) error {
-	err := BuildContainer(imageName, tag, platform, buildArgFile, target)
+func BuildAndSaveContainer(c *Config, tag string) error {
+	err := BuildContainer(c, tag)
 	if err != nil {
 		return err
 	}
 
+	return SaveContainer(c.Name, tag)
+}
+
+// EnsureLocalImage pulls a prebuilt image for the target platform if it isn't already available locally
+func EnsureLocalImage(image string, platform string) error {
+	_, _, err := runLocalCommandSilent("docker", "image", "inspect", "--format", "{{.Id}}", image)
+	if err == nil {
+		fmt.Printf("using local image %s\n", image)
+		return nil
+	}
+
+	fmt.Printf("pulling image %s\n", image)
+
+	_, _, err = runLocalCommand("docker", "pull", "--platform", platform, image)
+	if err != nil {
+		return fmt.Errorf("image %s not found locally and could not be pulled: %v", image, err)
+	}
+
+	return nil
+}
+
+// SaveContainer saves a local image to <imageName>.tar.gz for direct loading onto the server
+func SaveContainer(imageName string, tag string) error {
 	fmt.Println("saving container")
 
-	_, _, err = runLocalCommand(fmt.Sprintf("docker save %s -o %s.tar", tag, imageName))
+	_, _, err := runLocalCommand("docker", "save", tag, "-o", fmt.Sprintf("%s.tar", imageName))
 	if err != nil {
 		return err
 	}
@@ -107,7 +220,7 @@ func BuildAndSaveContainer(imageName string, tag string, platform string, buildA
 		return err
 	}
 
-	_, _, err = runLocalCommand(fmt.Sprintf("gzip %s.tar", imageName))
+	_, _, err = runLocalCommand("gzip", fmt.Sprintf("%s.tar", imageName))
 	if err != nil {
 		return err
 	}
@@ -118,35 +231,16 @@ func BuildAndSaveContainer(imageName string, tag string, platform string, buildA
 func DeleteSavedContainer(imageName string) error {
 	filename := fmt.Sprintf("%s.tar.gz", imageName)
 
-	err := os.Remove(filename)
-	if os.IsNotExist(err) {
+	if planning() {
+		recordPlanAction(PlanAction{Kind: PlanLocal, Command: formatCommand("rm", []string{"-f", filename})})
 		return nil
 	}
-	return err
-}
 
-func initLocalProject() error {
-	_, err := os.Stat("lord.yml")
-	if err == nil {
-		fmt.Println("lord already initialized in current directory")
+	err := os.Remove(filename)
+	if os.IsNotExist(err) {
 		return nil
-	} else if os.IsNotExist(err) {
-		err := os.WriteFile("lord.yml", []byte(baseConfig), 0644)
-		if err != nil {
-			return err
-		} else {
-			fmt.Println("lord initialized successfully in current directory")
-			return nil
-		}
-	} else {
-		return fmt.Errorf("error initializing lord config: %v", err)
 	}
-}
-
-func displayHelp() {
-	flag.VisitAll(func(f *flag.Flag) {
-		fmt.Printf("-%s: %s\n", f.Name, f.Usage)
-	})
+	return err
 }
 
 func displayVerison() {
@@ -164,29 +258,66 @@ func initLocalLogDirectory() error {
 }
 
 func parseBuildArgFile(filepath string) (map[string]string, error) {
-	argMap := map[string]string{}
+	return parseKeyValueFile(filepath, "build arg")
+}
 
+// parseKeyValueFile reads KEY=VALUE lines from an env style file. lines may be prefixed with "export", values
+// may contain "=" and may be wrapped in single or double quotes. double quoted values support \" and \\ escapes.
+func parseKeyValueFile(filepath string, kind string) (map[string]string, error) {
 	contents, err := os.ReadFile(filepath)
 	if err != nil {
 		return nil, err
 	}
 
-	lines := strings.Split(string(contents), "\n")
+	return parseKeyValueContent(contents, filepath, kind)
+}
+
+// parseKeyValueContent parses env style KEY=VALUE lines already in memory, i.e. a decrypted secrets file
+func parseKeyValueContent(contents []byte, filepath string, kind string) (map[string]string, error) {
+	values := map[string]string{}
+
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
 
-	for i, line := range lines {
 		// skip empty or commented lines
-		if (line == "") || strings.HasPrefix(line, "#") {
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		argLine := strings.Split(line, "=")
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
 
-		if len(argLine) != 2 {
-			return nil, fmt.Errorf("malformed build arg file at line %v", i)
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("malformed %s file %s at line %v", kind, filepath, i+1)
 		}
 
-		argMap[argLine[0]] = argLine[1]
+		value, err := unquoteValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s file %s at line %v: %v", kind, filepath, i+1, err)
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+func unquoteValue(value string) (string, error) {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+
+	quote := value[0]
+	if len(value) < 2 || value[len(value)-1] != quote {
+		return "", fmt.Errorf("unterminated quote")
+	}
+
+	inner := value[1 : len(value)-1]
+	if quote == '\'' {
+		return inner, nil
 	}
 
-	return argMap, nil
+	replacer := strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+	return replacer.Replace(inner), nil
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBuildArgFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.args")
+	content := `# build args
+VERSION=1.2.3
+export API_URL=https://example.com/api?a=1&b=2
+TOKEN=YWJjZGVm==
+GREETING="hello world"
+ESCAPED="say \"hi\" \\ bye"
+LITERAL='keep \" as is'
+EMPTY=
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	args, err := parseBuildArgFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"VERSION":  "1.2.3",
+		"API_URL":  "https://example.com/api?a=1&b=2",
+		"TOKEN":    "YWJjZGVm==",
+		"GREETING": "hello world",
+		"ESCAPED":  `say "hi" \ bye`,
+		"LITERAL":  `keep \" as is`,
+		"EMPTY":    "",
+	}, args)
+}
+
+func TestParseBuildArgFileErrors(t *testing.T) {
+	tests := []string{
+		"NO_ASSIGNMENT\n",
+		"=value\n",
+		"TWO WORDS=value\n",
+		"UNTERMINATED=\"value\n",
+	}
+
+	for _, content := range tests {
+		path := filepath.Join(t.TempDir(), "build.args")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+		_, err := parseBuildArgFile(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestFormatCommand(t *testing.T) {
+	assert.Equal(t, "docker build -t myapp .", formatCommand("docker", []string{"build", "-t", "myapp", "."}))
+	assert.Equal(t, `docker build --build-arg "GREETING=hello world" --label ""`, formatCommand("docker", []string{"build", "--build-arg", "GREETING=hello world", "--label", ""}))
+}
+
+func TestRunLocalCommand(t *testing.T) {
+	stdout, _, err := runLocalCommandSilent("echo", "hello world", "a=b")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world a=b\n", stdout)
+
+	stdout, _, err = runLocalCommandWithInput("secret input", "cat")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret input", stdout)
+
+	_, _, err = runLocalCommandSilent("false")
+	assert.Error(t, err)
+}
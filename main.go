@@ -1,8 +1,10 @@
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 )
 
 var banner = `
@@ -17,66 +19,157 @@ var banner = `
 var version = "v1.6.0"
 
 func main() {
-	fmt.Println(banner)
-
-	configFlag := flag.String("config", "", "specify a lord config key to use (i.e. set to \"beta\" to pickup the beta.lord.yml file)")
-	deployFlag := flag.Bool("deploy", false, "build and deploy the container")
-	logsFlag := flag.Bool("logs", false, "get logs from the running container")
-	initFlag := flag.Bool("init", false, "initialize lord config in current directory")
-	serverFlag := flag.Bool("server", false, "only runs/checks the server setup, will setup the proxy as well")
-	destroyFLag := flag.Bool("destroy", false, "stop and delete a running container")
-	statusFlag := flag.Bool("status", false, "get the status of a running container")
-	helpFlag := flag.Bool("help", false, "get help with commands")
-	versionFlag := flag.Bool("version", false, "get lord version")
-	recoverFlag := flag.Bool("recover", false, "attempt to recover a server that has a bad install")
-	proxyFlag := flag.Bool("proxy", false, "only runs/checks the proxy setup")
-	logDownloadFlag := flag.Bool("logdownload", false, "download log file from the server")
-	monitorFlag := flag.Bool("monitor", false, "get system stats from the server")
-	registryFlag := flag.Bool("registry", false, "ensure the container registry can be authenticated on the host, including installing platform specific login tools")
-	dozzleFlag := flag.Bool("dozzle", false, "open dozzle web ui for monitoring containers via ssh tunnel")
-	diffFlag := flag.Bool("diff", false, "compare local files with deployed files on the server")
-
-	flag.Parse()
-
-	noFlagsSet := true
-	flag.VisitAll(func(f *flag.Flag) {
-		if f.Value.String() == "true" {
-			noFlagsSet = false
-		}
-	})
-
-	if *helpFlag || noFlagsSet {
-		if noFlagsSet {
-			fmt.Println("No command specified\n\nUsage:")
+	inv, err := parseCommandLine(os.Args[1:])
+	if err != nil && len(os.Args) == 1 {
+		fmt.Fprintf(os.Stderr, "no command specified\n\n")
+		writeMainUsage(os.Stderr)
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		var usage *usageError
+		if errors.As(err, &usage) && usage.command != "" {
+			fmt.Fprintf(os.Stderr, "run lord help %s for usage\n", usage.command)
+		} else {
+			fmt.Fprintln(os.Stderr, "run lord help for usage")
 		}
+		os.Exit(2)
+	}
 
-		displayVerison()
-		displayHelp()
+	runCommand(inv)
+}
+
+func runCommand(inv *invocation) {
+	name := inv.Command.Name
+	options := inv.Options
+
+	// help and completion scripts are printed without the banner so they can be piped
+	if name == "help" {
+		writeHelp(os.Stdout, inv.Args)
 		return
 	}
 
-	if *versionFlag {
+	if name == "completion" {
+		err := writeCompletion(os.Stdout, inv.Args[0])
+		if err != nil {
+			printConsoleError("error generating shell completion", err)
+		}
+		return
+	}
+
+	// json plans and reports keep stdout for the json alone
+	if inv.Global.Json {
+		jsonOutput = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	// secrets get keeps stdout for the value alone so it can be captured by scripts
+	if name == "secrets" && inv.Args[0] == "get" {
+		secretValueOutput = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	verboseOutput = inv.Global.Verbose
+
+	fmt.Println(banner)
+
+	if name == "version" {
 		displayVerison()
 		return
 	}
 
-	if *initFlag {
-		err := initLocalProject()
+	if name == "init" {
+		err := initLocalProject(options.Yes, inv.Args)
 		if err != nil {
-			panic(err)
+			printConsoleError("error initializing lord config", err)
 		}
 
 		return
 	}
 
-	c, err := loadConfig(*configFlag)
+	optionalEnvironmentFiles = name == "secrets" && inv.Args[0] == "set"
+
+	c, err := loadConfig(inv.Global.Config, inv.Global.Server)
+	if name == "validate" && inv.Global.Json {
+		jsonErr := writeJson(validationReport(err))
+		if jsonErr != nil {
+			printConsoleError("error printing validation report", jsonErr)
+		}
+	}
 	if err != nil {
 		printConsoleError("error loading lord config", err)
 	}
 
+	if name == "validate" {
+		if !inv.Global.Json {
+			fmt.Println("config is valid")
+		}
+		return
+	}
+
+	if name == "config-show" {
+		err = showConfig(c)
+		if err != nil {
+			printConsoleError("error showing config", err)
+		}
+		return
+	}
+
+	if name == "secrets" {
+		err = runSecretsCommand(c, inv.Args[0], inv.Args[1:], options.Host)
+		if err != nil {
+			printConsoleError("error managing secrets", err)
+		}
+		return
+	}
+
+	deploying := name == "deploy"
+	syncing := name == "sync"
+	recovering := name == "recover"
+	hostingRegistry := name == "registry" && options.Host
+	settingUp := name == "server" || deploying || syncing || recovering || hostingRegistry
+
+	if deploying {
+		if options.Image != "" {
+			c.Image = options.Image
+		}
+		if options.RemoteBuild {
+			c.Build.Remote = true
+		}
+	}
+
+	// git state is only used to tag and label images built from the local checkout
+	var gitState *GitState
+	if (deploying || syncing || name == "drift") && c.Image == "" {
+		gitState, err = readGitState(c.Secrets.KeyFile)
+		if err != nil {
+			printConsoleError("error reading git state", err)
+		}
+
+		if deploying && gitState != nil && gitState.Dirty && !options.Force {
+			printConsoleError("refusing to deploy uncommitted changes", fmt.Errorf("the git working tree is dirty, commit your changes or rerun with --force"))
+		}
+	}
+
+	if !hostingRegistry {
+		err = resolveLordRegistry(c)
+		if err != nil {
+			printConsoleError("error resolving lord hosted registry", err)
+		}
+	}
+
 	server := remote{c.Server, c}
 
-	if *serverFlag || *deployFlag || *recoverFlag {
+	// --plan is only registered on deploy, server and sync
+	if options.Plan {
+		activePlan = newPlan(name, c)
+		activePlan.Host, err = server.probeHostState()
+		if err != nil {
+			printConsoleError("error reading the server state", err)
+		}
+	}
+
+	if settingUp {
 		fmt.Println("checking server state")
 
 		err = server.ensureLordSetup()
@@ -84,7 +177,7 @@ func main() {
 			printConsoleError("error with initial setup of the remote server", err)
 		}
 
-		err = server.ensureDockerInstalled(*recoverFlag)
+		err = server.ensureDockerInstalled(recovering)
 		if err != nil {
 			printConsoleError("error installing docker on the remote server", err)
 		}
@@ -95,14 +188,21 @@ func main() {
 		}
 	}
 
-	if (*serverFlag || *deployFlag || *recoverFlag || *registryFlag) && c.Registry != "" {
-		err = server.ensureRegistryAuthenticated(*recoverFlag)
+	if (settingUp || name == "registry" || name == "prune") && !hostingRegistry && c.Registry != "" {
+		err = server.ensureRegistryAuthenticated(recovering)
 		if err != nil {
 			printConsoleError("error authenticating to registry", err)
 		}
 	}
 
-	if *serverFlag || *deployFlag || *recoverFlag || *proxyFlag {
+	proxyAction := options.Upgrade || options.Logs || options.Dashboard || options.Explain
+
+	if name == "proxy" && options.Upgrade {
+		err = server.upgradeTraefik(c.Email)
+		if err != nil {
+			printConsoleError("error upgrading reverse proxy on remote server", err)
+		}
+	} else if (settingUp && !hostingRegistry) || (name == "proxy" && !proxyAction) {
 		// only check traefik if we are deploying a web container
 		if c.Web {
 			err = server.ensureTraefikSetup(c.Email)
@@ -112,22 +212,57 @@ func main() {
 		}
 	}
 
-	if *deployFlag {
-		var imageTag string
-		if c.Registry == "" {
-			imageTag = fmt.Sprintf("lorddirect/%s:latest", c.Name)
-		} else {
-			imageTag = fmt.Sprintf("%s/%s:latest", c.Registry, c.Name)
+	switch name {
+	case "deploy":
+		// images built on the server are already in place, no transfer or pull is needed
+		builtOnServer := c.Image == "" && c.Build.Remote
+
+		imageTag := deployImageTag(c, gitState)
+		if c.Image == "" && gitState != nil {
+			// deploy the commit tag so the running revision is visible, latest still follows along
+			c.Build.Tags = append(c.Build.Tags, fmt.Sprintf("%s:latest", imageRepository(c)))
+			fmt.Printf("deploying commit %s on %s\n", gitState.ShortCommit(), gitState.Branch)
+		}
+
+		if planning() {
+			activePlan.Image = imageTag
 		}
 
-		if c.Registry == "" {
-			err = BuildAndSaveContainer(c.Name, imageTag, c.Platform, c.BuildArgFile, c.Target)
+		if c.Image != "" {
+			fmt.Printf("deploying prebuilt image %s, skipping build\n", c.Image)
+
+			// registry deployments pull the image directly on the server
+			if c.Registry == "" {
+				err = EnsureLocalImage(c.Image, c.Platform)
+				if err != nil {
+					printConsoleError("error finding the prebuilt image locally", err)
+				}
+
+				err = SaveContainer(c.Name, c.Image)
+				if err != nil {
+					printConsoleError("error saving the prebuilt image", err)
+				}
+			}
+		} else if builtOnServer {
+			err = server.remoteBuildContainer(imageTag)
+			if err != nil {
+				printConsoleError("error building the container on the remote server", err)
+			}
+
+			if c.Registry != "" {
+				err = server.pushContainerFromHost(imageTag)
+				if err != nil {
+					printConsoleError("error pushing container to registry from remote server", err)
+				}
+			}
+		} else if c.Registry == "" {
+			err = BuildAndSaveContainer(c, imageTag)
 
 			if err != nil {
 				printConsoleError("error building and saving the container", err)
 			}
 		} else {
-			err = BuildAndPushContainer(c.Name, imageTag, c.Platform, c.BuildArgFile, c.Target)
+			err = BuildAndPushContainer(c, imageTag)
 
 			if err != nil {
 				printConsoleError("error building and pusing container to registry", err)
@@ -141,7 +276,9 @@ func main() {
 			printConsoleError("error staging remote server for running the container", err)
 		}
 
-		if c.Registry == "" {
+		if builtOnServer {
+			fmt.Println("using container built on server")
+		} else if c.Registry == "" {
 			fmt.Println("direct loading container to server. this could take awhile...")
 			err = server.directLoadContainer(c.Name)
 
@@ -157,7 +294,7 @@ func main() {
 			}
 		}
 
-		if c.Registry == "" {
+		if c.Registry == "" && !builtOnServer {
 			err = DeleteSavedContainer(c.Name)
 			if err != nil {
 				fmt.Printf("warning: failed to cleanup local container file: %v\n", err)
@@ -169,29 +306,120 @@ func main() {
 			printConsoleError("error stopping/deleting container on remote server", err)
 		}
 
-		err = server.runContainer(c.Name, imageTag, c.Volumes, c.EnvironmentFile, c.Web, c.Hostname)
+		envChecksum, err := environmentChecksum(c)
+		if err != nil {
+			printConsoleError("error reading the environment file", err)
+		}
+
+		err = server.runContainer(containerSpec(c, imageTag, envChecksum), deployLabels(gitState, localDeployer(), time.Now()))
 		if err != nil {
 			printConsoleError("error runing container on remote server", err)
 		}
 
-		fmt.Println("finished deployment")
-	} else if *logsFlag {
-		err = server.streamContainerLogs(c.Name)
+		if !planning() {
+			fmt.Println("finished deployment")
+		}
+
+		if c.Prune.AfterDeploy {
+			err = server.pruneImages(c.Prune.Keep, false)
+			if err != nil {
+				fmt.Printf("warning: failed to prune old images on server: %v\n", err)
+			}
+		}
+	case "sync", "drift":
+		imageTag := deployImageTag(c, gitState)
+		if planning() {
+			activePlan.Image = imageTag
+		}
+
+		envChecksum, err := environmentChecksum(c)
+		if err != nil {
+			printConsoleError("error reading the environment file", err)
+		}
+
+		desired := containerSpec(c, imageTag, envChecksum)
+
+		if name == "drift" {
+			err = server.reportDrift(desired, inv.Global.Json)
+			if err != nil {
+				printConsoleError("the server has drifted from the config", err)
+			}
+		} else {
+			err = server.stageForContainer(c.Name, c.Volumes, c.EnvironmentFile)
+			if err != nil {
+				printConsoleError("error staging remote server for running the container", err)
+			}
+
+			err = server.syncContainer(desired, gitState)
+			if err != nil {
+				printConsoleError("error syncing container on remote server", err)
+			}
+		}
+	case "registry":
+		if hostingRegistry {
+			err = server.hostRegistry()
+			if err != nil {
+				printConsoleError("error hosting container registry on remote server", err)
+			}
+		}
+	case "prune":
+		err = server.pruneImages(c.Prune.Keep, options.DryRun)
+		if err != nil {
+			printConsoleError("error pruning images on remote server", err)
+		}
+
+		if c.Registry != "" {
+			err = server.pruneRegistry(c.Prune.Keep, options.DryRun)
+			if err != nil {
+				printConsoleError("error pruning images in registry", err)
+			}
+		}
+	case "proxy":
+		if options.Logs {
+			router := options.Router
+			if router == "" {
+				router = c.Name
+			}
+
+			err = server.streamProxyAccessLogs(router)
+			if err != nil {
+				printConsoleError("error streaming proxy access logs", err)
+			}
+		} else if options.Explain {
+			err = server.explainProxySettings()
+			if err != nil {
+				printConsoleError("error explaining proxy settings", err)
+			}
+		} else if options.Dashboard {
+			err = server.openProxyDashboard()
+			if err != nil {
+				printConsoleError("error opening proxy dashboard", err)
+			}
+		}
+	case "logs":
+		err = server.streamContainerLogs(c.Name, options.Since, options.Tail)
 		if err != nil {
 			printConsoleError("error streaming container logs", err)
 		}
-	} else if *destroyFLag {
+	case "destroy":
 		err = server.stopAndDeleteContainer(c.Name)
 		if err != nil {
 			printConsoleError("error stopping/deleting container on remote server", err)
 		}
-	} else if *statusFlag {
-		err = server.getContainerStatus(c.Name)
+
+		if c.Web {
+			err = server.releaseTraefikSettings()
+			if err != nil {
+				printConsoleError("error releasing global proxy settings", err)
+			}
+		}
+	case "status":
+		err = server.getContainerStatus(c.Name, inv.Global.Json)
 		if err != nil {
 			printConsoleError("error getting container status on remote server", err)
 		}
-	} else if *logDownloadFlag {
-		initLocalLogDirectory()
+	case "logdownload":
+		err = initLocalLogDirectory()
 		if err != nil {
 			printConsoleError("error creating local log storage directory", err)
 		}
@@ -200,22 +428,54 @@ func main() {
 		if err != nil {
 			printConsoleError("error downloading logs from remote server", err)
 		}
-	} else if *monitorFlag {
+	case "monitor":
 		err = server.getSystemStats(false)
 		if err != nil {
 			printConsoleError("error getting system stats from remote server", err)
 		}
-	} else if *dozzleFlag {
+	case "dozzle":
 		err = startDozzleUI(c.Server, c)
 		if err != nil {
 			printConsoleError("error starting and connecting dozzle ui", err)
 		}
-	} else if *diffFlag {
+	case "diff":
 		err = server.diffLocalAndRemote(c.Name)
 		if err != nil {
 			printConsoleError("error comparing local and remote files", err)
 		}
-	} else if !*serverFlag && !*recoverFlag && !*proxyFlag {
-		fmt.Println("not a valid command")
+	case "certs":
+		if options.Renew != "" {
+			err = server.renewCertificate(options.Renew)
+			if err != nil {
+				printConsoleError("error forcing certificate renewal", err)
+			}
+		} else {
+			err = server.listCertificates()
+			if err != nil {
+				printConsoleError("error listing certificates on remote server", err)
+			}
+		}
+	case "secrets-audit":
+		err = server.auditHostSecrets(inv.Global.Json)
+		if err != nil {
+			printConsoleError("error auditing secret files on remote server", err)
+		}
+	case "maintenance":
+		if inv.Args[0] == "on" {
+			err = server.enableMaintenance()
+		} else {
+			err = server.disableMaintenance()
+		}
+
+		if err != nil {
+			printConsoleError("error switching maintenance mode", err)
+		}
+	}
+
+	if planning() {
+		err = printPlan(activePlan, inv.Global.Json, jsonOutput)
+		if err != nil {
+			printConsoleError("error printing plan", err)
+		}
 	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maintenance routers outrank the app router, the allowlist bypass outranks the maintenance router
+const maintenanceRouterPriority = 10000
+const maintenanceBypassRouterPriority = 20000
+
+var defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Down for maintenance</title>
+  <style>
+    body { font-family: sans-serif; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; color: #333; }
+  </style>
+</head>
+<body>
+  <div>
+    <h1>Down for maintenance</h1>
+    <p>We'll be back shortly.</p>
+  </div>
+</body>
+</html>
+`
+
+func maintenanceContainerName(name string) string {
+	return fmt.Sprintf("%s-maintenance", name)
+}
+
+func maintenanceNginxConfig(retryAfter int) string {
+	return fmt.Sprintf(`server {
+    listen 80;
+    root /usr/share/nginx/html;
+
+    add_header Retry-After %d always;
+    add_header Cache-Control "no-store" always;
+
+    error_page 503 /maintenance.html;
+
+    location = /maintenance.html {
+        internal;
+    }
+
+    location / {
+        return 503;
+    }
+}
+`, retryAfter)
+}
+
+// hostRule matches the app hostname and its www variant, same as the app router
+func hostRule(hostname string) string {
+	return fmt.Sprintf("Host(`%s`) || Host(`www.%s`)", hostname, hostname)
+}
+
+// maintenanceLabels routes the app hostname to the maintenance responder and, when allowlisted ips are
+// configured, adds a higher priority router sending those clients to the real app service
+func maintenanceLabels(name string, hostname string, allowIps []string) []string {
+	maintenanceName := maintenanceContainerName(name)
+
+	labels := []string{
+		"traefik.enable=true",
+		fmt.Sprintf("traefik.http.routers.%s.rule=%s", maintenanceName, hostRule(hostname)),
+		fmt.Sprintf("traefik.http.routers.%s.entryPoints=websecure", maintenanceName),
+		fmt.Sprintf("traefik.http.routers.%s.tls.certresolver=theresolver", maintenanceName),
+		fmt.Sprintf("traefik.http.routers.%s.priority=%d", maintenanceName, maintenanceRouterPriority),
+		fmt.Sprintf("traefik.http.routers.%s.service=%s", maintenanceName, maintenanceName),
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=80", maintenanceName),
+	}
+
+	if len(allowIps) > 0 {
+		ipMatchers := []string{}
+		for _, ip := range allowIps {
+			ipMatchers = append(ipMatchers, fmt.Sprintf("ClientIP(`%s`)", ip))
+		}
+
+		bypassName := fmt.Sprintf("%s-bypass", maintenanceName)
+		labels = append(labels,
+			fmt.Sprintf("traefik.http.routers.%s.rule=(%s) && (%s)", bypassName, hostRule(hostname), strings.Join(ipMatchers, " || ")),
+			fmt.Sprintf("traefik.http.routers.%s.entryPoints=websecure", bypassName),
+			fmt.Sprintf("traefik.http.routers.%s.tls.certresolver=theresolver", bypassName),
+			fmt.Sprintf("traefik.http.routers.%s.priority=%d", bypassName, maintenanceBypassRouterPriority),
+			fmt.Sprintf("traefik.http.routers.%s.service=%s@docker", bypassName, name),
+		)
+	}
+
+	return labels
+}
+
+func maintenanceDir(name string) string {
+	return fmt.Sprintf("/etc/%s/maintenance", name)
+}
+
+// maintenanceEnableCommands replaces any previous maintenance container with an nginx container serving the page
+// and config written to the maintenance dir
+func maintenanceEnableCommands(c *Config) []string {
+	name := c.Name
+	maintenanceName := maintenanceContainerName(name)
+	dir := maintenanceDir(name)
+
+	runArgs := []string{"sudo", "docker", "run", "-d", "--restart", "unless-stopped"}
+	runArgs = append(runArgs, "--name", maintenanceName)
+	runArgs = append(runArgs, "-v", fmt.Sprintf("%s/maintenance.html:/usr/share/nginx/html/maintenance.html:ro", dir))
+	runArgs = append(runArgs, "-v", fmt.Sprintf("%s/default.conf:/etc/nginx/conf.d/default.conf:ro", dir))
+
+	for _, label := range maintenanceLabels(name, c.Hostname, c.Maintenance.AllowIps) {
+		runArgs = append(runArgs, "--label", label)
+	}
+
+	runArgs = append(runArgs, "--network", "traefik", "nginx:alpine")
+
+	return []string{
+		shellCommand("sudo", "docker", "rm", "--force", maintenanceName),
+		shellCommand(runArgs...),
+	}
+}
+
+func maintenanceDisableCommands(name string) []string {
+	return []string{
+		shellCommand("sudo", "docker", "rm", "--force", maintenanceContainerName(name)),
+	}
+}
+
+func (r *remote) enableMaintenance() error {
+	if !r.config.Web {
+		return fmt.Errorf("maintenance mode is only available for web apps")
+	}
+
+	page := defaultMaintenancePage
+	if r.config.Maintenance.Page != "" {
+		content, err := os.ReadFile(r.config.Maintenance.Page)
+		if err != nil {
+			return fmt.Errorf("error reading maintenance page: %v", err)
+		}
+		page = string(content)
+	}
+
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("enabling maintenance mode")
+
+		dir := maintenanceDir(r.config.Name)
+
+		_, _, err := runSSHCommand(client, shellCommand("sudo", "mkdir", "-p", dir), "")
+		if err != nil {
+			return err
+		}
+
+		// the maintenance dir is root owned, both files go through sudo tee
+		err = writeRemoteFile(client, fmt.Sprintf("%s/maintenance.html", dir), page)
+		if err != nil {
+			return err
+		}
+
+		err = writeRemoteFile(client, fmt.Sprintf("%s/default.conf", dir), maintenanceNginxConfig(r.config.Maintenance.RetryAfter))
+		if err != nil {
+			return err
+		}
+
+		for _, cmd := range maintenanceEnableCommands(r.config) {
+			_, _, err := runSSHCommand(client, cmd, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("%s is in maintenance mode, run lord maintenance off to restore traffic\n", r.config.Hostname)
+
+		return nil
+	})
+}
+
+func (r *remote) disableMaintenance() error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("disabling maintenance mode")
+
+		for _, cmd := range maintenanceDisableCommands(r.config.Name) {
+			_, _, err := runSSHCommand(client, cmd, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Println("traffic restored to the app")
+
+		return nil
+	})
+}
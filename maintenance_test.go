@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceLabels(t *testing.T) {
+	t.Run("without allowlist", func(t *testing.T) {
+		labels := maintenanceLabels("myapp", "myapp.example.com", nil)
+		assert.Contains(t, labels, "traefik.http.routers.myapp-maintenance.rule=Host(`myapp.example.com`) || Host(`www.myapp.example.com`)")
+		assert.Contains(t, labels, "traefik.http.routers.myapp-maintenance.priority=10000")
+		assert.Contains(t, labels, "traefik.http.services.myapp-maintenance.loadbalancer.server.port=80")
+		for _, label := range labels {
+			assert.NotContains(t, label, "bypass")
+		}
+	})
+
+	t.Run("with allowlist routes to the app service", func(t *testing.T) {
+		labels := maintenanceLabels("myapp", "myapp.example.com", []string{"203.0.113.10", "10.0.0.0/8"})
+		assert.Contains(t, labels, "traefik.http.routers.myapp-maintenance-bypass.rule=(Host(`myapp.example.com`) || Host(`www.myapp.example.com`)) && (ClientIP(`203.0.113.10`) || ClientIP(`10.0.0.0/8`))")
+		assert.Contains(t, labels, "traefik.http.routers.myapp-maintenance-bypass.service=myapp@docker")
+		assert.Contains(t, labels, "traefik.http.routers.myapp-maintenance-bypass.priority=20000")
+	})
+}
+
+func TestMaintenanceNginxConfig(t *testing.T) {
+	conf := maintenanceNginxConfig(600)
+	assert.Contains(t, conf, "add_header Retry-After 600 always;")
+	assert.Contains(t, conf, "return 503;")
+	assert.Contains(t, conf, "error_page 503 /maintenance.html;")
+}
+
+func TestMaintenanceCommands(t *testing.T) {
+	c := &Config{
+		Name:     "myapp",
+		Hostname: "myapp.example.com",
+		Web:      true,
+	}
+
+	enable := maintenanceEnableCommands(c)
+	if assert.Len(t, enable, 2) {
+		assert.Equal(t, "sudo docker rm --force myapp-maintenance", enable[0])
+		assert.True(t, strings.HasPrefix(enable[1], "sudo docker run -d --restart unless-stopped --name myapp-maintenance "))
+		assert.Contains(t, enable[1], "-v /etc/myapp/maintenance/maintenance.html:/usr/share/nginx/html/maintenance.html:ro")
+		assert.Contains(t, enable[1], "-v /etc/myapp/maintenance/default.conf:/etc/nginx/conf.d/default.conf:ro")
+		assert.Contains(t, enable[1], "--label 'traefik.http.routers.myapp-maintenance.rule=Host(`myapp.example.com`) || Host(`www.myapp.example.com`)'")
+		assert.True(t, strings.HasSuffix(enable[1], "--network traefik nginx:alpine"))
+	}
+
+	assert.Equal(t, []string{"sudo docker rm --force myapp-maintenance"}, maintenanceDisableCommands("myapp"))
+}
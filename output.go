@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// jsonOutput is where plans and reports are printed. with --json stdout is kept for the json alone and lord's
+// progress output goes to stderr.
+var jsonOutput io.Writer = os.Stdout
+
+// writeJson prints a report as indented json for scripts and ci
+func writeJson(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(jsonOutput, string(out))
+	return err
+}
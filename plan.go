@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// kinds of planned actions
+const (
+	PlanRemote  = "remote"
+	PlanLocal   = "local"
+	PlanUpload  = "upload"
+	PlanTraefik = "traefik"
+)
+
+// PlanAction is a single change lord would make, in the order it would make it
+type PlanAction struct {
+	Kind string `json:"kind"`
+
+	// command that would run, on the server for remote actions or locally for local actions
+	Command string `json:"command,omitempty"`
+
+	// files copied to the server, the source is empty for content generated or decrypted in memory
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// extra context, i.e. the traefik config diff or the size of an upload
+	Detail []string `json:"detail,omitempty"`
+}
+
+// ContainerState is the app container currently on the host
+type ContainerState struct {
+	Running bool   `json:"running"`
+	Image   string `json:"image"`
+	ImageID string `json:"imageId"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// HostState is what lord found on the host before planning, read without changing anything
+type HostState struct {
+	// empty when docker is not installed
+	DockerVersion  string          `json:"dockerVersion"`
+	DockerRunning  bool            `json:"dockerRunning"`
+	TraefikRunning bool            `json:"traefikRunning"`
+	TraefikImage   string          `json:"traefikImage,omitempty"`
+	Container      *ContainerState `json:"container"`
+}
+
+// Plan is everything a command would do against the current state of the host
+type Plan struct {
+	Command string       `json:"command"`
+	App     string       `json:"app"`
+	Server  string       `json:"server"`
+	Image   string       `json:"image,omitempty"`
+	Host    HostState    `json:"host"`
+	Actions []PlanAction `json:"actions"`
+}
+
+// activePlan is set by -plan. while it is set read-only probes (runSSHQuery and silent local commands) still
+// run, every other remote command, upload and local command is recorded here instead of being run.
+var activePlan *Plan
+
+func newPlan(command string, c *Config) *Plan {
+	return &Plan{
+		Command: command,
+		App:     c.Name,
+		Server:  c.Server,
+		Actions: []PlanAction{},
+	}
+}
+
+func planning() bool {
+	return activePlan != nil
+}
+
+func recordPlanAction(action PlanAction) {
+	activePlan.Actions = append(activePlan.Actions, action)
+}
+
+// planRemoteCommand records a remote command, secrets passed on stdin are only described by their size
+func planRemoteCommand(cmd string, input []byte) {
+	action := PlanAction{Kind: PlanRemote, Command: redactSecrets(cmd)}
+	if input != nil {
+		action.Detail = []string{fmt.Sprintf("%d bytes on stdin", len(input))}
+	}
+	recordPlanAction(action)
+}
+
+// planUpload records a file copied to the server
+func planUpload(source string, destination string, size int64, detail ...string) {
+	if size >= 0 {
+		detail = append([]string{formatBytes(size)}, detail...)
+	}
+	recordPlanAction(PlanAction{Kind: PlanUpload, Source: source, Destination: destination, Detail: detail})
+}
+
+// planTraefikChange records a change to the traefik config as a diff against the running config
+func planTraefikChange(path string, diff []string) {
+	recordPlanAction(PlanAction{Kind: PlanTraefik, Destination: path, Detail: diff})
+}
+
+// parseContainerState parses "<running> <image id> <image>" as printed by containerStateFormat
+func parseContainerState(output string) (*ContainerState, error) {
+	fields := strings.Fields(strings.TrimSpace(output))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected container state: %s", strings.TrimSpace(output))
+	}
+
+	return &ContainerState{Running: fields[0] == "true", ImageID: fields[1], Image: fields[2]}, nil
+}
+
+const containerStateFormat = "{{.State.Running}} {{.Image}} {{.Config.Image}}"
+
+// probeHostState reads the current state of the host without changing it
+func (r *remote) probeHostState() (HostState, error) {
+	state := HostState{}
+
+	err := withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		output, _, err := runSSHQuery(client, "sudo docker --version", "")
+		if err != nil {
+			// nothing else can be read without docker
+			return nil
+		}
+		state.DockerVersion = strings.TrimSpace(output)
+
+		_, _, err = runSSHQuery(client, "sudo systemctl is-active --quiet docker", "")
+		state.DockerRunning = err == nil
+
+		output, _, err = runSSHQuery(client, shellCommand("sudo", "docker", "inspect", "--format", containerStateFormat, "traefik"), "")
+		if err == nil {
+			traefik, err := parseContainerState(output)
+			if err != nil {
+				return err
+			}
+			state.TraefikRunning = traefik.Running
+			state.TraefikImage = traefik.Image
+		}
+
+		output, _, err = runSSHQuery(client, shellCommand("sudo", "docker", "inspect", "--format", containerStateFormat, r.config.Name), "")
+		if err != nil {
+			return nil
+		}
+
+		state.Container, err = parseContainerState(output)
+		if err != nil {
+			return err
+		}
+
+		// images loaded directly onto the host have no registry digest
+		output, _, err = runSSHQuery(client, shellCommand("sudo", "docker", "image", "inspect", "--format", "{{join .RepoDigests \" \"}}", state.Container.ImageID), "")
+		if err == nil && len(strings.Fields(output)) > 0 {
+			state.Container.Digest = strings.Fields(output)[0]
+		}
+
+		return nil
+	})
+
+	return state, err
+}
+
+// formatHostState renders the host state for the text plan
+func formatHostState(state HostState) []string {
+	docker := "not installed"
+	if state.DockerVersion != "" {
+		docker = fmt.Sprintf("installed (%s), stopped", state.DockerVersion)
+		if state.DockerRunning {
+			docker = fmt.Sprintf("installed (%s), running", state.DockerVersion)
+		}
+	}
+
+	traefik := "not running"
+	if state.TraefikRunning {
+		traefik = fmt.Sprintf("running %s", state.TraefikImage)
+	} else if state.TraefikImage != "" {
+		traefik = fmt.Sprintf("stopped %s", state.TraefikImage)
+	}
+
+	container := "none"
+	if state.Container != nil {
+		status := "stopped"
+		if state.Container.Running {
+			status = "running"
+		}
+
+		digest := state.Container.Digest
+		if digest == "" {
+			digest = state.Container.ImageID
+		}
+		container = fmt.Sprintf("%s %s (%s)", status, state.Container.Image, digest)
+	}
+
+	return []string{
+		fmt.Sprintf("docker:    %s", docker),
+		fmt.Sprintf("traefik:   %s", traefik),
+		fmt.Sprintf("container: %s", container),
+	}
+}
+
+// formatPlan renders the plan as numbered actions, multi-line commands (file contents) are indented under
+// their action
+func formatPlan(plan *Plan) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "plan for %s of %s on %s\n", plan.Command, plan.App, plan.Server)
+	if plan.Image != "" {
+		fmt.Fprintf(&b, "image: %s\n", plan.Image)
+	}
+
+	b.WriteString("\nhost state:\n")
+	for _, line := range formatHostState(plan.Host) {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+
+	b.WriteString("\nactions:\n")
+	if len(plan.Actions) == 0 {
+		b.WriteString("  none, the server is up to date\n")
+	}
+
+	for i, action := range plan.Actions {
+		lines := []string{}
+		switch action.Kind {
+		case PlanUpload:
+			source := action.Source
+			if source == "" {
+				source = "(generated)"
+			}
+			lines = append(lines, fmt.Sprintf("%s -> %s", source, action.Destination))
+		case PlanTraefik:
+			lines = append(lines, fmt.Sprintf("update %s", action.Destination))
+		default:
+			lines = append(lines, strings.Split(action.Command, "\n")...)
+		}
+		lines = append(lines, action.Detail...)
+
+		fmt.Fprintf(&b, "%3d. [%s] %s\n", i+1, action.Kind, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(&b, "       %s\n", line)
+		}
+	}
+
+	b.WriteString("\nnothing was changed, run the same command without --plan to apply\n")
+
+	return b.String()
+}
+
+// printPlan writes the plan as text or, for review in ci, as json
+func printPlan(plan *Plan, asJson bool, out io.Writer) error {
+	if !asJson {
+		_, err := fmt.Fprint(out, "\n"+formatPlan(plan))
+		return err
+	}
+
+	planBytes, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(planBytes))
+	return err
+}
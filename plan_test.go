@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startTestPlan turns plan mode on for the duration of a test
+func startTestPlan(t *testing.T) *Plan {
+	activePlan = newPlan("deploy", &Config{Name: "myapp", Server: "10.0.0.5"})
+	t.Cleanup(func() {
+		activePlan = nil
+	})
+	return activePlan
+}
+
+func TestPlanRecordsInsteadOfRunning(t *testing.T) {
+	plan := startTestPlan(t)
+
+	// no client is needed as nothing is sent to the server
+	_, _, err := runSSHCommand(nil, "sudo docker rm --force myapp", "myapp")
+	assert.NoError(t, err)
+
+	_, _, err = runSSHCommandWithInput(nil, "sudo docker login --password-stdin", []byte("hunter22"), "")
+	assert.NoError(t, err)
+
+	err = runSSHCommandStreaming(nil, "sudo docker build .", "myapp")
+	assert.NoError(t, err)
+
+	err = writeRemoteSecretFile(nil, "/etc/myapp/myapp.env", []byte("KEY=value\n"), false)
+	assert.NoError(t, err)
+
+	upload := filepath.Join(t.TempDir(), "myapp.tar.gz")
+	assert.NoError(t, os.WriteFile(upload, []byte("image"), 0644))
+	err = sftpCopyFileToRemote(nil, upload, "/tmp/myapp.tar.gz")
+	assert.NoError(t, err)
+
+	// a local command that would fail proves it was never run
+	_, _, err = runLocalCommand("false")
+	assert.NoError(t, err)
+
+	assert.NoError(t, DeleteSavedContainer("myapp"))
+
+	assert.Equal(t, []PlanAction{
+		{Kind: PlanRemote, Command: "sudo docker rm --force myapp"},
+		{Kind: PlanRemote, Command: "sudo docker login --password-stdin", Detail: []string{"8 bytes on stdin"}},
+		{Kind: PlanRemote, Command: "sudo docker build ."},
+		{Kind: PlanUpload, Destination: "/etc/myapp/myapp.env", Detail: []string{"10B", "mode 0600"}},
+		{Kind: PlanUpload, Source: upload, Destination: "/tmp/myapp.tar.gz", Detail: []string{"5B"}},
+		{Kind: PlanLocal, Command: "false"},
+		{Kind: PlanLocal, Command: "rm -f myapp.tar.gz"},
+	}, plan.Actions)
+}
+
+func TestPlanStillRunsLocalQueries(t *testing.T) {
+	startTestPlan(t)
+
+	stdout, _, err := runLocalCommandSilent("echo", "probe")
+	assert.NoError(t, err)
+	assert.Equal(t, "probe\n", stdout)
+}
+
+func TestParseContainerState(t *testing.T) {
+	state, err := parseContainerState("true sha256:abc registry.example.com/myapp:1a2b3c\n")
+	assert.NoError(t, err)
+	assert.Equal(t, &ContainerState{Running: true, ImageID: "sha256:abc", Image: "registry.example.com/myapp:1a2b3c"}, state)
+
+	_, err = parseContainerState("")
+	assert.Error(t, err)
+}
+
+func TestFormatHostState(t *testing.T) {
+	assert.Equal(t, []string{
+		"docker:    not installed",
+		"traefik:   not running",
+		"container: none",
+	}, formatHostState(HostState{}))
+
+	assert.Equal(t, []string{
+		"docker:    installed (Docker version 27.1.1), running",
+		"traefik:   running traefik:v3.1",
+		"container: running myapp:latest (registry.example.com/myapp@sha256:def)",
+	}, formatHostState(HostState{
+		DockerVersion:  "Docker version 27.1.1",
+		DockerRunning:  true,
+		TraefikRunning: true,
+		TraefikImage:   "traefik:v3.1",
+		Container:      &ContainerState{Running: true, Image: "myapp:latest", ImageID: "sha256:abc", Digest: "registry.example.com/myapp@sha256:def"},
+	}))
+}
+
+func TestFormatPlan(t *testing.T) {
+	plan := newPlan("deploy", &Config{Name: "myapp", Server: "10.0.0.5"})
+	plan.Image = "myapp:latest"
+	plan.Actions = []PlanAction{
+		{Kind: PlanTraefik, Destination: "/etc/traefik/traefik.yml", Detail: []string{"-a", "+b"}},
+		{Kind: PlanRemote, Command: "sudo sh -c 'first\nsecond'"},
+		{Kind: PlanUpload, Destination: "/etc/myapp/myapp.env", Detail: []string{"10B"}},
+	}
+
+	assert.Equal(t, `plan for deploy of myapp on 10.0.0.5
+image: myapp:latest
+
+host state:
+  docker:    not installed
+  traefik:   not running
+  container: none
+
+actions:
+  1. [traefik] update /etc/traefik/traefik.yml
+       -a
+       +b
+  2. [remote] sudo sh -c 'first
+       second'
+  3. [upload] (generated) -> /etc/myapp/myapp.env
+       10B
+
+nothing was changed, run the same command without --plan to apply
+`, formatPlan(plan))
+}
+
+func TestPrintPlanJson(t *testing.T) {
+	plan := newPlan("server", &Config{Name: "myapp", Server: "10.0.0.5"})
+	plan.Actions = append(plan.Actions, PlanAction{Kind: PlanRemote, Command: "sudo mkdir -p /etc/lord"})
+
+	var out bytes.Buffer
+	assert.NoError(t, printPlan(plan, true, &out))
+
+	var decoded Plan
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, *plan, decoded)
+	assert.Contains(t, out.String(), `"container": null`)
+}
+
+func TestUpsertProxySettingsRecord(t *testing.T) {
+	records := []ProxySettingsRecord{{App: "a", ReadTimeout: 10}, {App: "b"}}
+
+	records = upsertProxySettingsRecord(records, ProxySettingsRecord{App: "a", ReadTimeout: 30})
+	assert.Equal(t, []ProxySettingsRecord{{App: "a", ReadTimeout: 30}, {App: "b"}}, records)
+
+	records = upsertProxySettingsRecord(records, ProxySettingsRecord{App: "c"})
+	assert.Len(t, records, 3)
+
+	assert.Equal(t, []ProxySettingsRecord{{App: "a", ReadTimeout: 30}, {App: "c"}}, removeProxySettingsRecord(records, "b"))
+}
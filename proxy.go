@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const traefikAccessLogPath = "/var/log/traefik/access.log"
+
+const traefikLogrotatePath = "/etc/logrotate.d/traefik"
+
+// traefikLogrotateConfig rotates the access log daily, traefik reopens its log files on USR1
+const traefikLogrotateConfig = `/var/log/traefik/*.log {
+    daily
+    rotate 14
+    compress
+    delaycompress
+    missingok
+    notifempty
+    postrotate
+        docker kill --signal=USR1 traefik >/dev/null 2>&1 || true
+    endscript
+}
+`
+
+// port the traefik api/dashboard listens on inside the container and on the host's localhost
+const traefikDashboardPort = 8080
+
+// local port the dashboard tunnel listens on
+const localDashboardPort = 8090
+
+// TraefikAccessLogEntry holds the subset of traefik json access log fields lord displays
+type TraefikAccessLogEntry struct {
+	StartUTC         string  `json:"StartUTC"`
+	RouterName       string  `json:"RouterName"`
+	ClientHost       string  `json:"ClientHost"`
+	RequestMethod    string  `json:"RequestMethod"`
+	RequestHost      string  `json:"RequestHost"`
+	RequestPath      string  `json:"RequestPath"`
+	DownstreamStatus int     `json:"DownstreamStatus"`
+	Duration         float64 `json:"Duration"`
+}
+
+// formatAccessLogLine parses a json access log line and formats it for display. lines that can't be
+// parsed or belong to a different router are skipped. router "all" matches every request.
+func formatAccessLogLine(line string, router string) (string, bool) {
+	var entry TraefikAccessLogEntry
+	err := json.Unmarshal([]byte(line), &entry)
+	if err != nil {
+		return "", false
+	}
+
+	// docker provider routers are named <router>@docker
+	routerName := strings.SplitN(entry.RouterName, "@", 2)[0]
+	if router != "all" && routerName != router {
+		return "", false
+	}
+
+	timestamp := entry.StartUTC
+	parsed, err := time.Parse(time.RFC3339Nano, entry.StartUTC)
+	if err == nil {
+		timestamp = parsed.Local().Format("2006-01-02 15:04:05")
+	}
+
+	if routerName == "" {
+		routerName = "-"
+	}
+
+	duration := time.Duration(entry.Duration).Round(time.Millisecond)
+
+	return fmt.Sprintf("%s %s %s %d %s %s%s %s", timestamp, routerName, entry.ClientHost, entry.DownstreamStatus, entry.RequestMethod, entry.RequestHost, entry.RequestPath, duration), true
+}
+
+func (r *remote) streamProxyAccessLogs(router string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		_, _, err := runSSHCommand(client, shellCommand("sudo", "test", "-f", traefikAccessLogPath), "")
+		if err != nil {
+			return fmt.Errorf("no access log found on server, set proxy.accesslog to true and run lord proxy")
+		}
+
+		fmt.Printf("streaming proxy access logs for router: %s\n", router)
+
+		session, err := client.NewSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			return err
+		}
+
+		err = session.Start(shellCommand("sudo", "tail", "-n", "200", "-F", traefikAccessLogPath))
+		if err != nil {
+			return err
+		}
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+		done := make(chan bool, 1)
+		go func() {
+			<-sigs
+			fmt.Println("stopping...")
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			done <- true
+		}()
+
+		go func() {
+			scanner := bufio.NewScanner(stdout)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				formatted, ok := formatAccessLogLine(scanner.Text(), router)
+				if ok {
+					fmt.Println(formatted)
+				}
+			}
+			done <- true
+		}()
+
+		<-done
+		fmt.Println("end access log stream")
+
+		return nil
+	})
+}
+
+func (r *remote) openProxyDashboard() error {
+	fmt.Println("connecting to traefik dashboard")
+
+	client, err := getSSHClient(r.address, r.config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remoteAddress := fmt.Sprintf("127.0.0.1:%d", traefikDashboardPort)
+
+	// make sure the dashboard is reachable before opening the browser
+	probe, err := client.Dial("tcp", remoteAddress)
+	if err != nil {
+		return fmt.Errorf("traefik dashboard is not reachable on the server, set proxy.dashboard to true and run lord proxy: %v", err)
+	}
+	probe.Close()
+
+	go func() {
+		err := createSSHTunnel(ctx, client, localDashboardPort, "tcp", remoteAddress)
+		if err != nil {
+			fmt.Printf("ssh tunnel error: %v\n", err)
+		}
+	}()
+
+	// wait a moment for tunnel to establish
+	time.Sleep(1 * time.Second)
+
+	dashboardUrl := fmt.Sprintf("http://localhost:%d/dashboard/", localDashboardPort)
+
+	fmt.Println("opening traefik dashboard in browser")
+	err = openBrowser(dashboardUrl)
+	if err != nil {
+		fmt.Printf("failed to open browser: %v\n", err)
+	}
+
+	fmt.Printf("traefik dashboard available at: %s\n", dashboardUrl)
+	fmt.Println("press ctrl+c to stop")
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	fmt.Println("closing tunnel")
+
+	return nil
+}
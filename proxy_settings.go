@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// directory on the host holding each app's requested global proxy settings
+const proxySettingsDir = "/etc/lord/_proxy"
+
+// record name used for settings found in traefik.yml before apps recorded their own settings.
+// app names can't start with an underscore so this never collides with a real app.
+const legacyProxySettingsRecord = "_legacy"
+
+// ProxySettingsRecord is the set of global proxy settings a single app requested on its last deploy
+type ProxySettingsRecord struct {
+	App          string `json:"app"`
+	ReadTimeout  int    `json:"readtimeout"`
+	WriteTimeout int    `json:"writetimeout"`
+	IdleTimeout  int    `json:"idletimeout"`
+	Dashboard    bool   `json:"dashboard"`
+	AccessLog    bool   `json:"accesslog"`
+}
+
+type TimeoutSetting struct {
+	// effective timeout in seconds, 0 is unlimited and -1 is the traefik default
+	Value    int
+	DrivenBy []string
+}
+
+type FeatureSetting struct {
+	Enabled  bool
+	DrivenBy []string
+}
+
+type EffectiveProxySettings struct {
+	ReadTimeout  TimeoutSetting
+	WriteTimeout TimeoutSetting
+	IdleTimeout  TimeoutSetting
+	Dashboard    FeatureSetting
+	AccessLog    FeatureSetting
+}
+
+func (r *remote) proxySettingsRecord() ProxySettingsRecord {
+	record := ProxySettingsRecord{
+		App:          r.config.Name,
+		ReadTimeout:  -1,
+		WriteTimeout: -1,
+		IdleTimeout:  -1,
+		Dashboard:    r.config.Proxy.Dashboard,
+		AccessLog:    r.config.Proxy.AccessLog,
+	}
+
+	if r.traefikNeedsAdvancedConfig() {
+		record.ReadTimeout = r.config.WebAdvancedConfig.ReadTimeout
+		record.WriteTimeout = r.config.WebAdvancedConfig.WriteTimeout
+		record.IdleTimeout = r.config.WebAdvancedConfig.IdleTimeout
+	}
+
+	return record
+}
+
+// legacyProxySettingsFromConfig captures the timeouts of a traefik config written before settings were
+// recorded per app, so upgrading lord doesn't silently lower timeouts other apps depend on
+func legacyProxySettingsFromConfig(config *TraefikConfig) (ProxySettingsRecord, bool) {
+	record := ProxySettingsRecord{
+		App:          legacyProxySettingsRecord,
+		ReadTimeout:  -1,
+		WriteTimeout: -1,
+		IdleTimeout:  -1,
+	}
+
+	websecure, exists := config.EntryPoints["websecure"]
+	if !exists || websecure.Transport == nil || websecure.Transport.RespondingTimeouts == nil {
+		return record, false
+	}
+
+	parseTimeout := func(s string) int {
+		if s == "" {
+			return -1
+		}
+		var val int
+		_, err := fmt.Sscanf(s, "%ds", &val)
+		if err != nil {
+			return -1
+		}
+		return val
+	}
+
+	timeouts := websecure.Transport.RespondingTimeouts
+	record.ReadTimeout = parseTimeout(timeouts.ReadTimeout)
+	record.WriteTimeout = parseTimeout(timeouts.WriteTimeout)
+	record.IdleTimeout = parseTimeout(timeouts.IdleTimeout)
+
+	found := record.ReadTimeout != -1 || record.WriteTimeout != -1 || record.IdleTimeout != -1
+	return record, found
+}
+
+// effectiveTimeout picks the most permissive requested timeout. 0 (unlimited) beats any value, otherwise
+// the highest value wins. -1 means no app requested a value.
+func effectiveTimeout(records []ProxySettingsRecord, value func(ProxySettingsRecord) int) TimeoutSetting {
+	setting := TimeoutSetting{Value: -1, DrivenBy: []string{}}
+
+	for _, record := range records {
+		v := value(record)
+		if v == -1 {
+			continue
+		}
+
+		switch {
+		case setting.Value == 0 && v == 0:
+			setting.DrivenBy = append(setting.DrivenBy, record.App)
+		case setting.Value == 0:
+			// unlimited already wins
+		case v == 0 || v > setting.Value:
+			setting.Value = v
+			setting.DrivenBy = []string{record.App}
+		case v == setting.Value:
+			setting.DrivenBy = append(setting.DrivenBy, record.App)
+		}
+	}
+
+	return setting
+}
+
+func effectiveFeature(records []ProxySettingsRecord, enabled func(ProxySettingsRecord) bool) FeatureSetting {
+	setting := FeatureSetting{DrivenBy: []string{}}
+
+	for _, record := range records {
+		if enabled(record) {
+			setting.Enabled = true
+			setting.DrivenBy = append(setting.DrivenBy, record.App)
+		}
+	}
+
+	return setting
+}
+
+func computeEffectiveProxySettings(records []ProxySettingsRecord) EffectiveProxySettings {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].App < records[j].App
+	})
+
+	return EffectiveProxySettings{
+		ReadTimeout:  effectiveTimeout(records, func(r ProxySettingsRecord) int { return r.ReadTimeout }),
+		WriteTimeout: effectiveTimeout(records, func(r ProxySettingsRecord) int { return r.WriteTimeout }),
+		IdleTimeout:  effectiveTimeout(records, func(r ProxySettingsRecord) int { return r.IdleTimeout }),
+		Dashboard:    effectiveFeature(records, func(r ProxySettingsRecord) bool { return r.Dashboard }),
+		AccessLog:    effectiveFeature(records, func(r ProxySettingsRecord) bool { return r.AccessLog }),
+	}
+}
+
+// parseProxySettingsRecords parses one json record per line
+func parseProxySettingsRecords(output string) ([]ProxySettingsRecord, error) {
+	records := []ProxySettingsRecord{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var record ProxySettingsRecord
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			return nil, fmt.Errorf("malformed proxy settings record: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// filterActiveProxySettings drops records of apps whose container no longer exists on the host
+func filterActiveProxySettings(records []ProxySettingsRecord, containers []string) []ProxySettingsRecord {
+	existing := map[string]bool{}
+	for _, name := range containers {
+		existing[strings.TrimSpace(name)] = true
+	}
+
+	active := []ProxySettingsRecord{}
+	for _, record := range records {
+		if record.App == legacyProxySettingsRecord || existing[record.App] {
+			active = append(active, record)
+		}
+	}
+
+	return active
+}
+
+// parseWebAppNames picks the lord web apps out of `docker ps --format '{{.Names}} {{.Labels}}'` output, i.e.
+// containers routing a traefik router of their own name. maintenance pages of a listed app are skipped.
+func parseWebAppNames(output string) []string {
+	routed := []string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		name, labels, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+
+		if strings.Contains(labels, fmt.Sprintf("traefik.http.routers.%s.rule=", name)) {
+			routed = append(routed, name)
+		}
+	}
+
+	apps := []string{}
+	for _, name := range routed {
+		app, isMaintenance := strings.CutSuffix(name, maintenanceContainerName(""))
+		if !isMaintenance || !containsString(routed, app) {
+			apps = append(apps, name)
+		}
+	}
+
+	return apps
+}
+
+// legacyProxySettingsObsolete reports whether every web app on the host has recorded its own settings, at
+// which point the legacy record no longer protects any app and can be dropped
+func legacyProxySettingsObsolete(records []ProxySettingsRecord, webApps []string) bool {
+	recorded := map[string]bool{}
+	for _, record := range records {
+		recorded[record.App] = true
+	}
+
+	if !recorded[legacyProxySettingsRecord] {
+		return false
+	}
+
+	for _, app := range webApps {
+		if !recorded[app] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// upsertProxySettingsRecord replaces the record of the same app in place, or adds it when the app has none
+func upsertProxySettingsRecord(records []ProxySettingsRecord, record ProxySettingsRecord) []ProxySettingsRecord {
+	updated := []ProxySettingsRecord{}
+	found := false
+	for _, existing := range records {
+		if existing.App == record.App {
+			existing = record
+			found = true
+		}
+		updated = append(updated, existing)
+	}
+
+	if !found {
+		updated = append(updated, record)
+	}
+	return updated
+}
+
+func removeProxySettingsRecord(records []ProxySettingsRecord, app string) []ProxySettingsRecord {
+	remaining := []ProxySettingsRecord{}
+	for _, record := range records {
+		if record.App != app {
+			remaining = append(remaining, record)
+		}
+	}
+	return remaining
+}
+
+func writeProxySettingsRecord(client *ssh.Client, record ProxySettingsRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return writeRemoteFile(client, fmt.Sprintf("%s/%s.json", proxySettingsDir, record.App), string(recordBytes)+"\n")
+}
+
+func readProxySettingsRecords(client *ssh.Client) ([]ProxySettingsRecord, error) {
+	output, _, err := runSSHQuery(client, sudoShell("for f in "+shellQuote(proxySettingsDir)+`/*.json; do [ -f "$f" ] && cat "$f" && echo; done; true`), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseProxySettingsRecords(output)
+}
+
+func listContainerNames(client *ssh.Client) ([]string, error) {
+	output, _, err := runSSHQuery(client, "sudo docker ps -a --format '{{.Names}}'", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSpace(output), "\n"), nil
+}
+
+func listWebAppNames(client *ssh.Client) ([]string, error) {
+	output, _, err := runSSHQuery(client, "sudo docker ps -a --filter label=traefik.enable=true --format '{{.Names}} {{.Labels}}'", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWebAppNames(output), nil
+}
+
+// updateProxySettings stores (or removes when releasing) this app's record and returns the effective
+// settings across every app still deployed on the host
+func (r *remote) updateProxySettings(client *ssh.Client, current *TraefikConfig, release bool) (EffectiveProxySettings, error) {
+	written := []ProxySettingsRecord{}
+
+	_, _, err := runSSHQuery(client, shellCommand("sudo", "test", "-d", proxySettingsDir), "")
+	if err != nil {
+		_, _, err = runSSHCommand(client, shellCommand("sudo", "mkdir", "-p", proxySettingsDir), "")
+		if err != nil {
+			return EffectiveProxySettings{}, err
+		}
+
+		legacy, found := legacyProxySettingsFromConfig(current)
+		if found {
+			fmt.Printf("preserving existing traefik timeouts as %s/%s.json until every app has its own settings\n", proxySettingsDir, legacyProxySettingsRecord)
+			err = writeProxySettingsRecord(client, legacy)
+			if err != nil {
+				return EffectiveProxySettings{}, err
+			}
+			written = append(written, legacy)
+		}
+	}
+
+	if release {
+		_, _, err = runSSHCommand(client, shellCommand("sudo", "rm", "-f", fmt.Sprintf("%s/%s.json", proxySettingsDir, r.config.Name)), "")
+	} else {
+		err = writeProxySettingsRecord(client, r.proxySettingsRecord())
+		written = append(written, r.proxySettingsRecord())
+	}
+	if err != nil {
+		return EffectiveProxySettings{}, err
+	}
+
+	records, legacyObsolete, err := r.readActiveProxySettings(client, written, release)
+	if err != nil {
+		return EffectiveProxySettings{}, err
+	}
+
+	if legacyObsolete {
+		fmt.Printf("every app on the server has its own proxy settings, removing %s/%s.json\n", proxySettingsDir, legacyProxySettingsRecord)
+		_, _, err = runSSHCommand(client, shellCommand("sudo", "rm", "-f", fmt.Sprintf("%s/%s.json", proxySettingsDir, legacyProxySettingsRecord)), "")
+		if err != nil {
+			return EffectiveProxySettings{}, err
+		}
+	}
+
+	return computeEffectiveProxySettings(records), nil
+}
+
+// readEffectiveProxySettings computes the effective settings across every app still deployed on the host.
+// pending records are applied on top of the records read from the host, so the result is the same whether
+// they were written or not, i.e. in plan mode or when checking for drift.
+func (r *remote) readEffectiveProxySettings(client *ssh.Client, pending []ProxySettingsRecord, release bool) (EffectiveProxySettings, error) {
+	records, _, err := r.readActiveProxySettings(client, pending, release)
+	if err != nil {
+		return EffectiveProxySettings{}, err
+	}
+
+	return computeEffectiveProxySettings(records), nil
+}
+
+// readActiveProxySettings returns the records of every app still deployed on the host with the pending
+// records applied. an obsolete legacy record is left out and reported so the caller can remove it.
+func (r *remote) readActiveProxySettings(client *ssh.Client, pending []ProxySettingsRecord, release bool) ([]ProxySettingsRecord, bool, error) {
+	records, err := readProxySettingsRecords(client)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, record := range pending {
+		records = upsertProxySettingsRecord(records, record)
+	}
+	if release {
+		records = removeProxySettingsRecord(records, r.config.Name)
+	}
+
+	containers, err := listContainerNames(client)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the app being deployed may not have a container yet
+	if !release {
+		containers = append(containers, r.config.Name)
+	}
+
+	active := filterActiveProxySettings(records, containers)
+
+	legacyObsolete := false
+	if len(active) != len(removeProxySettingsRecord(active, legacyProxySettingsRecord)) {
+		webApps, err := listWebAppNames(client)
+		if err != nil {
+			return nil, false, err
+		}
+
+		remaining := []string{}
+		for _, app := range webApps {
+			if !release || app != r.config.Name {
+				remaining = append(remaining, app)
+			}
+		}
+
+		legacyObsolete = legacyProxySettingsObsolete(active, remaining)
+		if legacyObsolete {
+			active = removeProxySettingsRecord(active, legacyProxySettingsRecord)
+		}
+	}
+
+	return active, legacyObsolete, nil
+}
+
+func formatTimeoutSetting(setting TimeoutSetting) string {
+	switch setting.Value {
+	case -1:
+		return "traefik default"
+	case 0:
+		return "unlimited"
+	default:
+		return fmt.Sprintf("%ds", setting.Value)
+	}
+}
+
+func formatFeatureSetting(setting FeatureSetting) string {
+	if setting.Enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func formatDrivenBy(apps []string) string {
+	if len(apps) == 0 {
+		return "-"
+	}
+	return strings.Join(apps, ", ")
+}
+
+func (r *remote) explainProxySettings() error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		records, err := readProxySettingsRecords(client)
+		if err != nil {
+			return err
+		}
+
+		containers, err := listContainerNames(client)
+		if err != nil {
+			return err
+		}
+
+		active := filterActiveProxySettings(records, containers)
+		effective := computeEffectiveProxySettings(active)
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SETTING\tEFFECTIVE\tDRIVEN BY")
+		fmt.Fprintf(w, "readtimeout\t%s\t%s\n", formatTimeoutSetting(effective.ReadTimeout), formatDrivenBy(effective.ReadTimeout.DrivenBy))
+		fmt.Fprintf(w, "writetimeout\t%s\t%s\n", formatTimeoutSetting(effective.WriteTimeout), formatDrivenBy(effective.WriteTimeout.DrivenBy))
+		fmt.Fprintf(w, "idletimeout\t%s\t%s\n", formatTimeoutSetting(effective.IdleTimeout), formatDrivenBy(effective.IdleTimeout.DrivenBy))
+		fmt.Fprintf(w, "dashboard\t%s\t%s\n", formatFeatureSetting(effective.Dashboard), formatDrivenBy(effective.Dashboard.DrivenBy))
+		fmt.Fprintf(w, "accesslog\t%s\t%s\n", formatFeatureSetting(effective.AccessLog), formatDrivenBy(effective.AccessLog.DrivenBy))
+		w.Flush()
+
+		if len(records) != len(active) {
+			fmt.Printf("\n%d record(s) ignored because their app container no longer exists\n", len(records)-len(active))
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeEffectiveProxySettings(t *testing.T) {
+	t.Run("no records uses traefik defaults", func(t *testing.T) {
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{})
+		assert.Equal(t, -1, effective.ReadTimeout.Value)
+		assert.Empty(t, effective.ReadTimeout.DrivenBy)
+		assert.False(t, effective.Dashboard.Enabled)
+	})
+
+	t.Run("highest timeout wins", func(t *testing.T) {
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{
+			{App: "app1", ReadTimeout: 60, WriteTimeout: 300, IdleTimeout: -1},
+			{App: "app2", ReadTimeout: 120, WriteTimeout: 300, IdleTimeout: -1},
+		})
+		assert.Equal(t, 120, effective.ReadTimeout.Value)
+		assert.Equal(t, []string{"app2"}, effective.ReadTimeout.DrivenBy)
+		assert.Equal(t, 300, effective.WriteTimeout.Value)
+		assert.Equal(t, []string{"app1", "app2"}, effective.WriteTimeout.DrivenBy)
+		assert.Equal(t, -1, effective.IdleTimeout.Value)
+	})
+
+	t.Run("unlimited beats any value regardless of order", func(t *testing.T) {
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{
+			{App: "app1", ReadTimeout: 600, WriteTimeout: -1, IdleTimeout: -1},
+			{App: "registry", ReadTimeout: 0, WriteTimeout: -1, IdleTimeout: -1},
+			{App: "zapp", ReadTimeout: 900, WriteTimeout: -1, IdleTimeout: -1},
+		})
+		assert.Equal(t, 0, effective.ReadTimeout.Value)
+		assert.Equal(t, []string{"registry"}, effective.ReadTimeout.DrivenBy)
+	})
+
+	t.Run("feature enabled by any app", func(t *testing.T) {
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{
+			{App: "app1", ReadTimeout: -1, WriteTimeout: -1, IdleTimeout: -1, AccessLog: true},
+			{App: "app2", ReadTimeout: -1, WriteTimeout: -1, IdleTimeout: -1},
+		})
+		assert.True(t, effective.AccessLog.Enabled)
+		assert.Equal(t, []string{"app1"}, effective.AccessLog.DrivenBy)
+		assert.False(t, effective.Dashboard.Enabled)
+	})
+}
+
+func TestFilterActiveProxySettings(t *testing.T) {
+	records := []ProxySettingsRecord{
+		{App: "running"},
+		{App: "destroyed"},
+		{App: legacyProxySettingsRecord},
+	}
+
+	active := filterActiveProxySettings(records, []string{"running", "traefik"})
+	assert.Len(t, active, 2)
+	assert.Equal(t, "running", active[0].App)
+	assert.Equal(t, legacyProxySettingsRecord, active[1].App)
+}
+
+func TestParseWebAppNames(t *testing.T) {
+	output := "app1 traefik.enable=true,traefik.http.routers.app1.rule=Host(`app1.example.com`)\n" +
+		"app1-maintenance traefik.enable=true,traefik.http.routers.app1-maintenance.rule=Host(`app1.example.com`)\n" +
+		"app2 traefik.http.routers.app2.rule=Host(`app2.example.com`),traefik.enable=true\n\n"
+
+	assert.Equal(t, []string{"app1", "app2"}, parseWebAppNames(output))
+}
+
+func TestLegacyProxySettingsObsolete(t *testing.T) {
+	records := []ProxySettingsRecord{{App: "app1"}, {App: legacyProxySettingsRecord}}
+
+	assert.False(t, legacyProxySettingsObsolete(records, []string{"app1", "app2"}))
+	assert.True(t, legacyProxySettingsObsolete(append(records, ProxySettingsRecord{App: "app2"}), []string{"app1", "app2"}))
+	assert.False(t, legacyProxySettingsObsolete([]ProxySettingsRecord{{App: "app1"}}, []string{"app1"}))
+}
+
+func TestParseProxySettingsRecords(t *testing.T) {
+	records, err := parseProxySettingsRecords("{\"app\":\"app1\",\"readtimeout\":0,\"writetimeout\":-1,\"idletimeout\":-1,\"dashboard\":true,\"accesslog\":false}\n\n")
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "app1", records[0].App)
+	assert.Equal(t, 0, records[0].ReadTimeout)
+	assert.True(t, records[0].Dashboard)
+
+	_, err = parseProxySettingsRecords("{broken")
+	assert.Error(t, err)
+}
+
+func TestLegacyProxySettingsFromConfig(t *testing.T) {
+	config := buildTraefikConfig("test@example.com", WebAdvancedConfig{ReadTimeout: 0, WriteTimeout: 120, IdleTimeout: -1})
+	record, found := legacyProxySettingsFromConfig(config)
+	assert.True(t, found)
+	assert.Equal(t, 0, record.ReadTimeout)
+	assert.Equal(t, 120, record.WriteTimeout)
+	assert.Equal(t, -1, record.IdleTimeout)
+
+	_, found = legacyProxySettingsFromConfig(buildTraefikConfig("test@example.com", WebAdvancedConfig{ReadTimeout: -1, WriteTimeout: -1, IdleTimeout: -1}))
+	assert.False(t, found)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAccessLogLine(t *testing.T) {
+	line := `{"StartUTC":"2024-05-01T10:00:00.123Z","RouterName":"myapp@docker","ClientHost":"1.2.3.4","RequestMethod":"GET","RequestHost":"myapp.example.com","RequestPath":"/health","DownstreamStatus":200,"Duration":1500000}`
+
+	t.Run("matching router", func(t *testing.T) {
+		formatted, ok := formatAccessLogLine(line, "myapp")
+		assert.True(t, ok)
+		assert.Contains(t, formatted, "myapp 1.2.3.4 200 GET myapp.example.com/health 2ms")
+	})
+
+	t.Run("other router is skipped", func(t *testing.T) {
+		_, ok := formatAccessLogLine(line, "other")
+		assert.False(t, ok)
+	})
+
+	t.Run("all routers", func(t *testing.T) {
+		_, ok := formatAccessLogLine(line, "all")
+		assert.True(t, ok)
+	})
+
+	t.Run("invalid json is skipped", func(t *testing.T) {
+		_, ok := formatAccessLogLine("not json", "all")
+		assert.False(t, ok)
+	})
+}
+
+func TestApplyProxyFeatures(t *testing.T) {
+	config := buildTraefikConfig("test@example.com", WebAdvancedConfig{ReadTimeout: -1, WriteTimeout: -1, IdleTimeout: -1})
+
+	applyProxyFeatures(config, ProxyConfig{Dashboard: true, AccessLog: true})
+	yamlStr, err := config.serialize()
+	assert.NoError(t, err)
+	assert.Contains(t, yamlStr, "dashboard: true")
+	assert.Contains(t, yamlStr, "filePath: /var/log/traefik/access.log")
+	assert.Contains(t, yamlStr, "format: json")
+
+	applyProxyFeatures(config, ProxyConfig{})
+	yamlStr, err = config.serialize()
+	assert.NoError(t, err)
+	assert.NotContains(t, yamlStr, "api:")
+	assert.NotContains(t, yamlStr, "accessLog:")
+}
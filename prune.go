@@ -0,0 +1,517 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// label added to every image lord builds so releases of each app can be found on the host
+const lordAppLabel = "lord.app"
+
+// HostImage is an image on the host as reported by docker image inspect
+type HostImage struct {
+	ID      string
+	App     string
+	Created time.Time
+	Size    int64
+	Tags    []string
+}
+
+// RegistryManifest is an image manifest stored in a registry repository
+type RegistryManifest struct {
+	Digest string
+	Tags   []string
+	Size   int64
+	Pushed time.Time
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// hostImageInspectFormat outputs one pipe separated line per image for parseHostImages
+var hostImageInspectFormat = fmt.Sprintf("{{.Id}}|{{with .Config.Labels}}{{index . \"%s\"}}{{end}}|{{.Created}}|{{.Size}}|{{join .RepoTags \",\"}}", lordAppLabel)
+
+func parseHostImages(output string) ([]HostImage, error) {
+	images := []HostImage{}
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "|")
+		if len(parts) != 5 {
+			return nil, fmt.Errorf("malformed image inspect output: %s", line)
+		}
+
+		// the same image is listed once per tag
+		if seen[parts[0]] {
+			continue
+		}
+		seen[parts[0]] = true
+
+		created, err := time.Parse(time.RFC3339Nano, parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed image creation time %s: %v", parts[2], err)
+		}
+
+		size, err := strconv.ParseInt(parts[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed image size %s: %v", parts[3], err)
+		}
+
+		tags := []string{}
+		if parts[4] != "" {
+			tags = strings.Split(parts[4], ",")
+		}
+
+		images = append(images, HostImage{
+			ID:      parts[0],
+			App:     parts[1],
+			Created: created,
+			Size:    size,
+			Tags:    tags,
+		})
+	}
+
+	return images, nil
+}
+
+// planHostImagePrune returns the images to delete. the newest keep images of each lord app are kept, images
+// used by any container are never deleted and untagged images that don't belong to a lord app are removed
+// the same way docker image prune would. tagged images that lord didn't build are left alone.
+func planHostImagePrune(images []HostImage, inUse map[string]bool, keep int) []HostImage {
+	byApp := map[string][]HostImage{}
+	prune := []HostImage{}
+
+	for _, image := range images {
+		if inUse[image.ID] {
+			continue
+		}
+
+		if image.App == "" {
+			if len(image.Tags) == 0 {
+				prune = append(prune, image)
+			}
+			continue
+		}
+
+		byApp[image.App] = append(byApp[image.App], image)
+	}
+
+	// in use images still count towards the kept releases
+	for _, image := range images {
+		if inUse[image.ID] && image.App != "" {
+			byApp[image.App] = append(byApp[image.App], image)
+		}
+	}
+
+	apps := []string{}
+	for app := range byApp {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	for _, app := range apps {
+		appImages := byApp[app]
+		sort.SliceStable(appImages, func(i, j int) bool {
+			return appImages[i].Created.After(appImages[j].Created)
+		})
+
+		for i, image := range appImages {
+			if i >= keep && !inUse[image.ID] {
+				prune = append(prune, image)
+			}
+		}
+	}
+
+	return prune
+}
+
+// planRegistryPrune returns the manifests to delete, keeping the newest keep manifests and anything tagged latest
+func planRegistryPrune(manifests []RegistryManifest, keep int) []RegistryManifest {
+	sorted := append([]RegistryManifest{}, manifests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Pushed.After(sorted[j].Pushed)
+	})
+
+	prune := []RegistryManifest{}
+	for i, manifest := range sorted {
+		isLatest := false
+		for _, tag := range manifest.Tags {
+			if tag == "latest" {
+				isLatest = true
+			}
+		}
+
+		if i >= keep && !isLatest {
+			prune = append(prune, manifest)
+		}
+	}
+
+	return prune
+}
+
+// registryRepository returns the repository path of the app image within the registry
+func registryRepository(registryUrl string, name string) string {
+	url := strings.TrimPrefix(strings.TrimPrefix(registryUrl, "https://"), "http://")
+	path := strings.Trim(strings.TrimPrefix(url, registryHost(url)), "/")
+	if path == "" {
+		return name
+	}
+	return fmt.Sprintf("%s/%s", path, name)
+}
+
+func parseEcrImages(output string) ([]RegistryManifest, error) {
+	var result struct {
+		ImageDetails []struct {
+			ImageDigest      string   `json:"imageDigest"`
+			ImageTags        []string `json:"imageTags"`
+			ImageSizeInBytes int64    `json:"imageSizeInBytes"`
+			ImagePushedAt    string   `json:"imagePushedAt"`
+		} `json:"imageDetails"`
+	}
+
+	err := json.Unmarshal([]byte(output), &result)
+	if err != nil {
+		return nil, fmt.Errorf("malformed ecr image list: %v", err)
+	}
+
+	manifests := []RegistryManifest{}
+	for _, detail := range result.ImageDetails {
+		pushed, err := time.Parse(time.RFC3339Nano, detail.ImagePushedAt)
+		if err != nil {
+			return nil, fmt.Errorf("malformed ecr push time %s: %v", detail.ImagePushedAt, err)
+		}
+
+		manifests = append(manifests, RegistryManifest{
+			Digest: detail.ImageDigest,
+			Tags:   detail.ImageTags,
+			Size:   detail.ImageSizeInBytes,
+			Pushed: pushed,
+		})
+	}
+
+	return manifests, nil
+}
+
+func parseDigitalOceanManifests(output string) ([]RegistryManifest, error) {
+	var result []struct {
+		Digest              string   `json:"digest"`
+		Tags                []string `json:"tags"`
+		CompressedSizeBytes int64    `json:"compressed_size_bytes"`
+		UpdatedAt           string   `json:"updated_at"`
+	}
+
+	err := json.Unmarshal([]byte(output), &result)
+	if err != nil {
+		return nil, fmt.Errorf("malformed digitalocean manifest list: %v", err)
+	}
+
+	manifests := []RegistryManifest{}
+	for _, entry := range result {
+		pushed, err := time.Parse(time.RFC3339Nano, entry.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("malformed digitalocean manifest time %s: %v", entry.UpdatedAt, err)
+		}
+
+		manifests = append(manifests, RegistryManifest{
+			Digest: entry.Digest,
+			Tags:   entry.Tags,
+			Size:   entry.CompressedSizeBytes,
+			Pushed: pushed,
+		})
+	}
+
+	return manifests, nil
+}
+
+func listHostImagesInUse(client *ssh.Client) (map[string]bool, error) {
+	output, _, err := runSSHQuery(client, "sudo docker ps -aq | xargs -r sudo docker inspect --format '{{.Image}}'", "")
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := map[string]bool{}
+	for _, id := range strings.Split(output, "\n") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			inUse[id] = true
+		}
+	}
+
+	return inUse, nil
+}
+
+// pruneImages removes old releases and unused untagged images from the host
+func (r *remote) pruneImages(keep int, dryRun bool) error {
+	if keep < 1 {
+		return fmt.Errorf("prune.keep must be at least 1, got %d", keep)
+	}
+
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("checking images on server")
+
+		inspectCmd := shellPipe(
+			shellCommand("sudo", "docker", "image", "ls", "-q", "--no-trunc"),
+			"sort -u",
+			shellCommand("xargs", "-r", "sudo", "docker", "image", "inspect", "--format", hostImageInspectFormat),
+		)
+		output, _, err := runSSHQuery(client, inspectCmd, "")
+		if err != nil {
+			return fmt.Errorf("failed to list images: %v", err)
+		}
+
+		images, err := parseHostImages(output)
+		if err != nil {
+			return err
+		}
+
+		inUse, err := listHostImagesInUse(client)
+		if err != nil {
+			return fmt.Errorf("failed to list images in use: %v", err)
+		}
+
+		prune := planHostImagePrune(images, inUse, keep)
+		if len(prune) == 0 {
+			fmt.Println("no images to prune on server")
+			return nil
+		}
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "APP\tIMAGE\tCREATED\tSIZE")
+		var total int64
+		for _, image := range prune {
+			app := image.App
+			if app == "" {
+				app = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", app, shortDigest(image.ID), image.Created.Local().Format("2006-01-02 15:04"), formatBytes(image.Size))
+			total += image.Size
+		}
+		w.Flush()
+		fmt.Println()
+
+		// image sizes include layers shared with kept images, so the real saving can be lower
+		if dryRun {
+			fmt.Printf("dry run: would delete %d image(s) from the server, freeing up to %s\n", len(prune), formatBytes(total))
+			return nil
+		}
+
+		deleted := 0
+		for _, image := range prune {
+			_, _, err := runSSHCommand(client, shellCommand("sudo", "docker", "rmi", "--force", image.ID), "")
+			if err != nil {
+				fmt.Printf("warning: failed to delete image %s: %v\n", shortDigest(image.ID), err)
+				continue
+			}
+			deleted++
+		}
+
+		fmt.Printf("deleted %d image(s) from the server, freeing up to %s\n", deleted, formatBytes(total))
+
+		return nil
+	})
+}
+
+func printRegistryPrune(prune []RegistryManifest, dryRun bool) int64 {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DIGEST\tTAGS\tPUSHED\tSIZE")
+	var total int64
+	for _, manifest := range prune {
+		tags := strings.Join(manifest.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", shortDigest(manifest.Digest), tags, manifest.Pushed.Local().Format("2006-01-02 15:04"), formatBytes(manifest.Size))
+		total += manifest.Size
+	}
+	w.Flush()
+	fmt.Println()
+
+	if dryRun {
+		fmt.Printf("dry run: would delete %d image(s) from the registry, freeing up to %s\n", len(prune), formatBytes(total))
+	}
+
+	return total
+}
+
+const ecrBatchDeleteLimit = 100
+
+// registryDeleteCommands builds the provider cli commands deleting the given digests from a repository
+func registryDeleteCommands(registryType Registry, repository string, region string, digests []string) []string {
+	switch registryType {
+	case RegistryEcr:
+		// batch-delete-image accepts at most ecrBatchDeleteLimit image ids per call
+		cmds := []string{}
+		for start := 0; start < len(digests); start += ecrBatchDeleteLimit {
+			end := min(start+ecrBatchDeleteLimit, len(digests))
+			args := []string{"aws", "ecr", "batch-delete-image", "--repository-name", repository, "--region", region, "--image-ids"}
+			for _, digest := range digests[start:end] {
+				args = append(args, fmt.Sprintf("imageDigest=%s", digest))
+			}
+			cmds = append(cmds, shellCommand(args...))
+		}
+		return cmds
+	case RegistryDigitalOcean:
+		args := append([]string{"doctl", "registry", "repository", "delete-manifest", repository}, digests...)
+
+		// digitalocean only frees the space once garbage collection runs
+		return []string{
+			shellCommand(append(args, "--force")...),
+			"doctl registry garbage-collection start --include-untagged-manifests --force",
+		}
+	}
+
+	return []string{}
+}
+
+// pruneRegistry deletes old images of the app from the registry using the provider cli on the server, so the
+// same credentials from the host environment file are used
+func (r *remote) pruneRegistry(keep int, dryRun bool) error {
+	if keep < 1 {
+		return fmt.Errorf("prune.keep must be at least 1, got %d", keep)
+	}
+
+	// lord:// registries were resolved to the hosted registry along with its credentials
+	if r.config.registryPassword != "" {
+		return r.pruneHostedRegistry(keep, dryRun)
+	}
+
+	registryType := detectRegistryType(r.config.Registry)
+	if registryType != RegistryEcr && registryType != RegistryDigitalOcean {
+		fmt.Printf("registry cleanup is not supported for %s, nothing is pruned in the registry\n", registryHost(r.config.Registry))
+		return nil
+	}
+
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("checking images in registry")
+
+		repository := registryRepository(r.config.Registry, r.config.Name)
+
+		var listCmd string
+		switch registryType {
+		case RegistryEcr:
+			region, err := extractAwsRegion(r.config.Registry)
+			if err != nil {
+				return err
+			}
+			listCmd = shellCommand("aws", "ecr", "describe-images", "--repository-name", repository, "--region", region, "--output", "json")
+		case RegistryDigitalOcean:
+			// doctl addresses repositories within the account's registry by name only
+			repository = r.config.Name
+			listCmd = shellCommand("doctl", "registry", "repository", "list-manifests", repository, "--output", "json")
+		}
+
+		output, _, err := runSSHQuery(client, listCmd, r.config.Name)
+		if err != nil {
+			return fmt.Errorf("failed to list registry images: %v", err)
+		}
+
+		var manifests []RegistryManifest
+		if registryType == RegistryEcr {
+			manifests, err = parseEcrImages(output)
+		} else {
+			manifests, err = parseDigitalOceanManifests(output)
+		}
+		if err != nil {
+			return err
+		}
+
+		prune := planRegistryPrune(manifests, keep)
+		if len(prune) == 0 {
+			fmt.Println("no images to prune in registry")
+			return nil
+		}
+
+		total := printRegistryPrune(prune, dryRun)
+		if dryRun {
+			return nil
+		}
+
+		digests := []string{}
+		for _, manifest := range prune {
+			digests = append(digests, manifest.Digest)
+		}
+
+		region, _ := extractAwsRegion(r.config.Registry)
+		for _, cmd := range registryDeleteCommands(registryType, repository, region, digests) {
+			_, _, err := runSSHCommand(client, cmd, r.config.Name)
+			if err != nil {
+				return fmt.Errorf("failed to delete registry images: %v", err)
+			}
+		}
+
+		fmt.Printf("deleted %d image(s) from the registry, freeing up to %s\n", len(prune), formatBytes(total))
+
+		return nil
+	})
+}
+
+// pruneHostedRegistry deletes old manifests from the lord hosted registry through its api, the weekly garbage
+// collection on the registry server then frees their layers
+func (r *remote) pruneHostedRegistry(keep int, dryRun bool) error {
+	fmt.Println("checking images in registry")
+
+	registry := newRegistryClient(r.config.Registry, r.config.registryUsername, r.config.registryPassword)
+	repository := registryRepository(r.config.Registry, r.config.Name)
+
+	manifests, err := registry.listManifests(repository)
+	if err != nil {
+		return fmt.Errorf("failed to list registry images: %v", err)
+	}
+
+	prune := planRegistryPrune(manifests, keep)
+	if len(prune) == 0 {
+		fmt.Println("no images to prune in registry")
+		return nil
+	}
+
+	total := printRegistryPrune(prune, dryRun)
+	if dryRun {
+		return nil
+	}
+
+	for _, manifest := range prune {
+		err := registry.deleteManifest(repository, manifest.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to delete registry images: %v", err)
+		}
+	}
+
+	fmt.Printf("deleted %d image(s) from the registry, up to %s is freed by the next weekly garbage collection\n", len(prune), formatBytes(total))
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.0KB", formatBytes(1024))
+	assert.Equal(t, "1.5MB", formatBytes(1572864))
+	assert.Equal(t, "2.0GB", formatBytes(2147483648))
+}
+
+func TestParseHostImages(t *testing.T) {
+	output := `sha256:aaa|myapp|2024-05-01T10:00:00.123456789Z|1048576|lorddirect/myapp:latest
+sha256:bbb||2024-04-01T10:00:00Z|2048|
+sha256:aaa|myapp|2024-05-01T10:00:00.123456789Z|1048576|lorddirect/myapp:latest
+sha256:ccc||2024-03-01T10:00:00Z|4096|nginx:alpine,nginx:latest
+`
+
+	images, err := parseHostImages(output)
+	assert.NoError(t, err)
+	assert.Len(t, images, 3)
+	assert.Equal(t, "myapp", images[0].App)
+	assert.Equal(t, int64(1048576), images[0].Size)
+	assert.Equal(t, []string{"lorddirect/myapp:latest"}, images[0].Tags)
+	assert.Equal(t, []string{}, images[1].Tags)
+	assert.Equal(t, []string{"nginx:alpine", "nginx:latest"}, images[2].Tags)
+
+	_, err = parseHostImages("sha256:aaa|myapp|notatime|1|")
+	assert.Error(t, err)
+}
+
+func TestPlanHostImagePrune(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	images := []HostImage{
+		{ID: "app1", App: "myapp", Created: day(1)},
+		{ID: "app2", App: "myapp", Created: day(2)},
+		{ID: "app3", App: "myapp", Created: day(3)},
+		{ID: "app4", App: "myapp", Created: day(4), Tags: []string{"lorddirect/myapp:latest"}},
+		{ID: "other1", App: "other", Created: day(1)},
+		{ID: "dangling", Created: day(1)},
+		{ID: "nginx", Created: day(1), Tags: []string{"nginx:alpine"}},
+		{ID: "danglingused", Created: day(1)},
+	}
+
+	inUse := map[string]bool{"app1": true, "danglingused": true}
+
+	prune := planHostImagePrune(images, inUse, 2)
+
+	ids := []string{}
+	for _, image := range prune {
+		ids = append(ids, image.ID)
+	}
+
+	// app1 is old but still used by a container, app2 falls outside the newest two
+	assert.Equal(t, []string{"dangling", "app2"}, ids)
+}
+
+func TestPlanRegistryPrune(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	manifests := []RegistryManifest{
+		{Digest: "sha256:1", Pushed: day(1), Tags: []string{"latest"}},
+		{Digest: "sha256:2", Pushed: day(2)},
+		{Digest: "sha256:3", Pushed: day(3)},
+		{Digest: "sha256:4", Pushed: day(4)},
+	}
+
+	prune := planRegistryPrune(manifests, 2)
+	assert.Len(t, prune, 1)
+	assert.Equal(t, "sha256:2", prune[0].Digest)
+}
+
+func TestRegistryRepository(t *testing.T) {
+	assert.Equal(t, "me/myapp", registryRepository("123456789012.dkr.ecr.us-east-1.amazonaws.com/me", "myapp"))
+	assert.Equal(t, "myapp", registryRepository("123456789012.dkr.ecr.us-east-1.amazonaws.com", "myapp"))
+	assert.Equal(t, "org/team/myapp", registryRepository("https://ghcr.io/org/team/", "myapp"))
+}
+
+func TestParseEcrImages(t *testing.T) {
+	output := `{"imageDetails": [{"imageDigest": "sha256:abc", "imageTags": ["latest"], "imageSizeInBytes": 1000, "imagePushedAt": "2024-05-01T10:00:00+00:00"}, {"imageDigest": "sha256:def", "imageSizeInBytes": 2000, "imagePushedAt": "2024-04-01T10:00:00.5+00:00"}]}`
+
+	manifests, err := parseEcrImages(output)
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 2)
+	assert.Equal(t, []string{"latest"}, manifests[0].Tags)
+	assert.Equal(t, int64(2000), manifests[1].Size)
+	assert.Equal(t, 2024, manifests[1].Pushed.Year())
+}
+
+func TestParseDigitalOceanManifests(t *testing.T) {
+	output := `[{"digest": "sha256:abc", "compressed_size_bytes": 3000, "size_bytes": 9000, "updated_at": "2024-05-01T10:00:00Z", "tags": ["latest"]}]`
+
+	manifests, err := parseDigitalOceanManifests(output)
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 1)
+	assert.Equal(t, "sha256:abc", manifests[0].Digest)
+	assert.Equal(t, int64(3000), manifests[0].Size)
+
+	_, err = parseDigitalOceanManifests("not json")
+	assert.Error(t, err)
+}
+
+func TestRegistryDeleteCommands(t *testing.T) {
+	assert.Equal(t, []string{
+		"aws ecr batch-delete-image --repository-name my/app --region us-east-1 --image-ids imageDigest=sha256:aaa imageDigest=sha256:bbb",
+	}, registryDeleteCommands(RegistryEcr, "my/app", "us-east-1", []string{"sha256:aaa", "sha256:bbb"}))
+
+	// ecr deletes at most 100 images per call
+	digests := []string{}
+	for i := 0; i < 250; i++ {
+		digests = append(digests, fmt.Sprintf("sha256:%03d", i))
+	}
+	cmds := registryDeleteCommands(RegistryEcr, "my/app", "us-east-1", digests)
+	if assert.Len(t, cmds, 3) {
+		assert.Equal(t, 100, strings.Count(cmds[0], "imageDigest="))
+		assert.Equal(t, 100, strings.Count(cmds[1], "imageDigest="))
+		assert.Equal(t, 50, strings.Count(cmds[2], "imageDigest="))
+		assert.Contains(t, cmds[0], "imageDigest=sha256:000 ")
+		assert.True(t, strings.HasSuffix(cmds[0], "imageDigest=sha256:099"))
+		assert.Contains(t, cmds[1], "imageDigest=sha256:100 ")
+		assert.True(t, strings.HasSuffix(cmds[2], "imageDigest=sha256:249"))
+	}
+
+	// values from the registry are quoted so they can't run commands on the server
+	assert.Equal(t, []string{
+		"doctl registry repository delete-manifest 'my app;reboot' 'sha256:aaa$(id)' --force",
+		"doctl registry garbage-collection start --include-untagged-manifests --force",
+	}, registryDeleteCommands(RegistryDigitalOcean, "my app;reboot", "", []string{"sha256:aaa$(id)"}))
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// label holding the checksum of the env file a container was started with, docker doesn't record the file
+const lordEnvChecksumLabel = "lord.env.sha256"
+
+// network containers join when no network is given
+const defaultNetwork = "default"
+
+// ContainerSpec is the state of an app container that lord manages. it is computed from the config for the
+// desired state and read back with docker inspect for the current state.
+type ContainerSpec struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+
+	// traefik routing labels and the env checksum. provenance labels change on every deploy and image labels
+	// are inherited by the container, so neither is part of the spec.
+	Labels map[string]string `json:"labels"`
+
+	Volumes       []string `json:"volumes"`
+	Network       string   `json:"network"`
+	RestartPolicy string   `json:"restartPolicy"`
+
+	// path of the env file on the host, only known for the desired state
+	EnvironmentFile string `json:"environmentFile,omitempty"`
+}
+
+// isManagedLabel reports whether a label is part of the container spec
+func isManagedLabel(key string) bool {
+	return strings.HasPrefix(key, "traefik.") || key == lordEnvChecksumLabel
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// traefikLabels routes the app hostname (and its www subdomain) to the container port over https
+func traefikLabels(name string, hostname string, port int, advanced WebAdvancedConfig) map[string]string {
+	// configs built in code rather than loaded have no default applied
+	if port == 0 {
+		port = defaultWebPort
+	}
+
+	labels := map[string]string{
+		"traefik.enable": "true",
+		fmt.Sprintf("traefik.http.routers.%s.rule", name):                      hostRule(hostname),
+		fmt.Sprintf("traefik.http.routers.%s.entryPoints", name):               "websecure",
+		fmt.Sprintf("traefik.http.routers.%s.tls.certresolver", name):          "theresolver",
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", name): fmt.Sprintf("%d", port),
+	}
+
+	// web advanced config - buffering settings
+	buffering := map[string]int{
+		"maxrequestbodybytes":  advanced.MaxRequestBodyBytes,
+		"maxresponsebodybytes": advanced.MaxResponseBodyBytes,
+		"memrequestbodybytes":  advanced.MemRequestBodyBytes,
+	}
+
+	hasBuffering := false
+	for setting, value := range buffering {
+		if value != -1 {
+			labels[fmt.Sprintf("traefik.http.middlewares.%s-buffering.buffering.%s", name, setting)] = fmt.Sprintf("%d", value)
+			hasBuffering = true
+		}
+	}
+
+	// apply the buffering middleware to the router
+	if hasBuffering {
+		labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", name)] = fmt.Sprintf("%s-buffering", name)
+	}
+
+	return labels
+}
+
+// containerSpec computes the desired container for an app from its config
+func containerSpec(c *Config, imageTag string, environmentChecksum string) ContainerSpec {
+	spec := ContainerSpec{
+		Name:          c.Name,
+		Image:         imageTag,
+		Labels:        map[string]string{},
+		Volumes:       append([]string{fmt.Sprintf("/var/%s:/data", c.Name)}, c.Volumes...),
+		Network:       defaultNetwork,
+		RestartPolicy: "unless-stopped",
+	}
+
+	if c.Web {
+		spec.Labels = traefikLabels(c.Name, c.Hostname, c.Port, c.WebAdvancedConfig)
+		spec.Network = "traefik"
+	}
+
+	if c.EnvironmentFile != "" {
+		spec.EnvironmentFile = fmt.Sprintf("/etc/%s/%s.env", c.Name, c.Name)
+		spec.Labels[lordEnvChecksumLabel] = environmentChecksum
+	}
+
+	return spec
+}
+
+// environmentChecksum returns the sha256 of the app's env file as uploaded (decrypted), empty without one
+func environmentChecksum(c *Config) (string, error) {
+	if c.EnvironmentFile == "" {
+		return "", nil
+	}
+
+	content, err := readEnvironmentFile(c, c.EnvironmentFile)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RunningContainer is an app container as found on the host
+type RunningContainer struct {
+	Spec    ContainerSpec
+	Running bool
+
+	// id of the image the container was created from, the image reference may have moved on since
+	ImageID string
+
+	// revision, source and branch labels of the deploy that created the container
+	Provenance map[string]string
+}
+
+// provenance labels describing the commit a container runs
+var provenanceLabels = []string{ociRevisionLabel, ociSourceLabel, lordBranchLabel}
+
+// containerInspect holds the fields of docker inspect output reconcile compares
+type containerInspect struct {
+	Name  string
+	Image string
+	State struct {
+		Running bool
+		Status  string
+	}
+	Config struct {
+		Image  string
+		Labels map[string]string
+	}
+	HostConfig struct {
+		Binds         []string
+		NetworkMode   string
+		RestartPolicy struct {
+			Name string
+		}
+	}
+}
+
+// parseContainerInspect reads the current container spec from docker inspect json output
+func parseContainerInspect(output string) (*RunningContainer, error) {
+	inspected := []containerInspect{}
+	err := json.Unmarshal([]byte(output), &inspected)
+	if err != nil {
+		return nil, fmt.Errorf("malformed docker inspect output: %v", err)
+	}
+	if len(inspected) != 1 {
+		return nil, fmt.Errorf("expected one container in docker inspect output, found %d", len(inspected))
+	}
+
+	container := inspected[0]
+
+	labels := map[string]string{}
+	for key, value := range container.Config.Labels {
+		if isManagedLabel(key) {
+			labels[key] = value
+		}
+	}
+
+	provenance := map[string]string{}
+	for _, key := range provenanceLabels {
+		if value, ok := container.Config.Labels[key]; ok {
+			provenance[key] = value
+		}
+	}
+
+	// docker reports the default bridge network as either name
+	network := container.HostConfig.NetworkMode
+	if network == "bridge" || network == "" {
+		network = defaultNetwork
+	}
+
+	volumes := container.HostConfig.Binds
+	if volumes == nil {
+		volumes = []string{}
+	}
+
+	return &RunningContainer{
+		Spec: ContainerSpec{
+			Name:          strings.TrimPrefix(container.Name, "/"),
+			Image:         container.Config.Image,
+			Labels:        labels,
+			Volumes:       volumes,
+			Network:       network,
+			RestartPolicy: container.HostConfig.RestartPolicy.Name,
+		},
+		Running:    container.State.Running,
+		ImageID:    container.Image,
+		Provenance: provenance,
+	}, nil
+}
+
+// diffContainerSpecs lists every difference between the desired and current container, empty when the
+// container matches the config
+func diffContainerSpecs(desired ContainerSpec, current *RunningContainer) []string {
+	if current == nil {
+		return []string{"container: missing"}
+	}
+
+	diff := []string{}
+
+	if !current.Running {
+		diff = append(diff, "container: not running")
+	}
+
+	if desired.Image != current.Spec.Image {
+		diff = append(diff, fmt.Sprintf("image: %s -> %s", current.Spec.Image, desired.Image))
+	}
+
+	keys := map[string]string{}
+	for key := range desired.Labels {
+		keys[key] = ""
+	}
+	for key := range current.Spec.Labels {
+		keys[key] = ""
+	}
+
+	for _, key := range sortedKeys(keys) {
+		want, wanted := desired.Labels[key]
+		have, has := current.Spec.Labels[key]
+
+		switch {
+		case key == lordEnvChecksumLabel && want != have:
+			diff = append(diff, "env file: changed")
+		case !has:
+			diff = append(diff, fmt.Sprintf("label %s: added %s", key, want))
+		case !wanted:
+			diff = append(diff, fmt.Sprintf("label %s: removed (was %s)", key, have))
+		case want != have:
+			diff = append(diff, fmt.Sprintf("label %s: %s -> %s", key, have, want))
+		}
+	}
+
+	wantVolumes := map[string]bool{}
+	for _, volume := range desired.Volumes {
+		wantVolumes[volume] = true
+	}
+	haveVolumes := map[string]bool{}
+	for _, volume := range current.Spec.Volumes {
+		haveVolumes[volume] = true
+	}
+
+	for _, volume := range desired.Volumes {
+		if !haveVolumes[volume] {
+			diff = append(diff, fmt.Sprintf("volume: added %s", volume))
+		}
+	}
+	for _, volume := range current.Spec.Volumes {
+		if !wantVolumes[volume] {
+			diff = append(diff, fmt.Sprintf("volume: removed %s", volume))
+		}
+	}
+
+	if desired.Network != current.Spec.Network {
+		diff = append(diff, fmt.Sprintf("network: %s -> %s", current.Spec.Network, desired.Network))
+	}
+
+	if desired.RestartPolicy != current.Spec.RestartPolicy {
+		diff = append(diff, fmt.Sprintf("restart policy: %s -> %s", current.Spec.RestartPolicy, desired.RestartPolicy))
+	}
+
+	return diff
+}
+
+// isMissingContainerError reports whether docker failed because the container doesn't exist, as opposed to
+// docker or ssh failing
+func isMissingContainerError(stderr string) bool {
+	return strings.Contains(strings.ToLower(stderr), "no such container")
+}
+
+// inspectContainer reads the current state of a container, nil if it doesn't exist
+func inspectContainer(client *ssh.Client, name string) (*RunningContainer, error) {
+	output, stderr, err := runSSHQuery(client, shellCommand("sudo", "docker", "inspect", "--type", "container", name), "")
+	if err != nil && isMissingContainerError(stderr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %v %s", name, err, strings.TrimSpace(stderr))
+	}
+
+	return parseContainerInspect(output)
+}
+
+// traefikDrift diffs the traefik config on the host against the config a deploy of this app would leave
+func (r *remote) traefikDrift(client *ssh.Client, email string) ([]string, error) {
+	stdOut, _, err := runSSHQuery(client, "sudo docker ps --filter name=traefik --format \"{{.Names}}\"", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(stdOut, "traefik") {
+		return []string{"traefik: not running"}, nil
+	}
+
+	currentTraefikConfigRaw, _, err := runSSHQuery(client, "sudo cat /etc/traefik/traefik.yml", "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading traefik config: %s", err)
+	}
+
+	currentTraefikConfig, err := readTraefikConfig(currentTraefikConfigRaw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing traefik config: %s", err)
+	}
+
+	effective, err := r.readEffectiveProxySettings(client, []ProxySettingsRecord{r.proxySettingsRecord()}, false)
+	if err != nil {
+		return nil, fmt.Errorf("error computing global proxy settings: %s", err)
+	}
+
+	desiredTraefikConfig, err := reconcileTraefikConfig(currentTraefikConfig, resolverEmail(currentTraefikConfig, r.config.Proxy.Email, email), effective)
+	if err != nil {
+		return nil, fmt.Errorf("error reconciling traefik config: %s", err)
+	}
+
+	diff, err := diffTraefikConfigs(currentTraefikConfig, desiredTraefikConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing traefik configs: %s", err)
+	}
+
+	if len(diff) == 0 {
+		return []string{}, nil
+	}
+
+	return append([]string{"traefik config: /etc/traefik/traefik.yml differs"}, diff...), nil
+}
+
+// DriftReport is the result of lord drift --json
+type DriftReport struct {
+	App         string   `json:"app"`
+	Drifted     bool     `json:"drifted"`
+	Differences []string `json:"differences"`
+}
+
+// reportDrift prints how the host differs from the config without changing anything, it returns an error
+// when anything differs so scripts can fail on drift
+func (r *remote) reportDrift(desired ContainerSpec, asJson bool) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		current, err := inspectContainer(client, desired.Name)
+		if err != nil {
+			return err
+		}
+
+		diff := diffContainerSpecs(desired, current)
+
+		if r.config.Web {
+			traefikDiff, err := r.traefikDrift(client, r.config.Email)
+			if err != nil {
+				return err
+			}
+			diff = append(diff, traefikDiff...)
+		}
+
+		if asJson {
+			err = writeJson(DriftReport{App: desired.Name, Drifted: len(diff) > 0, Differences: diff})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(diff) == 0 {
+			fmt.Printf("%s matches the config, no drift\n", desired.Name)
+			return nil
+		}
+
+		fmt.Printf("\n%s has drifted from the config:\n", desired.Name)
+		for _, line := range diff {
+			fmt.Printf("  %s\n", line)
+		}
+		fmt.Println()
+
+		return fmt.Errorf("%d differences found, run lord sync to apply the config", len(diff))
+	})
+}
+
+// imageRepositoryOf strips the tag from an image reference, a registry port is not mistaken for a tag
+func imageRepositoryOf(image string) string {
+	i := strings.LastIndex(image, ":")
+	if i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// syncFallbackImage returns the image sync keeps when the commit tag of the checkout isn't available, which
+// happens whenever HEAD has commits that were never deployed. only another tag of the same repository running
+// in the current container is kept.
+func syncFallbackImage(desiredImage string, current *RunningContainer) (string, bool) {
+	if current == nil || current.Spec.Image == "" || current.Spec.Image == desiredImage {
+		return "", false
+	}
+	if imageRepositoryOf(current.Spec.Image) != imageRepositoryOf(desiredImage) {
+		return "", false
+	}
+	return current.Spec.Image, true
+}
+
+// syncLabels are the labels a synced container is started with. when sync keeps the running image the
+// provenance of that image is kept instead of the checkout's.
+func syncLabels(git *GitState, current *RunningContainer, keptRunningImage bool, deployer string, now time.Time) []string {
+	if !keptRunningImage {
+		return deployLabels(git, deployer, now)
+	}
+
+	labels := deployLabels(nil, deployer, now)
+	for _, key := range sortedKeys(current.Provenance) {
+		labels = append(labels, fmt.Sprintf("%s=%s", key, current.Provenance[key]))
+	}
+	return labels
+}
+
+// syncContainer recreates the app container only when it differs from the desired spec. the image must
+// already exist, it is pulled from the registry or must have been loaded onto the host by a deploy. when the
+// image is the commit tag of the checkout (git is set) and isn't available, the running image is kept.
+func (r *remote) syncContainer(desired ContainerSpec, git *GitState) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		current, err := inspectContainer(client, desired.Name)
+		if err != nil {
+			return err
+		}
+
+		keptRunningImage := false
+		keepRunningImage := func(reason error) error {
+			fallback, ok := syncFallbackImage(desired.Image, current)
+			if git == nil || !ok {
+				return reason
+			}
+
+			fmt.Printf("%s is not available, keeping the running image %s, run lord deploy to ship the checkout\n", desired.Image, fallback)
+			desired.Image = fallback
+			keptRunningImage = true
+			return nil
+		}
+
+		if r.config.Registry != "" {
+			_, _, err := runSSHCommand(client, appDockerCommand(r.config.Name, "pull", desired.Image), r.config.Name)
+			if err != nil {
+				err = keepRunningImage(fmt.Errorf("failed to pull %s: %v", desired.Image, err))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		inspectImage := func() (string, error) {
+			imageID, _, err := runSSHQuery(client, shellCommand("sudo", "docker", "image", "inspect", "--format", "{{.Id}}", desired.Image), "")
+			if err != nil && !planning() {
+				return "", fmt.Errorf("image %s is not on the server, run lord deploy to build and load it", desired.Image)
+			}
+			return strings.TrimSpace(imageID), nil
+		}
+
+		imageID, err := inspectImage()
+		if err != nil && !keptRunningImage {
+			err = keepRunningImage(err)
+			if err != nil {
+				return err
+			}
+			imageID, err = inspectImage()
+		}
+		if err != nil {
+			return err
+		}
+
+		diff := diffContainerSpecs(desired, current)
+
+		// the same tag can point to a newer image after a pull
+		if current != nil && current.Spec.Image == desired.Image && imageID != "" && current.ImageID != imageID {
+			diff = append(diff, fmt.Sprintf("image: %s was updated (%s -> %s)", desired.Image, shortDigest(current.ImageID), shortDigest(imageID)))
+		}
+
+		if len(diff) == 0 {
+			fmt.Printf("%s matches the config, nothing to sync\n", desired.Name)
+			return nil
+		}
+
+		fmt.Printf("recreating %s:\n", desired.Name)
+		for _, line := range diff {
+			fmt.Printf("  %s\n", line)
+		}
+
+		_, _, err = runSSHCommand(client, shellAnd(shellPipe(shellCommand("sudo", "docker", "stop", desired.Name), "true"), shellCommand("sudo", "docker", "rm", "--force", desired.Name)), r.config.Name)
+		if err != nil {
+			return err
+		}
+
+		_, _, err = runSSHCommand(client, runContainerCommand(desired, syncLabels(git, current, keptRunningImage, localDeployer(), time.Now())), r.config.Name)
+		return err
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testContainerInspect = `[
+  {
+    "Name": "/myapp",
+    "Image": "sha256:1111",
+    "State": {"Running": true},
+    "Config": {
+      "Image": "registry.example.com/myapp:0123456789ab",
+      "Labels": {
+        "lord.app": "myapp",
+        "lord.deployed": "2026-01-02T03:04:05Z",
+        "lord.env.sha256": "abc",
+        "org.opencontainers.image.revision": "0123456789abcdef",
+        "traefik.enable": "true",
+        "traefik.http.routers.myapp.entryPoints": "websecure",
+        "traefik.http.routers.myapp.rule": "Host(` + "`myapp.example.com`" + `) || Host(` + "`www.myapp.example.com`" + `)",
+        "traefik.http.routers.myapp.tls.certresolver": "theresolver",
+        "traefik.http.services.myapp.loadbalancer.server.port": "80"
+      }
+    },
+    "HostConfig": {
+      "Binds": ["/var/myapp:/data"],
+      "NetworkMode": "traefik",
+      "RestartPolicy": {"Name": "unless-stopped"}
+    }
+  }
+]`
+
+func testWebConfig() *Config {
+	return &Config{
+		Name:              "myapp",
+		Web:               true,
+		Hostname:          "myapp.example.com",
+		EnvironmentFile:   "prod.env",
+		WebAdvancedConfig: WebAdvancedConfig{MaxRequestBodyBytes: -1, MaxResponseBodyBytes: -1, MemRequestBodyBytes: -1},
+	}
+}
+
+func TestParseContainerInspect(t *testing.T) {
+	container, err := parseContainerInspect(testContainerInspect)
+	assert.NoError(t, err)
+	assert.True(t, container.Running)
+	assert.Equal(t, "sha256:1111", container.ImageID)
+	assert.Equal(t, "myapp", container.Spec.Name)
+	assert.Equal(t, "registry.example.com/myapp:0123456789ab", container.Spec.Image)
+
+	// image and provenance labels are not part of the spec
+	assert.NotContains(t, container.Spec.Labels, "lord.app")
+	assert.NotContains(t, container.Spec.Labels, "lord.deployed")
+	assert.Equal(t, "abc", container.Spec.Labels[lordEnvChecksumLabel])
+	assert.Equal(t, map[string]string{ociRevisionLabel: "0123456789abcdef"}, container.Provenance)
+
+	_, err = parseContainerInspect("[]")
+	assert.Error(t, err)
+
+	_, err = parseContainerInspect("not json")
+	assert.Error(t, err)
+}
+
+func TestParseContainerInspectDefaultNetwork(t *testing.T) {
+	container, err := parseContainerInspect(`[{"Name": "/worker", "HostConfig": {"NetworkMode": "bridge"}}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultNetwork, container.Spec.Network)
+	assert.Equal(t, []string{}, container.Spec.Volumes)
+}
+
+func TestDiffContainerSpecs(t *testing.T) {
+	current, err := parseContainerInspect(testContainerInspect)
+	assert.NoError(t, err)
+
+	t.Run("matches", func(t *testing.T) {
+		desired := containerSpec(testWebConfig(), "registry.example.com/myapp:0123456789ab", "abc")
+		assert.Empty(t, diffContainerSpecs(desired, current))
+	})
+
+	t.Run("missing container", func(t *testing.T) {
+		desired := containerSpec(testWebConfig(), "myapp:latest", "")
+		assert.Equal(t, []string{"container: missing"}, diffContainerSpecs(desired, nil))
+	})
+
+	t.Run("every difference", func(t *testing.T) {
+		c := testWebConfig()
+		c.Hostname = "new.example.com"
+		c.Volumes = []string{"/srv/uploads:/uploads"}
+		c.WebAdvancedConfig.MaxRequestBodyBytes = 1024
+
+		desired := containerSpec(c, "registry.example.com/myapp:ba9876543210", "def")
+		desired.RestartPolicy = "always"
+
+		stopped := *current
+		stopped.Running = false
+
+		assert.Equal(t, []string{
+			"container: not running",
+			"image: registry.example.com/myapp:0123456789ab -> registry.example.com/myapp:ba9876543210",
+			"env file: changed",
+			"label traefik.http.middlewares.myapp-buffering.buffering.maxrequestbodybytes: added 1024",
+			"label traefik.http.routers.myapp.middlewares: added myapp-buffering",
+			"label traefik.http.routers.myapp.rule: Host(`myapp.example.com`) || Host(`www.myapp.example.com`) -> Host(`new.example.com`) || Host(`www.new.example.com`)",
+			"volume: added /srv/uploads:/uploads",
+			"restart policy: unless-stopped -> always",
+		}, diffContainerSpecs(desired, &stopped))
+	})
+
+	t.Run("web app turned into a worker", func(t *testing.T) {
+		c := testWebConfig()
+		c.Web = false
+		c.EnvironmentFile = ""
+
+		diff := diffContainerSpecs(containerSpec(c, "registry.example.com/myapp:0123456789ab", ""), current)
+		assert.Contains(t, diff, "env file: changed")
+		assert.Contains(t, diff, "label traefik.enable: removed (was true)")
+		assert.Contains(t, diff, "network: traefik -> default")
+	})
+}
+
+func TestEnvironmentChecksum(t *testing.T) {
+	chdirTemp(t)
+
+	checksum, err := environmentChecksum(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", checksum)
+
+	assert.NoError(t, os.WriteFile("prod.env", []byte("KEY=value\n"), 0600))
+	checksum, err = environmentChecksum(&Config{EnvironmentFile: "prod.env"})
+	assert.NoError(t, err)
+	assert.Equal(t, "c283007d8774ef7af9ef9242045d49e726f834624768abf670d1e9a6634ee651", checksum)
+}
+
+func TestIsMissingContainerError(t *testing.T) {
+	assert.True(t, isMissingContainerError("Error: No such container: myapp\n"))
+	assert.True(t, isMissingContainerError("Error response from daemon: No such container: myapp"))
+	assert.False(t, isMissingContainerError("permission denied while trying to connect to the Docker daemon socket"))
+	assert.False(t, isMissingContainerError(""))
+}
+
+func TestSyncFallbackImage(t *testing.T) {
+	current, err := parseContainerInspect(testContainerInspect)
+	assert.NoError(t, err)
+
+	// HEAD is ahead of the deployed commit, the running commit tag is kept
+	image, ok := syncFallbackImage("registry.example.com/myapp:fedcba987654", current)
+	assert.True(t, ok)
+	assert.Equal(t, "registry.example.com/myapp:0123456789ab", image)
+
+	// a different repository or no container at all has nothing to keep
+	_, ok = syncFallbackImage("other.example.com/myapp:fedcba987654", current)
+	assert.False(t, ok)
+	_, ok = syncFallbackImage("registry.example.com/myapp:0123456789ab", current)
+	assert.False(t, ok)
+	_, ok = syncFallbackImage("registry.example.com/myapp:fedcba987654", nil)
+	assert.False(t, ok)
+
+	assert.Equal(t, "localhost:5000/myapp", imageRepositoryOf("localhost:5000/myapp:abc"))
+	assert.Equal(t, "localhost:5000/myapp", imageRepositoryOf("localhost:5000/myapp"))
+}
+
+func TestSyncLabels(t *testing.T) {
+	current, err := parseContainerInspect(testContainerInspect)
+	assert.NoError(t, err)
+
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	git := &GitState{Commit: "fedcba9876543210", Branch: "main"}
+
+	assert.Contains(t, syncLabels(git, current, false, "jane", now), "org.opencontainers.image.revision=fedcba9876543210")
+
+	// the kept image keeps the revision it was built from
+	labels := syncLabels(git, current, true, "jane", now)
+	assert.Contains(t, labels, "org.opencontainers.image.revision=0123456789abcdef")
+	assert.NotContains(t, labels, "lord.branch=main")
+	assert.Contains(t, labels, "lord.deployer=jane")
+}
@@ -15,6 +15,10 @@ const (
 	RegistryUnsupported  Registry = "unsupported"
 	RegistryDigitalOcean Registry = "digitalocean"
 	RegistryEcr          Registry = "ecr"
+	RegistryGhcr         Registry = "ghcr"
+	RegistryGoogle       Registry = "google"
+	RegistryAzure        Registry = "azure"
+	RegistryDockerHub    Registry = "dockerhub"
 )
 
 // isJsonFile checks if the file content is valid json
@@ -43,6 +47,12 @@ func parseUsernamePassword(content []byte) (string, string, error) {
 	return username, password, nil
 }
 
+// registryHost returns the registry server portion of a registry url (i.e. ghcr.io for ghcr.io/me)
+func registryHost(registryUrl string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(registryUrl, "https://"), "http://")
+	return strings.SplitN(host, "/", 2)[0]
+}
+
 func detectRegistryType(registryUrl string) Registry {
 	if strings.Contains(registryUrl, "amazonaws.com") {
 		return RegistryEcr
@@ -50,6 +60,19 @@ func detectRegistryType(registryUrl string) Registry {
 	if strings.Contains(registryUrl, "digitaloceanspaces.com") || strings.Contains(registryUrl, "registry.digitalocean.com") {
 		return RegistryDigitalOcean
 	}
+
+	host := registryHost(registryUrl)
+	switch {
+	case host == "ghcr.io":
+		return RegistryGhcr
+	case strings.HasSuffix(host, "-docker.pkg.dev") || host == "gcr.io" || strings.HasSuffix(host, ".gcr.io"):
+		return RegistryGoogle
+	case strings.HasSuffix(host, ".azurecr.io"):
+		return RegistryAzure
+	case host == "docker.io" || host == "index.docker.io" || host == "registry-1.docker.io":
+		return RegistryDockerHub
+	}
+
 	return RegistryUnsupported
 }
 
@@ -85,6 +108,8 @@ func (r *remote) getRegistryToolsInstallCommands(registryType Registry, osType s
 		default:
 			return nil, fmt.Errorf("unsupported os type for digitalocean: %s", osType)
 		}
+	case RegistryGhcr, RegistryGoogle, RegistryAzure, RegistryDockerHub:
+		return []string{}, nil // authenticated with a plain docker login, no tools needed
 	default:
 		return nil, fmt.Errorf("unsupported registry type: %s", registryType)
 	}
@@ -97,16 +122,21 @@ func (r *remote) ensureRegistryToolsInstalled(recover bool) error {
 			return fmt.Errorf("unsupported registry, cannot perform install tools")
 		}
 
+		switch registryType {
+		case RegistryGhcr, RegistryGoogle, RegistryAzure, RegistryDockerHub:
+			return nil // authenticated with a plain docker login, no tools needed
+		}
+
 		if !recover {
 			// check if the specific registry tools are already installed and return
 			switch registryType {
 			case RegistryEcr:
-				_, _, err := runSSHCommand(client, "aws --version", "")
+				_, _, err := runSSHQuery(client, "aws --version", "")
 				if err == nil {
 					return nil
 				}
 			case RegistryDigitalOcean:
-				_, _, err := runSSHCommand(client, "doctl version", "")
+				_, _, err := runSSHQuery(client, "doctl version", "")
 				if err == nil {
 					return nil
 				}
@@ -159,6 +189,8 @@ func (r *remote) registryLogin() error {
 			return fmt.Errorf("unsupported registry, cannot perform docker login")
 		}
 
+		// credentials like "$GHCR_TOKEN" are double quoted instead of shell quoted so the server expands them
+		// from the host environment file
 		switch registryType {
 		case RegistryEcr:
 			fmt.Println("authenticating to ecr registry")
@@ -168,21 +200,65 @@ func (r *remote) registryLogin() error {
 			}
 
 			// get ecr login token and login to docker
-			loginCmd := fmt.Sprintf("aws ecr get-login-password --region %s | sudo docker login --username AWS --password-stdin %s", region, r.config.Registry)
-			_, _, err = runSSHCommand(client, loginCmd, "")
+			loginCmd := shellPipe(
+				shellCommand("aws", "ecr", "get-login-password", "--region", region),
+				appDockerCommand(r.config.Name, "login", "--username", "AWS", "--password-stdin", r.config.Registry),
+			)
+			_, _, err = runSSHCommand(client, loginCmd, r.config.Name)
 			if err != nil {
 				return fmt.Errorf("failed to login to ecr: %v", err)
 			}
 
 		case RegistryDigitalOcean:
 			fmt.Println("authenticating to digitalocean registry")
-			// use doctl to authenticate and login to docker
-			loginCmd := "doctl registry login"
-			_, _, err := runSSHCommand(client, loginCmd, "")
+			// use doctl to generate docker credentials and write them to the app's docker config
+			loginCmd := shellPipe("doctl registry docker-config", secretFileCommand(fmt.Sprintf("%s/config.json", dockerConfigDir(r.config.Name)), false))
+			_, _, err := runSSHCommand(client, loginCmd, r.config.Name)
 			if err != nil {
 				return fmt.Errorf("failed to login to digitalocean registry: %v", err)
 			}
 
+		case RegistryGhcr:
+			fmt.Println("authenticating to github container registry")
+			// token and username are sourced from the host environment file
+			loginCmd := fmt.Sprintf("echo \"$GHCR_TOKEN\" | %s --username \"$GHCR_USERNAME\" --password-stdin", appDockerCommand(r.config.Name, "login", "ghcr.io"))
+			_, _, err := runSSHCommand(client, loginCmd, r.config.Name)
+			if err != nil {
+				return fmt.Errorf("failed to login to ghcr, ensure GHCR_USERNAME and GHCR_TOKEN are exported in your host environment file: %v", err)
+			}
+
+		case RegistryGoogle:
+			fmt.Println("authenticating to google artifact/container registry")
+			// prefer a service account key file on the host, fall back to the base64 encoded key in the host environment
+			host := registryHost(r.config.Registry)
+			loginCmd := fmt.Sprintf(
+				"if [ -n \"$GOOGLE_APPLICATION_CREDENTIALS\" ] && [ -f \"$GOOGLE_APPLICATION_CREDENTIALS\" ]; then cat \"$GOOGLE_APPLICATION_CREDENTIALS\" | %s; else echo \"$GOOGLE_CREDENTIALS_BASE64\" | %s; fi",
+				appDockerCommand(r.config.Name, "login", "--username", "_json_key", "--password-stdin", "https://"+host),
+				appDockerCommand(r.config.Name, "login", "--username", "_json_key_base64", "--password-stdin", "https://"+host),
+			)
+			_, _, err := runSSHCommand(client, loginCmd, r.config.Name)
+			if err != nil {
+				return fmt.Errorf("failed to login to google registry, ensure GOOGLE_APPLICATION_CREDENTIALS or GOOGLE_CREDENTIALS_BASE64 is exported in your host environment file: %v", err)
+			}
+
+		case RegistryAzure:
+			fmt.Println("authenticating to azure container registry")
+			// service principal credentials are sourced from the host environment file
+			loginCmd := fmt.Sprintf("echo \"$AZURE_CLIENT_SECRET\" | %s --username \"$AZURE_CLIENT_ID\" --password-stdin", appDockerCommand(r.config.Name, "login", registryHost(r.config.Registry)))
+			_, _, err := runSSHCommand(client, loginCmd, r.config.Name)
+			if err != nil {
+				return fmt.Errorf("failed to login to azure registry, ensure AZURE_CLIENT_ID and AZURE_CLIENT_SECRET are exported in your host environment file: %v", err)
+			}
+
+		case RegistryDockerHub:
+			fmt.Println("authenticating to docker hub")
+			// access token and username are sourced from the host environment file
+			loginCmd := fmt.Sprintf("echo \"$DOCKERHUB_TOKEN\" | %s --username \"$DOCKERHUB_USERNAME\" --password-stdin", appDockerCommand(r.config.Name, "login"))
+			_, _, err := runSSHCommand(client, loginCmd, r.config.Name)
+			if err != nil {
+				return fmt.Errorf("failed to login to docker hub, ensure DOCKERHUB_USERNAME and DOCKERHUB_TOKEN are exported in your host environment file: %v", err)
+			}
+
 		default:
 			return fmt.Errorf("unsupported registry type: %s", registryType)
 		}
@@ -191,6 +267,20 @@ func (r *remote) registryLogin() error {
 	})
 }
 
+func (r *remote) registryPasswordLogin(client *ssh.Client, username string, password string) error {
+	fmt.Println("performing docker login with username/password")
+	registerSecret(password)
+
+	// the password is passed on stdin so it never shows up in the process list or the printed command
+	loginCmd := appDockerCommand(r.config.Name, "login", "--username", username, "--password-stdin", r.config.Registry)
+	_, _, err := runSSHCommandWithInput(client, loginCmd, []byte(password), "")
+	if err != nil {
+		return fmt.Errorf("failed to login to registry: %v", err)
+	}
+
+	return nil
+}
+
 func (r *remote) ensureRegistryAuthenticated(recover bool) error {
 	if r.config.Registry == "" {
 		fmt.Println("no container registry in use, skipping authentication")
@@ -198,6 +288,12 @@ func (r *remote) ensureRegistryAuthenticated(recover bool) error {
 	}
 
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		// each app keeps its registry credentials in its own docker config directory
+		_, _, err := runSSHCommand(client, shellCommand("sudo", "mkdir", "-p", dockerConfigDir(r.config.Name)), "")
+		if err != nil {
+			return err
+		}
+
 		// only copy auth file if it exists and is specified
 		if r.config.AuthFile != "" {
 			authFileContent, err := os.ReadFile(r.config.AuthFile)
@@ -208,19 +304,8 @@ func (r *remote) ensureRegistryAuthenticated(recover bool) error {
 			// detect if authfile is json or bare username:password
 			if isJsonFile(authFileContent) {
 				// handle json config.json format
-				dockerConfigPath := "/root/.docker"
-				if r.config.User != "root" {
-					dockerConfigPath = fmt.Sprintf("/home/%s/.docker", r.config.User)
-				}
-
-				fmt.Println("creating .docker directory to place auth file")
-				_, _, err = runSSHCommand(client, fmt.Sprintf("sudo mkdir -p %s", dockerConfigPath), "")
-				if err != nil {
-					return err
-				}
-
 				fmt.Println("copying docker auth file")
-				err = sftpCopyFileToRemote(client, r.config.AuthFile, fmt.Sprintf("%s/config.json", dockerConfigPath))
+				err = writeRemoteSecretFile(client, fmt.Sprintf("%s/config.json", dockerConfigDir(r.config.Name)), authFileContent, false)
 				if err != nil {
 					return err
 				}
@@ -231,13 +316,17 @@ func (r *remote) ensureRegistryAuthenticated(recover bool) error {
 					return fmt.Errorf("failed to parse auth file: %v", err)
 				}
 
-				fmt.Println("performing docker login with username/password")
-				loginCmd := fmt.Sprintf("echo '%s' | sudo docker login --username '%s' --password-stdin %s", password, username, r.config.Registry)
-				_, _, err = runSSHCommand(client, loginCmd, "")
+				err = r.registryPasswordLogin(client, username, password)
 				if err != nil {
-					return fmt.Errorf("failed to login to registry: %v", err)
+					return err
 				}
 			}
+		} else if r.config.registryPassword != "" {
+			// credentials resolved from a lord hosted registry
+			err = r.registryPasswordLogin(client, r.config.registryUsername, r.config.registryPassword)
+			if err != nil {
+				return err
+			}
 		} else {
 			fmt.Println("no docker registry auth file specified, attempting docker login")
 
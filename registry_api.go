@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// manifest types the registry may store, indexes are pushed by multi-platform builds
+var registryManifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// registryClient talks to the distribution api of the lord hosted registry with the credentials stored on the
+// registry server
+type registryClient struct {
+	baseUrl  string
+	username string
+	password string
+	http     *http.Client
+}
+
+type registryManifestDocument struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	} `json:"config"`
+	Layers []struct {
+		Size int64 `json:"size"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func newRegistryClient(registryUrl string, username string, password string) *registryClient {
+	return &registryClient{
+		baseUrl:  fmt.Sprintf("https://%s", registryHost(registryUrl)),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (rc *registryClient) do(method string, path string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequest(method, rc.baseUrl+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(rc.username, rc.password)
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+
+	resp, err := rc.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (rc *registryClient) getJson(path string, accept []string, v interface{}) (http.Header, error) {
+	resp, err := rc.do(http.MethodGet, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return nil, fmt.Errorf("malformed registry response from %s: %v", path, err)
+	}
+
+	return resp.Header, nil
+}
+
+func (rc *registryClient) listTags(repository string) ([]string, error) {
+	var result struct {
+		Tags []string `json:"tags"`
+	}
+
+	_, err := rc.getJson(fmt.Sprintf("/v2/%s/tags/list", repository), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Tags, nil
+}
+
+// imageManifest returns the digest of the manifest a reference points to along with the single platform
+// manifest describing the image, the first real platform of an index
+func (rc *registryClient) imageManifest(repository string, reference string) (string, registryManifestDocument, error) {
+	var manifest registryManifestDocument
+	header, err := rc.getJson(fmt.Sprintf("/v2/%s/manifests/%s", repository, url.PathEscape(reference)), registryManifestMediaTypes, &manifest)
+	if err != nil {
+		return "", manifest, err
+	}
+
+	digest := header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", manifest, fmt.Errorf("registry returned no digest for %s:%s", repository, reference)
+	}
+
+	if len(manifest.Manifests) == 0 {
+		return digest, manifest, nil
+	}
+
+	// attestations are stored in the index as platform unknown/unknown
+	for _, entry := range manifest.Manifests {
+		if entry.Platform.OS != "unknown" {
+			_, platformManifest, err := rc.imageManifest(repository, entry.Digest)
+			return digest, platformManifest, err
+		}
+	}
+
+	return "", manifest, fmt.Errorf("no image found in the index of %s:%s", repository, reference)
+}
+
+func (rc *registryClient) imageCreated(repository string, configDigest string) (time.Time, error) {
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+
+	_, err := rc.getJson(fmt.Sprintf("/v2/%s/blobs/%s", repository, configDigest), nil, &config)
+	return config.Created, err
+}
+
+// listManifests groups the tags of a repository by the manifest they point to, dated by the image build time
+// since the registry doesn't record when a manifest was pushed
+func (rc *registryClient) listManifests(repository string) ([]RegistryManifest, error) {
+	tags, err := rc.listTags(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []RegistryManifest{}
+	byDigest := map[string]int{}
+	for _, tag := range tags {
+		digest, manifest, err := rc.imageManifest(repository, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := byDigest[digest]; ok {
+			manifests[i].Tags = append(manifests[i].Tags, tag)
+			continue
+		}
+
+		created, err := rc.imageCreated(repository, manifest.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		size := manifest.Config.Size
+		for _, layer := range manifest.Layers {
+			size += layer.Size
+		}
+
+		byDigest[digest] = len(manifests)
+		manifests = append(manifests, RegistryManifest{
+			Digest: digest,
+			Tags:   []string{tag},
+			Size:   size,
+			Pushed: created,
+		})
+	}
+
+	return manifests, nil
+}
+
+// deleteManifest removes a manifest and every tag pointing to it, the layers are freed by the weekly garbage
+// collection
+func (rc *registryClient) deleteManifest(repository string, digest string) error {
+	resp, err := rc.do(http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/%s", repository, digest), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
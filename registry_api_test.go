@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry serves the parts of the distribution api lord uses for a single repository
+type fakeRegistry struct {
+	mu        sync.Mutex
+	tags      map[string]string
+	manifests map[string]string
+	blobs     map[string]string
+	deleted   []string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	username, password, ok := req.BasicAuth()
+	if !ok || username != "lord" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/myapp/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	switch {
+	case path == "tags/list":
+		tags := []string{}
+		for tag := range f.tags {
+			tags = append(tags, fmt.Sprintf("%q", tag))
+		}
+		fmt.Fprintf(w, `{"name":"myapp","tags":[%s]}`, strings.Join(tags, ","))
+	case strings.HasPrefix(path, "manifests/") && req.Method == http.MethodDelete:
+		digest := strings.TrimPrefix(path, "manifests/")
+		f.deleted = append(f.deleted, digest)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "manifests/"):
+		reference := strings.TrimPrefix(path, "manifests/")
+		digest := reference
+		if tagged, ok := f.tags[reference]; ok {
+			digest = tagged
+		}
+		manifest, ok := f.manifests[digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		fmt.Fprint(w, manifest)
+	case strings.HasPrefix(path, "blobs/"):
+		blob, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func imageManifestJson(config string, layerSize int) string {
+	return fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":%q,"size":100},"layers":[{"size":%d}]}`, config, layerSize)
+}
+
+func TestRegistryClientPrune(t *testing.T) {
+	registry := &fakeRegistry{
+		tags: map[string]string{
+			"latest": "sha256:new",
+			"ccc":    "sha256:new",
+			"bbb":    "sha256:index",
+			"aaa":    "sha256:old",
+		},
+		manifests: map[string]string{
+			"sha256:new":   imageManifestJson("sha256:config-new", 1000),
+			"sha256:old":   imageManifestJson("sha256:config-old", 1000),
+			"sha256:index": `{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"digest":"sha256:attestation","platform":{"os":"unknown"}},{"digest":"sha256:amd64","platform":{"os":"linux"}}]}`,
+			"sha256:amd64": imageManifestJson("sha256:config-mid", 2000),
+		},
+		blobs: map[string]string{
+			"sha256:config-new": `{"created":"2026-03-03T00:00:00Z"}`,
+			"sha256:config-mid": `{"created":"2026-02-02T00:00:00Z"}`,
+			"sha256:config-old": `{"created":"2026-01-01T00:00:00Z"}`,
+		},
+	}
+
+	server := httptest.NewTLSServer(registry)
+	defer server.Close()
+
+	client := newRegistryClient("registry.example.com", "lord", "secret")
+	client.baseUrl = server.URL
+	client.http = server.Client()
+
+	manifests, err := client.listManifests("myapp")
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 3)
+
+	byDigest := map[string]RegistryManifest{}
+	for _, manifest := range manifests {
+		byDigest[manifest.Digest] = manifest
+	}
+	assert.ElementsMatch(t, []string{"latest", "ccc"}, byDigest["sha256:new"].Tags)
+	assert.Equal(t, int64(2100), byDigest["sha256:index"].Size)
+	assert.Equal(t, 2026, byDigest["sha256:index"].Pushed.Year())
+
+	prune := planRegistryPrune(manifests, 2)
+	if assert.Len(t, prune, 1) {
+		assert.Equal(t, "sha256:old", prune[0].Digest)
+		assert.NoError(t, client.deleteManifest("myapp", prune[0].Digest))
+	}
+	assert.Equal(t, []string{"sha256:old"}, registry.deleted)
+
+	// wrong credentials surface the registry error
+	client.password = "wrong"
+	_, err = client.listManifests("myapp")
+	assert.ErrorContains(t, err, "401")
+}
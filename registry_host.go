@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// container name of the lord hosted registry, also used for its traefik router and proxy settings record
+const registryHostName = "lord-registry"
+
+// directory on the registry host holding the htpasswd file and the generated credentials
+const registryHostDir = "/etc/lord/_registry"
+
+const registryHostCredentialsFile = registryHostDir + "/credentials.json"
+
+// env file of the registry container, written on the host so the http secret never touches the local disk
+const registryHostEnvironmentFile = "/etc/" + registryHostName + "/" + registryHostName + ".env"
+
+const registryHostImage = "registry:2"
+
+const registryLordScheme = "lord://"
+
+// RegistryHostCredentials are generated once on the registry host and read by other lord configs
+// pointing at it with lord://<server>
+type RegistryHostCredentials struct {
+	Hostname string `json:"hostname"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// secret the registry signs upload state with, kept so in-progress uploads survive a redeploy
+	HTTPSecret string `json:"httpsecret,omitempty"`
+}
+
+// parseLordRegistry returns the server of a lord://<server> registry url
+func parseLordRegistry(registry string) (string, bool) {
+	if !strings.HasPrefix(registry, registryLordScheme) {
+		return "", false
+	}
+
+	server := strings.TrimSuffix(strings.TrimPrefix(registry, registryLordScheme), "/")
+	if server == "" {
+		return "", false
+	}
+
+	return server, true
+}
+
+func parseRegistryHostCredentials(content string) (RegistryHostCredentials, error) {
+	var credentials RegistryHostCredentials
+	err := json.Unmarshal([]byte(strings.TrimSpace(content)), &credentials)
+	if err != nil {
+		return credentials, fmt.Errorf("malformed registry credentials: %v", err)
+	}
+
+	if credentials.Hostname == "" || credentials.Username == "" || credentials.Password == "" {
+		return credentials, fmt.Errorf("registry credentials are incomplete")
+	}
+
+	return credentials, nil
+}
+
+func generateRegistrySecret() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// registryHostEnvironment configures registry:2 through its environment variable overrides
+func registryHostEnvironment(httpSecret string) string {
+	lines := []string{
+		"REGISTRY_HTTP_ADDR=0.0.0.0:80",
+		fmt.Sprintf("REGISTRY_HTTP_SECRET=%s", httpSecret),
+		"REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY=/data",
+		"REGISTRY_STORAGE_DELETE_ENABLED=true",
+		"REGISTRY_AUTH=htpasswd",
+		fmt.Sprintf("REGISTRY_AUTH_HTPASSWD_REALM=%s", registryHostName),
+		"REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd",
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// registryGarbageCollectCron removes unreferenced layers weekly, in the early hours when pushes are unlikely.
+// garbage collection isn't safe against a registry accepting pushes, so the registry is stopped while a
+// throwaway container with the same volumes collects and started again whether it succeeded or not.
+func registryGarbageCollectCron() string {
+	gc := fmt.Sprintf("docker run --rm --volumes-from %s --env-file %s %s garbage-collect --delete-untagged /etc/docker/registry/config.yml", registryHostName, registryHostEnvironmentFile, registryHostImage)
+	return fmt.Sprintf("0 3 * * 0 root docker stop %s > /dev/null 2>&1 && %s > /dev/null 2>&1; docker start %s > /dev/null 2>&1\n", registryHostName, gc, registryHostName)
+}
+
+// registryHostConfig derives the config the registry container is deployed with from the app config
+func (r *remote) registryHostConfig() Config {
+	c := *r.config
+	c.Name = registryHostName
+	c.Web = true
+	c.Hostname = r.config.RegistryHost.Hostname
+	c.Port = defaultWebPort
+	c.Volumes = []string{fmt.Sprintf("%s:/auth:ro", registryHostDir)}
+	c.EnvironmentFile = ""
+	c.HostEnvironmentFile = ""
+	c.Proxy = ProxyConfig{Version: r.config.Proxy.Version, Email: r.config.Proxy.Email}
+
+	// image layers can take a long time to upload, never time them out or buffer them
+	c.WebAdvancedConfig = WebAdvancedConfig{
+		ReadTimeout:          0,
+		WriteTimeout:         0,
+		IdleTimeout:          0,
+		MaxRequestBodyBytes:  -1,
+		MaxResponseBodyBytes: -1,
+		MemRequestBodyBytes:  -1,
+	}
+
+	return c
+}
+
+func readRegistryHostCredentials(client *ssh.Client) (RegistryHostCredentials, error) {
+	output, _, err := runSSHQuery(client, shellCommand("sudo", "cat", registryHostCredentialsFile), "")
+	if err != nil {
+		return RegistryHostCredentials{}, fmt.Errorf("no lord hosted registry found, run lord registry --host on the registry server first")
+	}
+
+	return parseRegistryHostCredentials(output)
+}
+
+// ensureRegistryHostCredentials keeps the existing password so other servers stay logged in across redeploys
+func (r *remote) ensureRegistryHostCredentials(client *ssh.Client) (RegistryHostCredentials, error) {
+	credentials, err := readRegistryHostCredentials(client)
+	if err != nil || credentials.Username != r.config.RegistryHost.Username {
+		fmt.Println("generating registry credentials")
+
+		password, err := generateRegistrySecret()
+		if err != nil {
+			return credentials, err
+		}
+
+		credentials = RegistryHostCredentials{
+			Username:   r.config.RegistryHost.Username,
+			Password:   password,
+			HTTPSecret: credentials.HTTPSecret,
+		}
+	}
+
+	if credentials.HTTPSecret == "" {
+		credentials.HTTPSecret, err = generateRegistrySecret()
+		if err != nil {
+			return credentials, err
+		}
+	}
+
+	credentials.Hostname = r.config.RegistryHost.Hostname
+
+	credentialsBytes, err := json.Marshal(credentials)
+	if err != nil {
+		return credentials, err
+	}
+
+	registerSecret(credentials.Password)
+	registerSecret(credentials.HTTPSecret)
+
+	_, _, err = runSSHCommand(client, shellAnd(shellCommand("sudo", "mkdir", "-p", registryHostDir), shellCommand("sudo", "chmod", "700", registryHostDir)), "")
+	if err != nil {
+		return credentials, err
+	}
+
+	err = writeRemoteSecretFile(client, registryHostCredentialsFile, credentialsBytes, false)
+	if err != nil {
+		return credentials, fmt.Errorf("failed to write registry credentials: %v", err)
+	}
+
+	// bcrypt entries are required by registry:2, the password is passed on stdin
+	htpasswdCmd := shellPipe(
+		shellCommand("sudo", "docker", "run", "--rm", "-i", "--entrypoint", "htpasswd", "httpd:2-alpine", "-Bin", credentials.Username),
+		secretFileCommand(fmt.Sprintf("%s/htpasswd", registryHostDir), false),
+	)
+	_, stderr, err := runSSHCommandWithInput(client, htpasswdCmd, []byte(credentials.Password+"\n"), "")
+	if err != nil {
+		return credentials, fmt.Errorf("failed to write registry credentials: %v %s", err, stderr)
+	}
+
+	return credentials, nil
+}
+
+func (r *remote) ensureRegistryGarbageCollection(client *ssh.Client) error {
+	_, _, err := runSSHQuery(client, "test -d /etc/cron.d", "")
+	if err != nil {
+		fmt.Println("warning: /etc/cron.d not found on server, registry garbage collection is not scheduled")
+		return nil
+	}
+
+	fmt.Println("scheduling weekly registry garbage collection")
+	return writeRemoteFile(client, fmt.Sprintf("/etc/cron.d/%s-gc", registryHostName), registryGarbageCollectCron())
+}
+
+// hostRegistry deploys a registry:2 container behind traefik on the server, authenticated with htpasswd
+func (r *remote) hostRegistry() error {
+	if r.config.RegistryHost.Hostname == "" {
+		return fmt.Errorf("registryhost.hostname must be set to host a registry")
+	}
+
+	registryConfig := r.registryHostConfig()
+	registry := remote{r.address, &registryConfig}
+
+	err := registry.ensureTraefikSetup(r.config.Email)
+	if err != nil {
+		return err
+	}
+
+	err = registry.stageForContainer(registryHostName, registryConfig.Volumes, "")
+	if err != nil {
+		return err
+	}
+
+	var credentials RegistryHostCredentials
+	environment := ""
+	err = withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		credentials, err = r.ensureRegistryHostCredentials(client)
+		if err != nil {
+			return err
+		}
+
+		environment = registryHostEnvironment(credentials.HTTPSecret)
+		err = writeRemoteSecretFile(client, registryHostEnvironmentFile, []byte(environment), false)
+		if err != nil {
+			return fmt.Errorf("failed to write registry environment: %v", err)
+		}
+
+		return r.ensureRegistryGarbageCollection(client)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = registry.stopAndDeleteContainer(registryHostName)
+	if err != nil {
+		return err
+	}
+
+	checksum := sha256.Sum256([]byte(environment))
+	spec := containerSpec(&registryConfig, registryHostImage, "")
+	spec.EnvironmentFile = registryHostEnvironmentFile
+	spec.Labels[lordEnvChecksumLabel] = hex.EncodeToString(checksum[:])
+
+	err = registry.runContainer(spec, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("registry available at %s with username %s\n", credentials.Hostname, credentials.Username)
+	fmt.Printf("set registry: %s%s in other lord configs to deploy through it\n", registryLordScheme, r.config.Server)
+
+	return nil
+}
+
+// resolveLordRegistry swaps a lord://<server> registry for the hosted registry's hostname and loads its
+// credentials from the registry server, using the same ssh user and key as the app server
+func resolveLordRegistry(c *Config) error {
+	server, ok := parseLordRegistry(c.Registry)
+	if !ok {
+		return nil
+	}
+
+	fmt.Printf("resolving lord hosted registry on %s\n", server)
+
+	return withSSHClient(server, c, func(client *ssh.Client) error {
+		credentials, err := readRegistryHostCredentials(client)
+		if err != nil {
+			return err
+		}
+
+		c.Registry = credentials.Hostname
+		c.registryUsername = credentials.Username
+		c.registryPassword = credentials.Password
+		registerSecret(credentials.Password)
+
+		return nil
+	})
+}
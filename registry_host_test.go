@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLordRegistry(t *testing.T) {
+	tests := []struct {
+		registry string
+		server   string
+		ok       bool
+	}{
+		{"lord://10.0.0.5", "10.0.0.5", true},
+		{"lord://registry.example.com/", "registry.example.com", true},
+		{"lord://", "", false},
+		{"ghcr.io/me", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		server, ok := parseLordRegistry(tt.registry)
+		assert.Equal(t, tt.server, server, tt.registry)
+		assert.Equal(t, tt.ok, ok, tt.registry)
+	}
+}
+
+func TestParseRegistryHostCredentials(t *testing.T) {
+	credentials, err := parseRegistryHostCredentials("{\"hostname\":\"registry.example.com\",\"username\":\"lord\",\"password\":\"secret\"}\n")
+	assert.NoError(t, err)
+	assert.Equal(t, RegistryHostCredentials{Hostname: "registry.example.com", Username: "lord", Password: "secret"}, credentials)
+
+	_, err = parseRegistryHostCredentials("{\"hostname\":\"registry.example.com\",\"username\":\"lord\"}")
+	assert.Error(t, err)
+
+	_, err = parseRegistryHostCredentials("not json")
+	assert.Error(t, err)
+}
+
+func TestRegistryHostConfig(t *testing.T) {
+	r := remote{"10.0.0.5", &Config{
+		Name:         "myapp",
+		Hostname:     "myapp.example.com",
+		Proxy:        ProxyConfig{Version: "v3.3", Dashboard: true},
+		RegistryHost: RegistryHostConfig{Hostname: "registry.example.com", Username: "lord"},
+	}}
+
+	c := r.registryHostConfig()
+	assert.Equal(t, registryHostName, c.Name)
+	assert.Equal(t, "registry.example.com", c.Hostname)
+	assert.True(t, c.Web)
+	assert.False(t, c.Proxy.Dashboard)
+	assert.Equal(t, 0, c.WebAdvancedConfig.ReadTimeout)
+	assert.Equal(t, 0, c.WebAdvancedConfig.WriteTimeout)
+	assert.Equal(t, -1, c.WebAdvancedConfig.MaxRequestBodyBytes)
+
+	// the app config is left untouched
+	assert.Equal(t, "myapp", r.config.Name)
+}
+
+func TestRegistryHostEnvironment(t *testing.T) {
+	env := registryHostEnvironment("abc123")
+	assert.Contains(t, env, "REGISTRY_HTTP_SECRET=abc123\n")
+	assert.Contains(t, env, "REGISTRY_AUTH=htpasswd\n")
+	assert.Contains(t, env, "REGISTRY_STORAGE_DELETE_ENABLED=true\n")
+	assert.True(t, strings.HasSuffix(env, "\n"))
+}
+
+func TestRegistryGarbageCollectCron(t *testing.T) {
+	cron := registryGarbageCollectCron()
+	assert.True(t, strings.HasPrefix(cron, "0 3 * * 0 root docker stop lord-registry "))
+	assert.Contains(t, cron, "--volumes-from lord-registry --env-file /etc/lord-registry/lord-registry.env registry:2 garbage-collect")
+	assert.True(t, strings.HasSuffix(cron, "; docker start lord-registry > /dev/null 2>&1\n"))
+	assert.NotContains(t, cron, "%")
+}
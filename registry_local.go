@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// isRegistryAuthError checks docker push output for the errors registries return on missing or bad credentials
+func isRegistryAuthError(output string) bool {
+	output = strings.ToLower(output)
+
+	authErrors := []string{
+		"unauthorized",
+		"authentication required",
+		"no basic auth credentials",
+		"access denied",
+		"denied:",
+		"403 forbidden",
+		"401 unauthorized",
+	}
+
+	for _, authError := range authErrors {
+		if strings.Contains(output, authError) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseEnvironmentFile reads KEY=VALUE lines from an env style file
+func parseEnvironmentFile(filepath string) (map[string]string, error) {
+	return parseKeyValueFile(filepath, "environment")
+}
+
+// localCredentialEnv returns registry credential variables from the local environment, falling back to the
+// host environment file so the same config works for both the server and the local machine
+func localCredentialEnv(c *Config) func(string) string {
+	hostEnv := map[string]string{}
+	if c.HostEnvironmentFile != "" {
+		content, err := readEnvironmentFile(c, c.HostEnvironmentFile)
+		if err == nil {
+			parsed, err := parseKeyValueContent(content, c.HostEnvironmentFile, "environment")
+			if err == nil {
+				hostEnv = parsed
+			}
+		}
+	}
+
+	return func(key string) string {
+		value := os.Getenv(key)
+		if value == "" {
+			value = hostEnv[key]
+		}
+		return value
+	}
+}
+
+// extractDockerConfigCredentials finds the username and password for a registry host in a docker config.json
+func extractDockerConfigCredentials(content []byte, host string) (string, string, error) {
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+
+	err := json.Unmarshal(content, &dockerConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	for server, entry := range dockerConfig.Auths {
+		if registryHost(server) != host || entry.Auth == "" {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid auth entry for %s: %v", server, err)
+		}
+
+		return parseUsernamePassword(decoded)
+	}
+
+	return "", "", fmt.Errorf("no credentials for %s found in auth file", host)
+}
+
+func localDockerLogin(server string, username string, password string) error {
+	registerSecret(password)
+
+	args := []string{"login", "--username", username, "--password-stdin"}
+	if server != "" {
+		args = append(args, server)
+	}
+
+	_, _, err := runLocalCommandWithInput(password, "docker", args...)
+	return err
+}
+
+// localRegistryLogin authenticates docker on the local machine using the same auth file or dynamic
+// credentials lord uses on the server
+func localRegistryLogin(c *Config) error {
+	host := registryHost(c.Registry)
+
+	if c.AuthFile != "" {
+		authFileContent, err := os.ReadFile(c.AuthFile)
+		if err != nil {
+			return fmt.Errorf("no docker registry auth file found at: %s", c.AuthFile)
+		}
+
+		var username, password string
+		if isJsonFile(authFileContent) {
+			username, password, err = extractDockerConfigCredentials(authFileContent, host)
+		} else {
+			username, password, err = parseUsernamePassword(authFileContent)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse auth file: %v", err)
+		}
+
+		return localDockerLogin(host, username, password)
+	}
+
+	if c.registryPassword != "" {
+		return localDockerLogin(host, c.registryUsername, c.registryPassword)
+	}
+
+	getenv := localCredentialEnv(c)
+
+	// require the named variables to be present before attempting a login
+	requireEnv := func(keys ...string) error {
+		for _, key := range keys {
+			if getenv(key) == "" {
+				return fmt.Errorf("%s must be set locally or in the host environment file", key)
+			}
+		}
+		return nil
+	}
+
+	switch detectRegistryType(c.Registry) {
+	case RegistryEcr:
+		region, err := extractAwsRegion(c.Registry)
+		if err != nil {
+			return err
+		}
+
+		password, _, err := runLocalCommandSilent("aws", "ecr", "get-login-password", "--region", region)
+		if err != nil {
+			return fmt.Errorf("failed to get ecr login password: %v", err)
+		}
+
+		return localDockerLogin(host, "AWS", strings.TrimSpace(password))
+
+	case RegistryDigitalOcean:
+		_, _, err := runLocalCommand("doctl", "registry", "login")
+		return err
+
+	case RegistryGhcr:
+		err := requireEnv("GHCR_USERNAME", "GHCR_TOKEN")
+		if err != nil {
+			return err
+		}
+		return localDockerLogin(host, getenv("GHCR_USERNAME"), getenv("GHCR_TOKEN"))
+
+	case RegistryGoogle:
+		keyFile := getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if keyFile != "" {
+			key, err := os.ReadFile(keyFile)
+			if err == nil {
+				return localDockerLogin(fmt.Sprintf("https://%s", host), "_json_key", string(key))
+			}
+		}
+
+		err := requireEnv("GOOGLE_CREDENTIALS_BASE64")
+		if err != nil {
+			return fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS must point to a local key file or %v", err)
+		}
+		return localDockerLogin(fmt.Sprintf("https://%s", host), "_json_key_base64", getenv("GOOGLE_CREDENTIALS_BASE64"))
+
+	case RegistryAzure:
+		err := requireEnv("AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET")
+		if err != nil {
+			return err
+		}
+		return localDockerLogin(host, getenv("AZURE_CLIENT_ID"), getenv("AZURE_CLIENT_SECRET"))
+
+	case RegistryDockerHub:
+		err := requireEnv("DOCKERHUB_USERNAME", "DOCKERHUB_TOKEN")
+		if err != nil {
+			return err
+		}
+		return localDockerLogin("", getenv("DOCKERHUB_USERNAME"), getenv("DOCKERHUB_TOKEN"))
+
+	default:
+		return fmt.Errorf("unsupported registry, log in locally with docker login %s", host)
+	}
+}
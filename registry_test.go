@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectRegistryType(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected Registry
+	}{
+		{"ecr", "123456789012.dkr.ecr.us-west-2.amazonaws.com/myrepo", RegistryEcr},
+		{"digitalocean", "registry.digitalocean.com/myregistry", RegistryDigitalOcean},
+		{"ghcr", "ghcr.io/myorg", RegistryGhcr},
+		{"ghcr with scheme", "https://ghcr.io/myorg", RegistryGhcr},
+		{"artifact registry", "us-central1-docker.pkg.dev/my-project/my-repo", RegistryGoogle},
+		{"gcr", "gcr.io/my-project", RegistryGoogle},
+		{"regional gcr", "eu.gcr.io/my-project", RegistryGoogle},
+		{"azure", "myregistry.azurecr.io/team", RegistryAzure},
+		{"docker hub", "docker.io/myuser", RegistryDockerHub},
+		{"docker hub index", "index.docker.io/myuser", RegistryDockerHub},
+		{"generic registry", "my.realregistry.com/me", RegistryUnsupported},
+		{"lookalike ghcr", "ghcr.io.example.com/me", RegistryUnsupported},
+		{"lookalike azure", "azurecr.io.example.com/me", RegistryUnsupported},
+		{"lookalike docker hub", "notdocker.io/me", RegistryUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, detectRegistryType(tt.url))
+		})
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"ghcr.io/myorg", "ghcr.io"},
+		{"https://myregistry.azurecr.io/team/app", "myregistry.azurecr.io"},
+		{"us-central1-docker.pkg.dev/my-project/my-repo", "us-central1-docker.pkg.dev"},
+		{"docker.io", "docker.io"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.expected, registryHost(tt.url))
+		})
+	}
+}
+
+func TestGetRegistryToolsInstallCommands(t *testing.T) {
+	r := &remote{config: &Config{}}
+
+	tests := []struct {
+		name         string
+		registryType Registry
+		osType       string
+		expectErr    bool
+		expectEmpty  bool
+	}{
+		{"ghcr needs no tools", RegistryGhcr, "ubuntu", false, true},
+		{"google needs no tools", RegistryGoogle, "amzn", false, true},
+		{"azure needs no tools", RegistryAzure, "rhel", false, true},
+		{"docker hub needs no tools", RegistryDockerHub, "debian", false, true},
+		{"ecr on ubuntu", RegistryEcr, "ubuntu", false, false},
+		{"ecr on unknown os", RegistryEcr, "unknown", true, false},
+		{"unsupported registry", RegistryUnsupported, "ubuntu", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds, err := r.getRegistryToolsInstallCommands(tt.registryType, tt.osType)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.expectEmpty {
+				assert.Empty(t, cmds)
+			} else {
+				assert.NotEmpty(t, cmds)
+			}
+		})
+	}
+}
+
+func TestIsRegistryAuthError(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected bool
+	}{
+		{"unauthorized: authentication required", true},
+		{"denied: requested access to the resource is denied", true},
+		{"no basic auth credentials", true},
+		{"error parsing HTTP 403 response body: 403 Forbidden", true},
+		{"dial tcp: lookup registry.example.com: no such host", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isRegistryAuthError(tt.output))
+		})
+	}
+}
+
+func TestParseEnvironmentFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.env")
+	content := "# registry creds\nexport GHCR_USERNAME=myuser\nGHCR_TOKEN=\"abc=def\"\n\nexport QUOTED='single quoted'\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	env, err := parseEnvironmentFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"GHCR_USERNAME": "myuser",
+		"GHCR_TOKEN":    "abc=def",
+		"QUOTED":        "single quoted",
+	}, env)
+
+	assert.NoError(t, os.WriteFile(path, []byte("NOT_AN_ASSIGNMENT\n"), 0600))
+	_, err = parseEnvironmentFile(path)
+	assert.Error(t, err)
+}
+
+func TestExtractDockerConfigCredentials(t *testing.T) {
+	content := []byte(`{"auths": {"https://my.realregistry.com": {"auth": "bXl1c2VyOm15cGFzcw=="}}}`)
+
+	username, password, err := extractDockerConfigCredentials(content, "my.realregistry.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "myuser", username)
+	assert.Equal(t, "mypass", password)
+
+	_, _, err = extractDockerConfigCredentials(content, "ghcr.io")
+	assert.Error(t, err)
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,32 +19,59 @@ type remote struct {
 	config  *Config
 }
 
+// lordAppDir is the per-app directory on the host holding the host environment file and registry credentials
+func lordAppDir(name string) string {
+	return fmt.Sprintf("/etc/lord/%s", name)
+}
+
+func hostEnvironmentFilePath(name string) string {
+	return fmt.Sprintf("%s/host.env", lordAppDir(name))
+}
+
+// hostEnvironmentSourceCommand sources the host environment file, falling back to the file older versions kept
+// directly at /etc/lord/<name> on hosts ensureLordSetup hasn't migrated yet
+func hostEnvironmentSourceCommand(name string) string {
+	hostEnvironmentFile := shellQuote(hostEnvironmentFilePath(name))
+	legacyHostEnvironmentFile := shellQuote(lordAppDir(name))
+	return fmt.Sprintf("if test -f %s; then source %s; elif test -f %s; then source %s; fi", hostEnvironmentFile, hostEnvironmentFile, legacyHostEnvironmentFile, legacyHostEnvironmentFile)
+}
+
+func dockerConfigDir(name string) string {
+	return fmt.Sprintf("%s/docker", lordAppDir(name))
+}
+
+// appDockerCommand runs docker with the app's own config directory (equivalent to setting DOCKER_CONFIG) so
+// apps using different registries or accounts on the same host don't overwrite each other's credentials
+func appDockerCommand(name string, args ...string) string {
+	return shellCommand(append([]string{"sudo", "docker", "--config", dockerConfigDir(name)}, args...)...)
+}
+
 func (r *remote) getHostOS() (string, error) {
 	var osType string
 	var osErr error
 
 	err := withSSHClient(r.address, r.config, func(client *ssh.Client) error {
 		// try to identify the distro using /etc/os-release
-		osRelease, _, err := runSSHCommand(client, "cat /etc/os-release | grep ^ID= | cut -d'=' -f2 | tr -d '\"'", "")
+		osRelease, _, err := runSSHQuery(client, "cat /etc/os-release | grep ^ID= | cut -d'=' -f2 | tr -d '\"'", "")
 		if err == nil && osRelease != "" {
 			osType = strings.TrimSpace(osRelease)
 			return nil
 		}
 
 		// fallback to checking for specific files
-		_, _, err = runSSHCommand(client, "test -f /etc/amazon-linux-release", "")
+		_, _, err = runSSHQuery(client, "test -f /etc/amazon-linux-release", "")
 		if err == nil {
 			osType = "amzn"
 			return nil
 		}
 
-		_, _, err = runSSHCommand(client, "test -f /etc/debian_version", "")
+		_, _, err = runSSHQuery(client, "test -f /etc/debian_version", "")
 		if err == nil {
 			osType = "debian"
 			return nil
 		}
 
-		_, _, err = runSSHCommand(client, "test -f /etc/redhat-release", "")
+		_, _, err = runSSHQuery(client, "test -f /etc/redhat-release", "")
 		if err == nil {
 			osType = "rhel"
 			return nil
@@ -109,16 +138,40 @@ func (r *remote) getDockerInstallCommands(osType string) ([]string, error) {
 
 func (r *remote) ensureLordSetup() error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		_, _, err := runSSHCommand(client, "sudo mkdir -p /etc/lord", "")
-		if err != nil {
-			return err
+		appDir := lordAppDir(r.config.Name)
+
+		// older versions stored the host environment file directly at /etc/lord/<name>
+		migrateCmd := fmt.Sprintf("if %s; then %s; fi",
+			shellCommand("sudo", "test", "-f", appDir),
+			shellAnd(
+				shellCommand("sudo", "mv", appDir, appDir+".migrate"),
+				shellCommand("sudo", "mkdir", "-p", appDir),
+				shellCommand("sudo", "mv", appDir+".migrate", hostEnvironmentFilePath(r.config.Name)),
+			))
+
+		cmds := []string{
+			"sudo mkdir -p /etc/lord",
+			migrateCmd,
+			shellCommand("sudo", "mkdir", "-p", dockerConfigDir(r.config.Name)),
+		}
+
+		for _, cmd := range cmds {
+			_, _, err := runSSHCommand(client, cmd, "")
+			if err != nil {
+				return err
+			}
 		}
 
 		if r.config.HostEnvironmentFile != "" {
 			_, err := os.Stat(r.config.HostEnvironmentFile)
 			if err == nil {
 				fmt.Println("copying host environment file")
-				err = sftpCopyFileToRemote(client, r.config.HostEnvironmentFile, fmt.Sprintf("/etc/lord/%s", r.config.Name))
+				content, err := readEnvironmentFile(r.config, r.config.HostEnvironmentFile)
+				if err != nil {
+					return err
+				}
+
+				err = writeRemoteSecretFile(client, hostEnvironmentFilePath(r.config.Name), content, true)
 				if err != nil {
 					return err
 				}
@@ -132,7 +185,7 @@ func (r *remote) ensureLordSetup() error {
 func (r *remote) ensureDockerInstalled(recover bool) error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
 		if !recover {
-			_, _, err := runSSHCommand(client, "sudo docker --version", "")
+			_, _, err := runSSHQuery(client, "sudo docker --version", "")
 			if err == nil {
 				return nil
 			}
@@ -167,7 +220,7 @@ func (r *remote) ensureDockerInstalled(recover bool) error {
 
 func (r *remote) ensureDockerRunning() error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		_, _, err := runSSHCommand(client, "sudo systemctl is-active --quiet docker", "")
+		_, _, err := runSSHQuery(client, "sudo systemctl is-active --quiet docker", "")
 		if err == nil {
 			return nil
 		}
@@ -190,7 +243,7 @@ func (r *remote) ensureDockerRunning() error {
 
 func (r *remote) pullContainer(imageTag string) error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		_, _, err := runSSHCommand(client, fmt.Sprintf("sudo docker pull %s", imageTag), r.config.Name)
+		_, _, err := runSSHCommand(client, appDockerCommand(r.config.Name, "pull", imageTag), r.config.Name)
 		if err != nil {
 			return err
 		}
@@ -201,18 +254,19 @@ func (r *remote) pullContainer(imageTag string) error {
 
 func (r *remote) directLoadContainer(imageName string) error {
 	containerSaveFile := fmt.Sprintf("%s.tar.gz", imageName)
+	remoteSaveFile := fmt.Sprintf("/tmp/%s", containerSaveFile)
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		err := sftpCopyFileToRemote(client, containerSaveFile, fmt.Sprintf("/tmp/%s", containerSaveFile))
+		err := sftpCopyFileToRemote(client, containerSaveFile, remoteSaveFile)
 		if err != nil {
 			return err
 		}
 
-		_, _, err = runSSHCommand(client, fmt.Sprintf("gunzip -c /tmp/%s | sudo docker load", containerSaveFile), r.config.Name)
+		_, _, err = runSSHCommand(client, shellPipe(shellCommand("gunzip", "-c", remoteSaveFile), "sudo docker load"), r.config.Name)
 		if err != nil {
 			return err
 		}
 
-		_, _, err = runSSHCommand(client, fmt.Sprintf("rm /tmp/%s", containerSaveFile), r.config.Name)
+		_, _, err = runSSHCommand(client, shellCommand("rm", remoteSaveFile), r.config.Name)
 		if err != nil {
 			fmt.Printf("warning: failed to cleanup remote container file: %v\n", err)
 		}
@@ -225,17 +279,95 @@ func (r *remote) stopAndDeleteContainer(name string) error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
 		fmt.Println("stopping and deleting container if exists")
 
-		_, _, err := runSSHCommand(client, fmt.Sprintf("sudo docker stop %s | true && sudo docker rm --force %s", name, name), r.config.Name)
+		_, _, err := runSSHCommand(client, shellAnd(shellPipe(shellCommand("sudo", "docker", "stop", name), "true"), shellCommand("sudo", "docker", "rm", "--force", name)), r.config.Name)
 		return err
 	})
 }
 
-func (r *remote) getContainerStatus(name string) error {
+// ContainerStatus is the result of lord status --json, provenance fields are empty for containers deployed
+// before the labels existed
+type ContainerStatus struct {
+	Name     string `json:"name"`
+	Found    bool   `json:"found"`
+	Running  bool   `json:"running"`
+	State    string `json:"state,omitempty"`
+	Image    string `json:"image,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Deployed string `json:"deployed,omitempty"`
+	Deployer string `json:"deployer,omitempty"`
+}
+
+// parseContainerStatus reads the status of a container from docker inspect json output
+func parseContainerStatus(name string, output string) (ContainerStatus, error) {
+	inspected := []containerInspect{}
+	err := json.Unmarshal([]byte(output), &inspected)
+	if err != nil {
+		return ContainerStatus{}, fmt.Errorf("malformed docker inspect output: %v", err)
+	}
+	if len(inspected) != 1 {
+		return ContainerStatus{}, fmt.Errorf("expected one container in docker inspect output, found %d", len(inspected))
+	}
+
+	container := inspected[0]
+	labels := container.Config.Labels
+
+	return ContainerStatus{
+		Name:     name,
+		Found:    true,
+		Running:  container.State.Running,
+		State:    container.State.Status,
+		Image:    container.Config.Image,
+		Revision: labels[ociRevisionLabel],
+		Branch:   labels[lordBranchLabel],
+		Source:   labels[ociSourceLabel],
+		Deployed: labels[lordDeployedAt],
+		Deployer: labels[lordDeployer],
+	}, nil
+}
+
+// containerStatusJson prints the status of the container as json, a missing container is reported as not found
+func containerStatusJson(client *ssh.Client, name string) error {
+	output, stderr, err := runSSHQuery(client, shellCommand("sudo", "docker", "inspect", "--type", "container", name), "")
+	if err != nil && isMissingContainerError(stderr) {
+		return writeJson(ContainerStatus{Name: name})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %v %s", name, err, strings.TrimSpace(stderr))
+	}
+
+	status, err := parseContainerStatus(name, output)
+	if err != nil {
+		return err
+	}
+
+	return writeJson(status)
+}
+
+func (r *remote) getContainerStatus(name string, asJson bool) error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		if asJson {
+			return containerStatusJson(client, name)
+		}
+
 		fmt.Println("getting container status")
 
-		_, _, err := runSSHCommand(client, fmt.Sprintf("sudo docker ps --filter name=%s", name), r.config.Name)
-		return err
+		_, _, err := runSSHCommand(client, shellCommand("sudo", "docker", "ps", "--filter", "name="+name), r.config.Name)
+		if err != nil {
+			return err
+		}
+
+		// containers deployed before provenance labels existed report blank values
+		inspectFormat := fmt.Sprintf("image: {{.Config.Image}}\nrevision: {{index .Config.Labels \"%s\"}}\nbranch: {{index .Config.Labels \"%s\"}}\nsource: {{index .Config.Labels \"%s\"}}\ndeployed: {{index .Config.Labels \"%s\"}} by {{index .Config.Labels \"%s\"}}", ociRevisionLabel, lordBranchLabel, ociSourceLabel, lordDeployedAt, lordDeployer)
+		output, _, err := runSSHCommandSilent(client, shellCommand("sudo", "docker", "inspect", "--format", inspectFormat, name), r.config.Name)
+		if err != nil {
+			fmt.Println("container not found, no deployment details available")
+			return nil
+		}
+
+		fmt.Println(output)
+		return nil
 	})
 }
 
@@ -244,8 +376,8 @@ func (r *remote) stageForContainer(name string, volumes []string, environmentFil
 		fmt.Println("staging host for container")
 
 		cmds := []string{
-			fmt.Sprintf("sudo mkdir -p /etc/%s", name),
-			fmt.Sprintf("sudo mkdir -p /var/%s", name),
+			shellCommand("sudo", "mkdir", "-p", fmt.Sprintf("/etc/%s", name)),
+			shellCommand("sudo", "mkdir", "-p", fmt.Sprintf("/var/%s", name)),
 		}
 
 		for _, v := range volumes {
@@ -254,7 +386,7 @@ func (r *remote) stageForContainer(name string, volumes []string, environmentFil
 				return fmt.Errorf("malformed volume mount")
 			}
 
-			cmds = append(cmds, fmt.Sprintf("sudo mkdir -p %s", vParts[0]))
+			cmds = append(cmds, shellCommand("sudo", "mkdir", "-p", vParts[0]))
 		}
 
 		fmt.Println("creating volume mount and config directories")
@@ -267,7 +399,12 @@ func (r *remote) stageForContainer(name string, volumes []string, environmentFil
 
 		if environmentFile != "" {
 			fmt.Println("copying env file")
-			err := sftpCopyFileToRemote(client, environmentFile, fmt.Sprintf("/etc/%s/%s.env", name, name))
+			content, err := readEnvironmentFile(r.config, environmentFile)
+			if err != nil {
+				return err
+			}
+
+			err = writeRemoteSecretFile(client, fmt.Sprintf("/etc/%s/%s.env", name, name), content, false)
 			if err != nil {
 				return err
 			}
@@ -277,54 +414,43 @@ func (r *remote) stageForContainer(name string, volumes []string, environmentFil
 	})
 }
 
-func (r *remote) runContainer(name string, imageTag string, volumes []string, environmentFile string, web bool, hostname string) error {
-	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		fmt.Println("running container")
+// runContainerCommand builds the docker run command for a container spec, every value is passed as its own
+// quoted argument. labels are informational labels (provenance) that reconcile doesn't compare.
+func runContainerCommand(spec ContainerSpec, labels []string) string {
+	args := []string{"sudo", "docker", "run", "-d", "--restart", spec.RestartPolicy}
+	args = append(args, "--name", spec.Name)
 
-		runCommand := "sudo docker run -d --restart unless-stopped"
-		runCommand += fmt.Sprintf(" --name %s", name)
-		runCommand += fmt.Sprintf(" -v /var/%s:/data", name)
+	for _, volume := range spec.Volumes {
+		args = append(args, "-v", volume)
+	}
 
-		for _, volume := range volumes {
-			runCommand += fmt.Sprintf(" -v %s", volume)
-		}
+	// provenance labels, shown by lord -status
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
 
-		if web {
-			runCommand += " --label \"traefik.enable=true\""
-			runCommand += fmt.Sprintf(" --label \"traefik.http.routers.%s.rule=Host(\\`%s\\`) || Host(\\`www.%s\\`)\"", name, hostname, hostname)
-			runCommand += fmt.Sprintf(" --label \"traefik.http.routers.%s.entryPoints=websecure\"", name)
-			runCommand += fmt.Sprintf(" --label \"traefik.http.routers.%s.tls.certresolver=theresolver\"", name)
-			runCommand += fmt.Sprintf(" --label \"traefik.http.services.%s.loadbalancer.server.port=80\"", name)
-
-			// web advanced config - buffering settings
-			hasBuffering := r.config.WebAdvancedConfig.MaxRequestBodyBytes != -1 ||
-				r.config.WebAdvancedConfig.MaxResponseBodyBytes != -1 ||
-				r.config.WebAdvancedConfig.MemRequestBodyBytes != -1
-
-			if hasBuffering {
-				if r.config.WebAdvancedConfig.MaxRequestBodyBytes != -1 {
-					runCommand += fmt.Sprintf(" --label \"traefik.http.middlewares.%s-buffering.buffering.maxrequestbodybytes=%d\"", name, r.config.WebAdvancedConfig.MaxRequestBodyBytes)
-				}
-				if r.config.WebAdvancedConfig.MaxResponseBodyBytes != -1 {
-					runCommand += fmt.Sprintf(" --label \"traefik.http.middlewares.%s-buffering.buffering.maxresponsebodybytes=%d\"", name, r.config.WebAdvancedConfig.MaxResponseBodyBytes)
-				}
-				if r.config.WebAdvancedConfig.MemRequestBodyBytes != -1 {
-					runCommand += fmt.Sprintf(" --label \"traefik.http.middlewares.%s-buffering.buffering.memrequestbodybytes=%d\"", name, r.config.WebAdvancedConfig.MemRequestBodyBytes)
-				}
-				// apply the buffering middleware to the router
-				runCommand += fmt.Sprintf(" --label \"traefik.http.routers.%s.middlewares=%s-buffering\"", name, name)
-			}
+	for _, key := range sortedKeys(spec.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, spec.Labels[key]))
+	}
 
-			runCommand += " --network traefik"
-		}
+	if spec.Network != defaultNetwork {
+		args = append(args, "--network", spec.Network)
+	}
 
-		if environmentFile != "" {
-			runCommand += fmt.Sprintf(" --env-file /etc/%s/%s.env", name, name)
-		}
+	if spec.EnvironmentFile != "" {
+		args = append(args, "--env-file", spec.EnvironmentFile)
+	}
+
+	args = append(args, spec.Image)
+
+	return shellCommand(args...)
+}
 
-		runCommand += fmt.Sprintf(" %s", imageTag)
+func (r *remote) runContainer(spec ContainerSpec, labels []string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("running container")
 
-		_, _, err := runSSHCommand(client, runCommand, r.config.Name)
+		_, _, err := runSSHCommand(client, runContainerCommand(spec, labels), r.config.Name)
 		if err != nil {
 			return err
 		}
@@ -333,7 +459,17 @@ func (r *remote) runContainer(name string, imageTag string, volumes []string, en
 	})
 }
 
-func (r *remote) streamContainerLogs(name string) error {
+func containerLogsCommand(name string, since string, tail int) string {
+	args := []string{"sudo", "docker", "logs", "--follow", "--tail", strconv.Itoa(tail)}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	return shellCommand(append(args, name)...)
+}
+
+// streamContainerLogs follows the container logs starting with the last tail lines, since limits them to a
+// duration or timestamp as accepted by docker logs --since
+func (r *remote) streamContainerLogs(name string, since string, tail int) error {
 	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
 		fmt.Println("streaming container logs...")
 
@@ -353,7 +489,7 @@ func (r *remote) streamContainerLogs(name string) error {
 			return err
 		}
 
-		err = session.Start(fmt.Sprintf("sudo docker logs --follow --tail 30 %s", name))
+		err = session.Start(containerLogsCommand(name, since, tail))
 		if err != nil {
 			return err
 		}
@@ -401,7 +537,7 @@ func (r *remote) downloadContainerLogs(name string) error {
 
 		fmt.Printf("downloading logs for container %s to %s\n", name, localLogPath)
 
-		logs, _, err := runSSHCommand(client, fmt.Sprintf("sudo docker logs %s", name), r.config.Name)
+		logs, _, err := runSSHCommand(client, shellCommand("sudo", "docker", "logs", name), r.config.Name)
 		if err != nil {
 			return err
 		}
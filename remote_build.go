@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// files docker always sends with the build context, even when ignored
+var alwaysIncludedContextFiles = []string{"Dockerfile", ".dockerignore"}
+
+// writeBuildContext writes a gzipped tar of the build context in dir, skipping files excluded by patterns.
+// extraFiles are added at the root of the context, used to ship a dockerfile kept outside the context.
+func writeBuildContext(dir string, patterns []string, extraFiles map[string][]byte, w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// negated patterns can re-include files inside ignored directories, so those must still be walked
+	canSkipDirs := !hasNegatedPattern(patterns)
+
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		alwaysIncluded := false
+		for _, name := range alwaysIncludedContextFiles {
+			if relPath == name {
+				alwaysIncluded = true
+			}
+		}
+
+		if !alwaysIncluded && matchesDockerIgnore(relPath, patterns) {
+			if info.IsDir() && canSkipDirs {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() {
+				return nil
+			}
+		}
+
+		paths = append(paths, relPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+
+	for _, relPath := range paths {
+		fullPath := filepath.Join(dir, filepath.FromSlash(relPath))
+
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(fullPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			file, err := os.Open(fullPath)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(tarWriter, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	extraNames := []string{}
+	for name := range extraFiles {
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+
+	for _, name := range extraNames {
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(extraFiles[name])),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(extraFiles[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+// remoteBuildContainer ships the build context to the server and builds the image there, streaming the
+// build output back
+func (r *remote) remoteBuildContainer(tag string) error {
+	buildArgs := map[string]string{}
+	if r.config.BuildArgFile != "" {
+		args, err := parseBuildArgFile(r.config.BuildArgFile)
+		if err != nil {
+			return err
+		}
+		buildArgs = args
+	}
+
+	unsupported := localOnlyBuildOptions(r.config)
+	if len(unsupported) > 0 {
+		fmt.Printf("warning: build options %s only apply to local builds and are ignored\n", strings.Join(unsupported, ", "))
+	}
+
+	contextDir := buildContextDir(r.config)
+
+	patterns := loadDockerIgnorePatternsFrom(contextDir)
+	if len(patterns) > 0 {
+		fmt.Printf("loaded %d patterns from .dockerignore\n", len(patterns))
+	}
+
+	// the dockerfile may live outside the context, so it is shipped under a fixed name
+	extraFiles := map[string][]byte{}
+	if r.config.Build.Dockerfile != "" {
+		dockerfile, err := os.ReadFile(r.config.Build.Dockerfile)
+		if err != nil {
+			return fmt.Errorf("failed to read dockerfile: %v", err)
+		}
+		extraFiles[remoteDockerfileName] = dockerfile
+	}
+
+	contextFile, err := os.CreateTemp("", fmt.Sprintf("%s-context-*.tar.gz", r.config.Name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(contextFile.Name())
+
+	fmt.Println("packaging build context")
+	err = writeBuildContext(contextDir, patterns, extraFiles, contextFile)
+	contextFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to package build context: %v", err)
+	}
+
+	info, err := os.Stat(contextFile.Name())
+	if err == nil {
+		fmt.Printf("build context is %s\n", formatBytes(info.Size()))
+	}
+
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		// every build gets its own directory so concurrent builds of the same app don't overwrite each other
+		buildDirTemplate := fmt.Sprintf("/tmp/%s-build.XXXXXXXX", r.config.Name)
+		output, _, err := runSSHCommand(client, shellCommand("mktemp", "-d", buildDirTemplate), "")
+		if err != nil {
+			return fmt.Errorf("failed to create remote build directory: %v", err)
+		}
+
+		buildDir := strings.TrimSpace(output)
+		if buildDir == "" {
+			// plan mode doesn't create the directory
+			buildDir = buildDirTemplate
+		}
+
+		remoteContext := fmt.Sprintf("%s/context.tar.gz", buildDir)
+		remoteDir := fmt.Sprintf("%s/context", buildDir)
+
+		defer func() {
+			_, _, err := runSSHCommand(client, shellCommand("rm", "-rf", buildDir), "")
+			if err != nil {
+				fmt.Printf("warning: failed to cleanup remote build context: %v\n", err)
+			}
+		}()
+
+		fmt.Println("copying build context to server")
+		err = sftpCopyFileToRemote(client, contextFile.Name(), remoteContext)
+		if err != nil {
+			return err
+		}
+
+		_, _, err = runSSHCommand(client, shellAnd(
+			shellCommand("mkdir", remoteDir),
+			shellCommand("tar", "-xzf", remoteContext, "-C", remoteDir),
+		), "")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("building container on server")
+		err = runSSHCommandStreaming(client, shellAnd(shellCommand("cd", remoteDir), remoteBuildCommand(r.config, tag, buildArgs, time.Now())), r.config.Name)
+		if err != nil {
+			return fmt.Errorf("remote build failed: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// pushContainerFromHost pushes an image built on the server, and its extra tags, to the registry with the
+// app's credentials
+func (r *remote) pushContainerFromHost(tag string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		fmt.Println("pushing container to registry from server")
+
+		for _, pushTag := range append([]string{tag}, r.config.Build.Tags...) {
+			err := runSSHCommandStreaming(client, appDockerCommand(r.config.Name, "push", pushTag), r.config.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
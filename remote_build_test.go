@@ -0,0 +1,60 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBuildContext(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"Dockerfile":                "FROM scratch",
+		".dockerignore":             "node_modules\n.dockerignore\n",
+		"main.go":                   "package main",
+		"node_modules/pkg/index.js": "ignored",
+		"static/app.css":            "body {}",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	var buf bytes.Buffer
+	err := writeBuildContext(dir, []string{"node_modules", ".dockerignore"}, map[string][]byte{remoteDockerfileName: []byte("FROM alpine")}, &buf)
+	assert.NoError(t, err)
+
+	gzipReader, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	tarReader := tar.NewReader(gzipReader)
+
+	names := []string{}
+	contents := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+
+		names = append(names, header.Name)
+		if header.Typeflag == tar.TypeReg {
+			content, _ := io.ReadAll(tarReader)
+			contents[header.Name] = string(content)
+		}
+	}
+
+	// the dockerignore itself is always sent, same as docker
+	assert.Equal(t, []string{".dockerignore", "Dockerfile", "main.go", "static/", "static/app.css", remoteDockerfileName}, names)
+	assert.Equal(t, "FROM scratch", contents["Dockerfile"])
+	assert.Equal(t, "FROM alpine", contents[remoteDockerfileName])
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunContainerCommand(t *testing.T) {
+	advanced := WebAdvancedConfig{MaxRequestBodyBytes: -1, MaxResponseBodyBytes: -1, MemRequestBodyBytes: -1}
+
+	t.Run("worker", func(t *testing.T) {
+		c := &Config{Name: "myapp", WebAdvancedConfig: advanced}
+		cmd := runContainerCommand(containerSpec(c, "registry.example.com/myapp:latest", ""), nil)
+		assert.Equal(t, "sudo docker run -d --restart unless-stopped --name myapp -v /var/myapp:/data registry.example.com/myapp:latest", cmd)
+	})
+
+	t.Run("web app with env file", func(t *testing.T) {
+		c := &Config{Name: "myapp", Web: true, Hostname: "myapp.example.com", EnvironmentFile: "prod.env", WebAdvancedConfig: advanced}
+		c.WebAdvancedConfig.MaxRequestBodyBytes = 1024
+
+		cmd := runContainerCommand(containerSpec(c, "myapp:latest", "abc123"), []string{"lord.git=abc123"})
+		assert.Equal(t, "sudo docker run -d --restart unless-stopped --name myapp -v /var/myapp:/data --label lord.git=abc123 "+
+			"--label lord.env.sha256=abc123 "+
+			"--label traefik.enable=true "+
+			"--label traefik.http.middlewares.myapp-buffering.buffering.maxrequestbodybytes=1024 "+
+			"--label traefik.http.routers.myapp.entryPoints=websecure "+
+			"--label traefik.http.routers.myapp.middlewares=myapp-buffering "+
+			"--label 'traefik.http.routers.myapp.rule=Host(`myapp.example.com`) || Host(`www.myapp.example.com`)' "+
+			"--label traefik.http.routers.myapp.tls.certresolver=theresolver "+
+			"--label traefik.http.services.myapp.loadbalancer.server.port=80 "+
+			"--network traefik --env-file /etc/myapp/myapp.env myapp:latest", cmd)
+	})
+
+	t.Run("hostile volumes and labels stay single arguments", func(t *testing.T) {
+		c := &Config{Name: "myapp", Volumes: []string{"/srv/my data;reboot:/data"}, WebAdvancedConfig: advanced}
+		cmd := runContainerCommand(containerSpec(c, "myapp:latest", ""), []string{"note=$(whoami) it's"})
+		assert.Equal(t, "sudo docker run -d --restart unless-stopped --name myapp -v /var/myapp:/data -v '/srv/my data;reboot:/data' --label 'note=$(whoami) it'\\''s' myapp:latest", cmd)
+	})
+}
+
+func TestAppDockerCommand(t *testing.T) {
+	assert.Equal(t, "sudo docker --config /etc/lord/myapp/docker pull myapp:latest", appDockerCommand("myapp", "pull", "myapp:latest"))
+}
+
+func TestHostEnvironmentSourceCommand(t *testing.T) {
+	assert.Equal(t, "if test -f /etc/lord/myapp/host.env; then source /etc/lord/myapp/host.env; elif test -f /etc/lord/myapp; then source /etc/lord/myapp; fi", hostEnvironmentSourceCommand("myapp"))
+}
+
+func TestContainerLogsCommand(t *testing.T) {
+	assert.Equal(t, "sudo docker logs --follow --tail 30 myapp", containerLogsCommand("myapp", "", 30))
+	assert.Equal(t, "sudo docker logs --follow --tail 0 --since 2026-01-02T15:04:05Z myapp", containerLogsCommand("myapp", "2026-01-02T15:04:05Z", 0))
+}
+
+func TestParseContainerStatus(t *testing.T) {
+	status, err := parseContainerStatus("myapp", `[{
+  "Name": "/myapp",
+  "State": {"Running": true, "Status": "running"},
+  "Config": {
+    "Image": "myapp:0123456789ab",
+    "Labels": {
+      "org.opencontainers.image.revision": "0123456789abcdef",
+      "lord.branch": "main",
+      "lord.deployed": "2026-01-02T03:04:05Z",
+      "lord.deployer": "jane"
+    }
+  }
+}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, ContainerStatus{
+		Name:     "myapp",
+		Found:    true,
+		Running:  true,
+		State:    "running",
+		Image:    "myapp:0123456789ab",
+		Revision: "0123456789abcdef",
+		Branch:   "main",
+		Deployed: "2026-01-02T03:04:05Z",
+		Deployer: "jane",
+	}, status)
+
+	_, err = parseContainerStatus("myapp", "[]")
+	assert.Error(t, err)
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// first line of an encrypted env file, also authenticated as additional data so it can't be swapped
+const secretsHeader = "LORD-ENCRYPTED v1 aes-256-gcm"
+
+// secretValueOutput is where secrets get prints the value, the banner and progress output go to stderr
+var secretValueOutput io.Writer = os.Stdout
+
+// environment variable holding the base64 secrets key, takes precedence over the key file
+const secretsKeyEnv = "LORD_SECRETS_KEY"
+
+const secretsKeySize = 32
+
+// line width of the base64 body of encrypted files
+const secretsLineWidth = 64
+
+// isEncryptedFile reports whether file contents are a lord encrypted env file
+func isEncryptedFile(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(secretsHeader+"\n"))
+}
+
+func generateSecretsKey() ([]byte, error) {
+	key := make([]byte, secretsKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func encodeSecretsKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func parseSecretsKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key must be base64 encoded: %v", err)
+	}
+	if len(key) != secretsKeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", secretsKeySize, len(key))
+	}
+	return key, nil
+}
+
+func secretsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecrets encrypts plaintext into the encrypted file format: the header line followed by the base64
+// nonce and ciphertext wrapped over several lines
+func encryptSecrets(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := secretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(secretsHeader))
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+
+	var out bytes.Buffer
+	out.WriteString(secretsHeader + "\n")
+	for len(encoded) > secretsLineWidth {
+		out.WriteString(encoded[:secretsLineWidth] + "\n")
+		encoded = encoded[secretsLineWidth:]
+	}
+	out.WriteString(encoded + "\n")
+
+	return out.Bytes(), nil
+}
+
+// decryptSecrets decrypts the contents of an encrypted file
+func decryptSecrets(key []byte, content []byte) ([]byte, error) {
+	if !isEncryptedFile(content) {
+		return nil, fmt.Errorf("not a lord encrypted file")
+	}
+
+	body := strings.Join(strings.Fields(string(content[len(secretsHeader)+1:])), "")
+	sealed, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted file: %v", err)
+	}
+
+	gcm, err := secretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted file: too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(secretsHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong secrets key or the file was modified")
+	}
+
+	return plaintext, nil
+}
+
+// loadSecretsKey reads the secrets key from the environment or the key file, returning where it was found
+func loadSecretsKey(c *Config) ([]byte, string, error) {
+	encoded := os.Getenv(secretsKeyEnv)
+	if encoded != "" {
+		key, err := parseSecretsKey(encoded)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %v", secretsKeyEnv, err)
+		}
+		return key, secretsKeyEnv, nil
+	}
+
+	content, err := os.ReadFile(c.Secrets.KeyFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("no secrets key, set %s or create %s: %v", secretsKeyEnv, c.Secrets.KeyFile, err)
+	}
+
+	key, err := parseSecretsKey(string(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", c.Secrets.KeyFile, err)
+	}
+
+	return key, c.Secrets.KeyFile, nil
+}
+
+// ensureSecretsKey loads the secrets key, generating a key file when there is no key yet
+func ensureSecretsKey(c *Config) ([]byte, error) {
+	key, _, err := loadSecretsKey(c)
+	if err == nil {
+		return key, nil
+	}
+
+	if os.Getenv(secretsKeyEnv) != "" {
+		return nil, err
+	}
+	_, statErr := os.Stat(c.Secrets.KeyFile)
+	if statErr == nil {
+		return nil, err
+	}
+
+	// the key must never be committed next to the files it encrypts
+	err = ignoreInGit(c.Secrets.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to generate a secrets key: %v", err)
+	}
+
+	key, err = generateSecretsKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(c.Secrets.KeyFile, []byte(encodeSecretsKey(key)+"\n"), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %v", err)
+	}
+
+	fmt.Printf("generated secrets key %s, share it with your team out of band\n", c.Secrets.KeyFile)
+
+	return key, nil
+}
+
+// readEnvironmentFile returns the contents of an env file, decrypting it in memory when it is encrypted
+func readEnvironmentFile(c *Config, path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncryptedFile(content) {
+		return content, nil
+	}
+
+	key, _, err := loadSecretsKey(c)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decryptSecrets(key, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// values of encrypted files are secret by definition, keep them out of anything lord prints
+	values, err := parseKeyValueContent(plaintext, path, "environment")
+	if err == nil {
+		for _, value := range values {
+			registerSecret(value)
+		}
+	}
+
+	return plaintext, nil
+}
+
+// setEnvironmentValue sets a KEY=value line in env file contents, replacing an existing assignment in place
+// or appending a new one. values are written as is since docker reads env files without unquoting.
+func setEnvironmentValue(content []byte, key string, value string) []byte {
+	assignment := fmt.Sprintf("%s=%s", key, value)
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = []string{}
+	}
+
+	replaced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "export "))
+		lineKey, _, found := strings.Cut(trimmed, "=")
+		if found && strings.TrimSpace(lineKey) == key {
+			lines[i] = assignment
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		lines = append(lines, assignment)
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// secretsTarget returns the env file the secrets commands act on
+func secretsTarget(c *Config, host bool) (string, error) {
+	if host {
+		if c.HostEnvironmentFile == "" {
+			return "", fmt.Errorf("hostenvironmentfile is not set in the config")
+		}
+		return c.HostEnvironmentFile, nil
+	}
+
+	if c.EnvironmentFile == "" {
+		return "", fmt.Errorf("environmentfile is not set in the config")
+	}
+	return c.EnvironmentFile, nil
+}
+
+// writeEncryptedFile encrypts plaintext and writes it over path, plain text files are encrypted in place
+func writeEncryptedFile(path string, key []byte, plaintext []byte) error {
+	content, err := encryptSecrets(key, plaintext)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// validateEnvironmentContent checks edited contents parse as an env file before they are saved
+func validateEnvironmentContent(content []byte, path string) error {
+	_, err := parseKeyValueContent(content, path, "environment")
+	return err
+}
+
+// secretsGet prints the value of one variable from an env file
+func secretsGet(c *Config, path string, key string) error {
+	content, err := readEnvironmentFile(c, path)
+	if err != nil {
+		return err
+	}
+
+	values, err := parseKeyValueContent(content, path, "environment")
+	if err != nil {
+		return err
+	}
+
+	value, exists := values[key]
+	if !exists {
+		return fmt.Errorf("%s is not set in %s", key, path)
+	}
+
+	_, err = fmt.Fprintln(secretValueOutput, value)
+	return err
+}
+
+// secretsSet sets one variable in an env file. the value is read from stdin when not given as KEY=value so it
+// stays out of the shell history.
+func secretsSet(c *Config, path string, assignment string) error {
+	key, value, hasValue := strings.Cut(assignment, "=")
+	if !variableNamePattern.MatchString(key) {
+		return fmt.Errorf("invalid variable name %q", key)
+	}
+
+	if !hasValue {
+		fmt.Fprintf(os.Stderr, "value for %s: ", key)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read value: %v", err)
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("env file values can't contain newlines")
+	}
+
+	encryptionKey, err := ensureSecretsKey(c)
+	if err != nil {
+		return err
+	}
+
+	// a missing env file is created with just this variable
+	content, err := readEnvironmentFile(c, path)
+	if os.IsNotExist(err) {
+		fmt.Printf("%s not found, creating it\n", path)
+		content, err = []byte{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeEncryptedFile(path, encryptionKey, setEnvironmentValue(content, key, value))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("set %s in %s\n", key, path)
+
+	return nil
+}
+
+// secretsEditDir returns the memory backed directory the plaintext is placed in while editing. without one
+// the plaintext would land on disk, so editing is refused rather than falling back to the temp dir.
+func secretsEditDir() (string, error) {
+	info, err := os.Stat("/dev/shm")
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("no memory backed directory (/dev/shm) to edit the plaintext in, use lord secrets set instead")
+	}
+	return "/dev/shm", nil
+}
+
+// secretsEdit opens the decrypted env file in $VISUAL or $EDITOR and encrypts the result. the editor needs a
+// file, so the plaintext lives in a private file in memory only for as long as the editor is open.
+func secretsEdit(c *Config, path string) error {
+	editDir, err := secretsEditDir()
+	if err != nil {
+		return err
+	}
+
+	key, err := ensureSecretsKey(c)
+	if err != nil {
+		return err
+	}
+
+	content, err := readEnvironmentFile(c, path)
+	if err != nil {
+		return err
+	}
+
+	editFile, err := os.CreateTemp(editDir, "lord-secrets-*.env")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(editFile.Name())
+
+	_, err = editFile.Write(content)
+	editFile.Close()
+	if err != nil {
+		return err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	editorArgs := append(strings.Fields(editor), editFile.Name())
+	cmd := exec.Command(editorArgs[0], editorArgs[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor failed, %s was not changed: %v", path, err)
+	}
+
+	edited, err := os.ReadFile(editFile.Name())
+	if err != nil {
+		return err
+	}
+
+	// overwrite the plaintext before the temp file is removed
+	os.WriteFile(editFile.Name(), make([]byte, len(edited)), 0600)
+
+	err = validateEnvironmentContent(edited, path)
+	if err != nil {
+		return fmt.Errorf("%v, %s was not changed", err, path)
+	}
+
+	err = writeEncryptedFile(path, key, edited)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("saved encrypted %s\n", path)
+
+	return nil
+}
+
+// secretsRotate re-encrypts every encrypted env file in the config with a new key
+func secretsRotate(c *Config) error {
+	oldKey, source, err := loadSecretsKey(c)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := generateSecretsKey()
+	if err != nil {
+		return err
+	}
+
+	// decrypt everything up front so a bad file doesn't leave the set half rotated
+	plaintexts := map[string][]byte{}
+	for _, path := range []string{c.EnvironmentFile, c.HostEnvironmentFile} {
+		if path == "" {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !isEncryptedFile(content) {
+			continue
+		}
+
+		plaintext, err := decryptSecrets(oldKey, content)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		plaintexts[path] = plaintext
+	}
+
+	if len(plaintexts) == 0 {
+		return fmt.Errorf("no encrypted env files in the config to rotate")
+	}
+
+	// the new key is saved next to the old one until every file is re-encrypted
+	pendingKeyFile := c.Secrets.KeyFile + ".new"
+	if source != secretsKeyEnv {
+		err = os.WriteFile(pendingKeyFile, []byte(encodeSecretsKey(newKey)+"\n"), 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write new secrets key: %v", err)
+		}
+	}
+
+	for path, plaintext := range plaintexts {
+		err = writeEncryptedFile(path, newKey, plaintext)
+		if err != nil && source == secretsKeyEnv {
+			return fmt.Errorf("failed to re-encrypt %s, files already rotated use the new key %s: %v", path, encodeSecretsKey(newKey), err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt %s, files already rotated use the new key in %s: %v", path, pendingKeyFile, err)
+		}
+		fmt.Printf("re-encrypted %s\n", path)
+	}
+
+	if source == secretsKeyEnv {
+		fmt.Printf("secrets key rotated, set %s to the new key:\n%s\n", secretsKeyEnv, encodeSecretsKey(newKey))
+		return nil
+	}
+
+	err = os.Rename(pendingKeyFile, c.Secrets.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to replace secrets key, the new key is in %s: %v", pendingKeyFile, err)
+	}
+
+	fmt.Printf("secrets key rotated, share the new %s with your team\n", c.Secrets.KeyFile)
+
+	return nil
+}
+
+// runSecretsCommand dispatches the actions of lord secrets
+func runSecretsCommand(c *Config, command string, args []string, host bool) error {
+	if command == "rotate" {
+		return secretsRotate(c)
+	}
+
+	path, err := secretsTarget(c, host)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "edit":
+		return secretsEdit(c, path)
+	case "set":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: lord secrets set KEY=value (or KEY to read the value from stdin)")
+		}
+		return secretsSet(c, path, args[0])
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: lord secrets get KEY")
+		}
+		return secretsGet(c, path, args[0])
+	default:
+		return fmt.Errorf("unknown secrets command %q, expected edit, set, get or rotate", command)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const redactedValue = "********"
+
+// secret values seen during this run, redacted from every command and output lord prints
+var registeredSecrets = []string{}
+
+// assignments and flags that carry secrets by name, i.e. REGISTRY_HTTP_SECRET=... or --password ...
+var secretAssignmentPattern = regexp.MustCompile(`(?i)(\b[a-z0-9_]*(?:password|token|secret)[a-z0-9_]*=|--password[= ])([^\s'"]+)`)
+
+// registerSecret marks a value as secret so it is redacted from lord's output. very short values are ignored
+// as redacting them would mangle unrelated output.
+func registerSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < 4 {
+		return
+	}
+
+	for _, existing := range registeredSecrets {
+		if existing == value {
+			return
+		}
+	}
+
+	registeredSecrets = append(registeredSecrets, value)
+
+	// replace longer secrets first so a secret containing another is fully redacted
+	sort.Slice(registeredSecrets, func(i, j int) bool {
+		return len(registeredSecrets[i]) > len(registeredSecrets[j])
+	})
+}
+
+// redactSecrets masks registered secrets and secret looking assignments in text before it is printed
+func redactSecrets(text string) string {
+	for _, secret := range registeredSecrets {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+
+	return secretAssignmentPattern.ReplaceAllString(text, "${1}"+redactedValue)
+}
+
+// secretFileCommand writes stdin to path with 0600 permissions from the moment the file is created. host
+// files sourced by lord's own commands are owned by the ssh user so they stay readable without sudo.
+func secretFileCommand(path string, userOwned bool) string {
+	cmd := sudoShell(shellAnd("umask 077", "cat > "+shellQuote(path), shellCommand("chmod", "600", path)))
+	if userOwned {
+		cmd = shellAnd(cmd, "sudo chown \"$(id -un)\" "+shellQuote(path))
+	}
+	return cmd
+}
+
+// writeRemoteSecretFile writes secret contents to a file on the host over stdin, so they never appear in a
+// command line or with readable permissions
+func writeRemoteSecretFile(client *ssh.Client, path string, content []byte, userOwned bool) error {
+	if planning() {
+		planUpload("", path, int64(len(content)), "mode 0600")
+		return nil
+	}
+
+	_, stderr, err := runSSHCommandWithInput(client, secretFileCommand(path, userOwned), content, "")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v %s", path, err, stderr)
+	}
+	return nil
+}
+
+// SecretFile is a file on the host holding secret material
+type SecretFile struct {
+	Path string
+
+	// permission bits as read from the host
+	Mode  uint32
+	Owner string
+}
+
+// WorldReadable reports whether any user on the host can read the file
+func (sf SecretFile) WorldReadable() bool {
+	return sf.Mode&0004 != 0
+}
+
+// GroupReadable reports whether the file's group can read it
+func (sf SecretFile) GroupReadable() bool {
+	return sf.Mode&0040 != 0
+}
+
+// secretsAuditCommand lists the mode, owner and path of every file lord writes secrets to on the host:
+// app env files, host env files, registry credentials, the self-hosted registry auth and the acme store
+const secretsAuditCommand = `sudo sh -c 'for f in /etc/lord/*/host.env /etc/lord/*/docker/config.json /etc/lord/_registry/* /etc/traefik/acme.json; do [ -f "$f" ] && stat -c "%a %U %n" "$f"; done; for f in /etc/*/*.env; do n=$(basename "$f" .env); [ "$f" = "/etc/$n/$n.env" ] && stat -c "%a %U %n" "$f"; done; true'`
+
+// parseSecretFiles parses the output of secretsAuditCommand
+func parseSecretFiles(output string) ([]SecretFile, error) {
+	files := []SecretFile{}
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected stat output: %s", line)
+		}
+
+		mode, err := strconv.ParseUint(fields[0], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected file mode in stat output: %s", line)
+		}
+
+		files = append(files, SecretFile{Path: fields[2], Mode: uint32(mode), Owner: fields[1]})
+	}
+
+	return files, nil
+}
+
+// SecretsAuditReport is the result of lord secrets-audit --json
+type SecretsAuditReport struct {
+	Files         []SecretsAuditFile `json:"files"`
+	WorldReadable int                `json:"worldReadable"`
+}
+
+// SecretsAuditFile is a secret file on the host, status is ok, group or world depending on who can read it
+type SecretsAuditFile struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Owner  string `json:"owner"`
+	Status string `json:"status"`
+}
+
+func secretsAuditReport(files []SecretFile) SecretsAuditReport {
+	report := SecretsAuditReport{Files: []SecretsAuditFile{}}
+	for _, file := range files {
+		status := "ok"
+		if file.WorldReadable() {
+			status = "world"
+			report.WorldReadable++
+		} else if file.GroupReadable() {
+			status = "group"
+		}
+
+		report.Files = append(report.Files, SecretsAuditFile{
+			Path:   file.Path,
+			Mode:   fmt.Sprintf("%o", file.Mode),
+			Owner:  file.Owner,
+			Status: status,
+		})
+	}
+	return report
+}
+
+// auditHostSecrets reports secret files on the host that other users can read
+func (r *remote) auditHostSecrets(asJson bool) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		output, _, err := runSSHQuery(client, secretsAuditCommand, "")
+		if err != nil {
+			return fmt.Errorf("failed to list secret files: %v", err)
+		}
+
+		files, err := parseSecretFiles(output)
+		if err != nil {
+			return err
+		}
+
+		report := secretsAuditReport(files)
+		if asJson {
+			err = writeJson(report)
+			if err != nil {
+				return err
+			}
+		}
+
+		exposed := report.WorldReadable
+		fmt.Printf("\n%-6s %-10s %-8s %s\n", "MODE", "OWNER", "STATUS", "FILE")
+		for _, file := range report.Files {
+			status := file.Status
+			if status == "world" {
+				status = "WORLD"
+			}
+
+			fmt.Printf("%-6s %-10s %-8s %s\n", file.Mode, file.Owner, status, file.Path)
+		}
+		fmt.Println()
+
+		if exposed > 0 {
+			return fmt.Errorf("%d secret files are world-readable, fix with sudo chmod 600 <file> or redeploy the app", exposed)
+		}
+
+		fmt.Printf("checked %d secret files, none are world-readable\n", len(files))
+
+		return nil
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	previous := registeredSecrets
+	registeredSecrets = []string{}
+	t.Cleanup(func() { registeredSecrets = previous })
+
+	registerSecret("hunter2hunter2")
+	registerSecret("hunter2hunter2-extended")
+	registerSecret("ab")
+
+	assert.Equal(t, "echo '********' | docker login", redactSecrets("echo 'hunter2hunter2' | docker login"))
+	assert.Equal(t, "token ********", redactSecrets("token hunter2hunter2-extended"))
+	assert.Equal(t, "ab stays", redactSecrets("ab stays"))
+
+	assert.Equal(t, "REGISTRY_HTTP_SECRET=******** REGISTRY_AUTH=htpasswd", redactSecrets("REGISTRY_HTTP_SECRET=abc123 REGISTRY_AUTH=htpasswd"))
+	assert.Equal(t, "docker login --password ******** ghcr.io", redactSecrets("docker login --password abc123 ghcr.io"))
+	assert.Equal(t, `echo "$GHCR_TOKEN" | docker login --password-stdin`, redactSecrets(`echo "$GHCR_TOKEN" | docker login --password-stdin`))
+	assert.Equal(t, "REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd", redactSecrets("REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd"))
+}
+
+func TestSecretFileCommand(t *testing.T) {
+	assert.Equal(t, "sudo sh -c 'umask 077 && cat > /etc/myapp/myapp.env && chmod 600 /etc/myapp/myapp.env'", secretFileCommand("/etc/myapp/myapp.env", false))
+	assert.Equal(t, "sudo sh -c 'umask 077 && cat > /etc/lord/myapp/host.env && chmod 600 /etc/lord/myapp/host.env' && sudo chown \"$(id -un)\" /etc/lord/myapp/host.env", secretFileCommand("/etc/lord/myapp/host.env", true))
+}
+
+func TestParseSecretFiles(t *testing.T) {
+	files, err := parseSecretFiles(`600 ubuntu /etc/lord/myapp/host.env
+644 root /etc/myapp/myapp.env
+640 root /etc/lord/_registry/htpasswd
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []SecretFile{
+		{Path: "/etc/lord/myapp/host.env", Mode: 0600, Owner: "ubuntu"},
+		{Path: "/etc/myapp/myapp.env", Mode: 0644, Owner: "root"},
+		{Path: "/etc/lord/_registry/htpasswd", Mode: 0640, Owner: "root"},
+	}, files)
+
+	assert.False(t, files[0].WorldReadable())
+	assert.True(t, files[1].WorldReadable())
+	assert.False(t, files[2].WorldReadable())
+	assert.True(t, files[2].GroupReadable())
+
+	files, err = parseSecretFiles("")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = parseSecretFiles("rw-r--r-- root /etc/myapp/myapp.env")
+	assert.Error(t, err)
+}
+
+func TestSecretsAuditReport(t *testing.T) {
+	report := secretsAuditReport([]SecretFile{
+		{Path: "/etc/lord/myapp/host.env", Mode: 0600, Owner: "ubuntu"},
+		{Path: "/etc/myapp/prod.env", Mode: 0640, Owner: "root"},
+		{Path: "/etc/traefik/acme.json", Mode: 0644, Owner: "root"},
+	})
+
+	assert.Equal(t, 1, report.WorldReadable)
+	assert.Equal(t, []SecretsAuditFile{
+		{Path: "/etc/lord/myapp/host.env", Mode: "600", Owner: "ubuntu", Status: "ok"},
+		{Path: "/etc/myapp/prod.env", Mode: "640", Owner: "root", Status: "group"},
+		{Path: "/etc/traefik/acme.json", Mode: "644", Owner: "root", Status: "world"},
+	}, report.Files)
+
+	assert.Equal(t, SecretsAuditReport{Files: []SecretsAuditFile{}}, secretsAuditReport(nil))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecryptSecrets(t *testing.T) {
+	key, err := generateSecretsKey()
+	assert.NoError(t, err)
+
+	plaintext := []byte("DATABASE_URL=postgres://user:pass@db/app\nAPI_TOKEN=" + strings.Repeat("x", 100) + "\n")
+
+	encrypted, err := encryptSecrets(key, plaintext)
+	assert.NoError(t, err)
+	assert.True(t, isEncryptedFile(encrypted))
+	assert.NotContains(t, string(encrypted), "postgres")
+
+	for _, line := range strings.Split(strings.TrimSpace(string(encrypted)), "\n") {
+		assert.LessOrEqual(t, len(line), secretsLineWidth)
+	}
+
+	decrypted, err := decryptSecrets(key, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	otherKey, err := generateSecretsKey()
+	assert.NoError(t, err)
+	_, err = decryptSecrets(otherKey, encrypted)
+	assert.EqualError(t, err, "failed to decrypt, wrong secrets key or the file was modified")
+
+	tampered := []byte(strings.Replace(string(encrypted), "\n", "\nAAAA", 1))
+	_, err = decryptSecrets(key, tampered)
+	assert.Error(t, err)
+
+	_, err = decryptSecrets(key, plaintext)
+	assert.EqualError(t, err, "not a lord encrypted file")
+}
+
+func TestParseSecretsKey(t *testing.T) {
+	key, err := generateSecretsKey()
+	assert.NoError(t, err)
+
+	parsed, err := parseSecretsKey(encodeSecretsKey(key) + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = parseSecretsKey("not base64!")
+	assert.Error(t, err)
+
+	_, err = parseSecretsKey(encodeSecretsKey(key[:16]))
+	assert.EqualError(t, err, "secrets key must be 32 bytes, got 16")
+}
+
+func TestSetEnvironmentValue(t *testing.T) {
+	content := []byte("# app settings\nexport PORT=80\nAPI_TOKEN=old\n")
+
+	assert.Equal(t, "# app settings\nexport PORT=80\nAPI_TOKEN=new=value\n", string(setEnvironmentValue(content, "API_TOKEN", "new=value")))
+	assert.Equal(t, "# app settings\nPORT=8080\nAPI_TOKEN=old\n", string(setEnvironmentValue(content, "PORT", "8080")))
+	assert.Equal(t, "# app settings\nexport PORT=80\nAPI_TOKEN=old\nDEBUG=true\n", string(setEnvironmentValue(content, "DEBUG", "true")))
+	assert.Equal(t, "DEBUG=true\n", string(setEnvironmentValue([]byte{}, "DEBUG", "true")))
+}
+
+func TestReadEnvironmentFile(t *testing.T) {
+	chdirTemp(t)
+
+	key, err := generateSecretsKey()
+	assert.NoError(t, err)
+	t.Setenv(secretsKeyEnv, encodeSecretsKey(key))
+
+	c := &Config{Secrets: SecretsConfig{KeyFile: ".lord.key"}}
+
+	assert.NoError(t, os.WriteFile("plain.env", []byte("PORT=80\n"), 0644))
+	content, err := readEnvironmentFile(c, "plain.env")
+	assert.NoError(t, err)
+	assert.Equal(t, "PORT=80\n", string(content))
+
+	assert.NoError(t, writeEncryptedFile("secret.env", key, []byte("API_TOKEN=abc\n")))
+	content, err = readEnvironmentFile(c, "secret.env")
+	assert.NoError(t, err)
+	assert.Equal(t, "API_TOKEN=abc\n", string(content))
+
+	t.Setenv(secretsKeyEnv, "")
+	_, err = readEnvironmentFile(c, "secret.env")
+	assert.ErrorContains(t, err, "no secrets key, set LORD_SECRETS_KEY or create .lord.key")
+}
+
+func TestSecretsSetGetRotate(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv(secretsKeyEnv, "")
+
+	assert.NoError(t, os.WriteFile(".env", []byte("PORT=80\n"), 0644))
+	c := &Config{EnvironmentFile: ".env", Secrets: SecretsConfig{KeyFile: ".lord.key"}}
+
+	// setting a value encrypts a plain text file in place and generates the key
+	assert.NoError(t, runSecretsCommand(c, "set", []string{"API_TOKEN=abc"}, false))
+
+	info, err := os.Stat(".lord.key")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	encrypted, err := os.ReadFile(".env")
+	assert.NoError(t, err)
+	assert.True(t, isEncryptedFile(encrypted))
+
+	oldKey, err := os.ReadFile(".lord.key")
+	assert.NoError(t, err)
+
+	assert.NoError(t, runSecretsCommand(c, "rotate", nil, false))
+
+	newKey, err := os.ReadFile(".lord.key")
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+
+	content, err := readEnvironmentFile(c, ".env")
+	assert.NoError(t, err)
+	assert.Equal(t, "PORT=80\nAPI_TOKEN=abc\n", string(content))
+
+	var value bytes.Buffer
+	secretValueOutput = &value
+	t.Cleanup(func() { secretValueOutput = os.Stdout })
+
+	assert.NoError(t, runSecretsCommand(c, "get", []string{"API_TOKEN"}, false))
+	assert.Equal(t, "abc\n", value.String())
+	assert.EqualError(t, runSecretsCommand(c, "get", []string{"MISSING"}, false), "MISSING is not set in .env")
+	assert.EqualError(t, runSecretsCommand(c, "get", nil, true), "hostenvironmentfile is not set in the config")
+	assert.EqualError(t, runSecretsCommand(c, "show", nil, false), `unknown secrets command "show", expected edit, set, get or rotate`)
+
+	// set creates a missing env file, encrypted and private
+	c.EnvironmentFile = "new.env"
+	assert.NoError(t, runSecretsCommand(c, "set", []string{"DEBUG=false"}, false))
+
+	info, err = os.Stat("new.env")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	content, err = readEnvironmentFile(c, "new.env")
+	assert.NoError(t, err)
+	assert.Equal(t, "DEBUG=false\n", string(content))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// arguments made only of these characters mean the same thing quoted or not, so they are left readable
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes a value so a posix shell passes it through as one literal argument, no matter what it
+// contains. values are wrapped in single quotes, which disable every expansion, and embedded single quotes are
+// closed, escaped and reopened.
+func shellQuote(value string) string {
+	if shellSafePattern.MatchString(value) {
+		return value
+	}
+
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// shellCommand builds a command line from an argument vector, quoting every argument. use it for any
+// command that includes a value from the config, a file name or anything else lord doesn't control.
+func shellCommand(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellAnd chains commands so each only runs if the previous one succeeded
+func shellAnd(cmds ...string) string {
+	return strings.Join(cmds, " && ")
+}
+
+// shellPipe connects the output of each command to the input of the next
+func shellPipe(cmds ...string) string {
+	return strings.Join(cmds, " | ")
+}
+
+// sudoShell runs a shell script as root, used when redirections or globs must run with root permissions
+func sudoShell(script string) string {
+	return shellCommand("sudo", "sh", "-c", script)
+}
+
+// writeFileCommand writes stdin to a root owned file. the content never becomes part of the command line, so
+// nothing in it can be expanded or end the input early.
+func writeFileCommand(path string) string {
+	return shellCommand("sudo", "tee", path) + " > /dev/null"
+}
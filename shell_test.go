@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":                     "''",
+		"myapp":                "myapp",
+		"/etc/myapp/myapp.env": "/etc/myapp/myapp.env",
+		"user@host:5000":       "user@host:5000",
+		"my app":               "'my app'",
+		"a;rm -rf /":           "'a;rm -rf /'",
+		"it's":                 `'it'\''s'`,
+		"$(whoami)":            "'$(whoami)'",
+		"`id`":                 "'`id`'",
+		"line\nbreak":          "'line\nbreak'",
+		"*.json":               "'*.json'",
+	}
+
+	for value, expected := range cases {
+		assert.Equal(t, expected, shellQuote(value), value)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	assert.Equal(t, "sudo docker rm -f myapp", shellCommand("sudo", "docker", "rm", "-f", "myapp"))
+	assert.Equal(t, "sudo mkdir -p '/var/my app'", shellCommand("sudo", "mkdir", "-p", "/var/my app"))
+	assert.Equal(t, "a && b", shellAnd("a", "b"))
+	assert.Equal(t, "a | b", shellPipe("a", "b"))
+	assert.Equal(t, `sudo sh -c 'cat > '\''/tmp/my file'\'''`, sudoShell("cat > "+shellQuote("/tmp/my file")))
+}
+
+func TestWriteFileCommand(t *testing.T) {
+	assert.Equal(t, "sudo tee '/etc/my app/x.yml' > /dev/null", writeFileCommand("/etc/my app/x.yml"))
+}
+
+// writeFileRoundTrip runs writeFileCommand through a real shell with content on stdin, sudo is replaced by a
+// shim that runs the command as the current user, and returns what ended up in the file
+func writeFileRoundTrip(t *testing.T, content string) string {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "sudo"), []byte("#!/bin/sh\nexec \"$@\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "my file.yml")
+	cmd := exec.Command(sh, "-c", writeFileCommand(path))
+	cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(content)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("shell failed: %v %s", err, output)
+	}
+
+	// nothing in the content may run as a command
+	_, err = os.Stat(filepath.Join(dir, "injected"))
+	assert.True(t, os.IsNotExist(err), "content was run as a command")
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(written)
+}
+
+func FuzzWriteFileCommand(f *testing.F) {
+	// a line ending a heredoc must be written like any other line
+	f.Add("key: value\nEOF\ntouch injected\n")
+	for _, seed := range shellSeedCorpus {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		assert.Equal(t, content, writeFileRoundTrip(t, content))
+	})
+}
+
+// shellRoundTrip runs the quoted arguments through a real shell and returns the arguments it received
+func shellRoundTrip(t *testing.T, args ...string) []string {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+
+	output, err := exec.Command(sh, "-c", `printf '%s\0' `+shellCommand(args...)).Output()
+	if err != nil {
+		t.Fatalf("shell failed for %q: %v", args, err)
+	}
+
+	received := strings.Split(string(output), "\x00")
+	return received[:len(received)-1]
+}
+
+var shellSeedCorpus = []string{
+	"myapp",
+	"",
+	"my app",
+	"/var/my app/data:/data",
+	"a;rm -rf /",
+	"$(rm -rf /)",
+	"`reboot`",
+	"it's",
+	`say "hi"`,
+	"'",
+	"''",
+	`\`,
+	"line\nbreak",
+	"tab\tseparated",
+	"$HOME ${PATH} $$",
+	"*.json ?[a-z]",
+	"a && b || c | d > e < f &",
+	"~root",
+	"#comment",
+	"ünïcödé 🚀",
+	"-rf",
+}
+
+func FuzzShellQuote(f *testing.F) {
+	for _, seed := range shellSeedCorpus {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		// arguments can't contain nul bytes, the shell would cut them off
+		if strings.ContainsRune(value, 0) {
+			t.Skip()
+		}
+
+		assert.Equal(t, []string{value}, shellRoundTrip(t, value))
+	})
+}
+
+func FuzzShellCommand(f *testing.F) {
+	for _, seed := range shellSeedCorpus {
+		f.Add("myapp", seed, "/etc/"+seed+"/"+seed+".env")
+	}
+
+	f.Fuzz(func(t *testing.T, name string, path string, label string) {
+		args := []string{name, path, label}
+		for _, arg := range args {
+			if strings.ContainsRune(arg, 0) {
+				t.Skip()
+			}
+		}
+
+		assert.Equal(t, args, shellRoundTrip(t, args...))
+	})
+}
@@ -85,15 +85,46 @@ func withSSHClient(address string, config *Config, f func(*ssh.Client) error) er
 	return f(client)
 }
 
+// verboseOutput prints silent commands and queries as well (--verbose), their output stays hidden
+var verboseOutput bool
+
+// sshCommandOptions controls how a remote command is run
+type sshCommandOptions struct {
+	// print the command and its output
+	verbose bool
+
+	// data written to the command's stdin, used to pass secrets without putting them in the command line
+	input []byte
+
+	// read-only probe that still runs in plan mode
+	query bool
+}
+
 func runSSHCommand(client *ssh.Client, cmd string, appName string) (string, string, error) {
-	return runSSHCommandWithOutput(client, cmd, appName, true)
+	return runSSHCommandWithOptions(client, cmd, appName, sshCommandOptions{verbose: true})
 }
 
 func runSSHCommandSilent(client *ssh.Client, cmd string, appName string) (string, string, error) {
-	return runSSHCommandWithOutput(client, cmd, appName, false)
+	return runSSHCommandWithOptions(client, cmd, appName, sshCommandOptions{})
 }
 
-func runSSHCommandWithOutput(client *ssh.Client, cmd string, appName string, verbose bool) (string, string, error) {
+// runSSHCommandWithInput runs a command with input on its stdin, keeping secrets out of the process list
+func runSSHCommandWithInput(client *ssh.Client, cmd string, input []byte, appName string) (string, string, error) {
+	return runSSHCommandWithOptions(client, cmd, appName, sshCommandOptions{verbose: true, input: input})
+}
+
+// runSSHQuery runs a read-only command silently. queries are the only remote commands that run in plan mode, so
+// use it for every check that decides what lord does next and never for anything that changes the host.
+func runSSHQuery(client *ssh.Client, cmd string, appName string) (string, string, error) {
+	return runSSHCommandWithOptions(client, cmd, appName, sshCommandOptions{query: true})
+}
+
+func runSSHCommandWithOptions(client *ssh.Client, cmd string, appName string, options sshCommandOptions) (string, string, error) {
+	if planning() && !options.query {
+		planRemoteCommand(cmd, options.input)
+		return "", "", nil
+	}
+
 	session, err := client.NewSession()
 	if err != nil {
 		panic(err)
@@ -103,35 +134,96 @@ func runSSHCommandWithOutput(client *ssh.Client, cmd string, appName string, ver
 	// source app-specific environment variables if they exist
 	var fullCmd string
 	if appName != "" {
-		fullCmd = fmt.Sprintf("test -f /etc/lord/%s && source /etc/lord/%s; %s", appName, appName, cmd)
+		fullCmd = fmt.Sprintf("%s; %s", hostEnvironmentSourceCommand(appName), cmd)
 	} else {
 		fullCmd = cmd
 	}
 
-	if verbose {
-		fmt.Printf("> %s\n", cmd)
+	if options.verbose || verboseOutput {
+		fmt.Printf("> %s\n", redactSecrets(cmd))
 	}
 
 	var stdoutBuf, stderrBuf bytes.Buffer
 	session.Stdout = &stdoutBuf
 	session.Stderr = &stderrBuf
 
+	if options.input != nil {
+		session.Stdin = bytes.NewReader(options.input)
+	}
+
 	err = session.Run(fullCmd)
 	if err != nil {
-		if verbose {
-			fmt.Println(stderrBuf.String())
+		if options.verbose {
+			fmt.Println(redactSecrets(stderrBuf.String()))
 		}
 		return stdoutBuf.String(), stderrBuf.String(), fmt.Errorf("command execution failed: %v", err)
 	}
 
-	if verbose {
-		fmt.Println(stdoutBuf.String())
+	if options.verbose {
+		fmt.Println(redactSecrets(stdoutBuf.String()))
 	}
 
 	return stdoutBuf.String(), stderrBuf.String(), nil
 }
 
+// runSSHCommandStreaming runs a command with its output streamed to the local terminal as it is produced
+func runSSHCommandStreaming(client *ssh.Client, cmd string, appName string) error {
+	if planning() {
+		planRemoteCommand(cmd, nil)
+		return nil
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	fullCmd := cmd
+	if appName != "" {
+		fullCmd = fmt.Sprintf("%s; %s", hostEnvironmentSourceCommand(appName), cmd)
+	}
+
+	fmt.Printf("> %s\n", redactSecrets(cmd))
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	err = session.Run(fullCmd)
+	if err != nil {
+		return fmt.Errorf("command execution failed: %v", err)
+	}
+
+	return nil
+}
+
+// writeRemoteFile writes content to a root owned file on the host, passing it on stdin of writeFileCommand
+func writeRemoteFile(client *ssh.Client, path string, content string) error {
+	if planning() {
+		planUpload("", path, int64(len(content)))
+		return nil
+	}
+
+	_, stderr, err := runSSHCommandWithInput(client, writeFileCommand(path), []byte(content), "")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v %s", path, err, stderr)
+	}
+	return nil
+}
+
 func sftpCopyFileToRemote(client *ssh.Client, srcFilePath string, dstFilePath string) error {
+	if planning() {
+		// the file may not exist yet when it would be created by an earlier planned step
+		size := int64(-1)
+		info, err := os.Stat(srcFilePath)
+		if err == nil {
+			size = info.Size()
+		}
+
+		planUpload(srcFilePath, dstFilePath, size)
+		return nil
+	}
+
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
 		return err
@@ -245,7 +245,7 @@ func getNetworkStats(client *ssh.Client) (*NetworkStats, error) {
 	}
 
 	// get network stats with two samples
-	stats1Out, _, err := runSSHCommand(client, fmt.Sprintf("cat /proc/net/dev | grep %s | awk '{print $2 \" \" $10}'", iface), "")
+	stats1Out, _, err := runSSHCommand(client, shellPipe("cat /proc/net/dev", shellCommand("grep", "-F", iface), "awk '{print $2 \" \" $10}'"), "")
 	if err != nil {
 		return nil, err
 	}
@@ -253,7 +253,7 @@ func getNetworkStats(client *ssh.Client) (*NetworkStats, error) {
 	// wait 1 second for second sample
 	time.Sleep(1 * time.Second)
 
-	stats2Out, _, err := runSSHCommand(client, fmt.Sprintf("cat /proc/net/dev | grep %s | awk '{print $2 \" \" $10}'", iface), "")
+	stats2Out, _, err := runSSHCommand(client, shellPipe("cat /proc/net/dev", shellCommand("grep", "-F", iface), "awk '{print $2 \" \" $10}'"), "")
 	if err != nil {
 		return nil, err
 	}
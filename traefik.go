@@ -3,52 +3,78 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 )
 
+// every level of the traefik config keeps the keys lord doesn't model in Extra, so settings added to
+// traefik.yml by hand (log level, extra entrypoints or providers, ...) survive reconciliation
 type TraefikConfig struct {
 	EntryPoints           map[string]EntryPoint          `yaml:"entryPoints"`
 	CertificatesResolvers map[string]CertificateResolver `yaml:"certificatesResolvers"`
 	Providers             Providers                      `yaml:"providers"`
+	API                   *TraefikAPI                    `yaml:"api,omitempty"`
+	AccessLog             *AccessLog                     `yaml:"accessLog,omitempty"`
+	Extra                 map[string]interface{}         `yaml:",inline"`
+}
+
+type TraefikAPI struct {
+	Dashboard bool                   `yaml:"dashboard"`
+	Insecure  bool                   `yaml:"insecure"`
+	Extra     map[string]interface{} `yaml:",inline"`
+}
+
+type AccessLog struct {
+	FilePath string                 `yaml:"filePath"`
+	Format   string                 `yaml:"format"`
+	Extra    map[string]interface{} `yaml:",inline"`
 }
 
 type EntryPoint struct {
-	Address   string               `yaml:"address"`
-	Transport *EntryPointTransport `yaml:"transport,omitempty"`
+	Address   string                 `yaml:"address"`
+	Transport *EntryPointTransport   `yaml:"transport,omitempty"`
+	Extra     map[string]interface{} `yaml:",inline"`
 }
 
 type EntryPointTransport struct {
-	RespondingTimeouts *RespondingTimeouts `yaml:"respondingTimeouts,omitempty"`
+	RespondingTimeouts *RespondingTimeouts    `yaml:"respondingTimeouts,omitempty"`
+	Extra              map[string]interface{} `yaml:",inline"`
 }
 
 type RespondingTimeouts struct {
-	ReadTimeout  string `yaml:"readTimeout,omitempty"`
-	WriteTimeout string `yaml:"writeTimeout,omitempty"`
-	IdleTimeout  string `yaml:"idleTimeout,omitempty"`
+	ReadTimeout  string                 `yaml:"readTimeout,omitempty"`
+	WriteTimeout string                 `yaml:"writeTimeout,omitempty"`
+	IdleTimeout  string                 `yaml:"idleTimeout,omitempty"`
+	Extra        map[string]interface{} `yaml:",inline"`
 }
 
 type CertificateResolver struct {
-	ACME ACMEConfig `yaml:"acme"`
+	ACME  ACMEConfig             `yaml:"acme"`
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type ACMEConfig struct {
-	Email         string        `yaml:"email"`
-	Storage       string        `yaml:"storage"`
-	HTTPChallenge HTTPChallenge `yaml:"httpChallenge"`
+	Email         string                 `yaml:"email"`
+	Storage       string                 `yaml:"storage"`
+	HTTPChallenge HTTPChallenge          `yaml:"httpChallenge"`
+	Extra         map[string]interface{} `yaml:",inline"`
 }
 
 type HTTPChallenge struct {
-	EntryPoint string `yaml:"entryPoint"`
+	EntryPoint string                 `yaml:"entryPoint"`
+	Extra      map[string]interface{} `yaml:",inline"`
 }
 
 type Providers struct {
-	Docker DockerProvider `yaml:"docker"`
+	Docker DockerProvider         `yaml:"docker"`
+	Extra  map[string]interface{} `yaml:",inline"`
 }
 
 type DockerProvider struct {
-	ExposedByDefault bool `yaml:"exposedByDefault"`
+	ExposedByDefault bool                   `yaml:"exposedByDefault"`
+	Extra            map[string]interface{} `yaml:",inline"`
 }
 
 func (tc *TraefikConfig) serialize() (string, error) {
@@ -61,6 +87,11 @@ func (tc *TraefikConfig) serialize() (string, error) {
 }
 
 func createTraefikConfig(email string, webAdvancedConfig WebAdvancedConfig) (string, error) {
+	config := buildTraefikConfig(email, webAdvancedConfig)
+	return config.serialize()
+}
+
+func buildTraefikConfig(email string, webAdvancedConfig WebAdvancedConfig) *TraefikConfig {
 	config := TraefikConfig{
 		EntryPoints: map[string]EntryPoint{
 			"web": {
@@ -109,7 +140,27 @@ func createTraefikConfig(email string, webAdvancedConfig WebAdvancedConfig) (str
 		config.EntryPoints["websecure"] = websecure
 	}
 
-	return config.serialize()
+	return &config
+}
+
+// applyProxyFeatures enables the optional dashboard and access log on a traefik config. the dashboard
+// is served insecurely on the internal traefik entrypoint, which is only published on the host's localhost.
+func applyProxyFeatures(config *TraefikConfig, proxy ProxyConfig) {
+	config.API = nil
+	if proxy.Dashboard {
+		config.API = &TraefikAPI{
+			Dashboard: true,
+			Insecure:  true,
+		}
+	}
+
+	config.AccessLog = nil
+	if proxy.AccessLog {
+		config.AccessLog = &AccessLog{
+			FilePath: traefikAccessLogPath,
+			Format:   "json",
+		}
+	}
 }
 
 func readTraefikConfig(yamlString string) (*TraefikConfig, error) {
@@ -121,85 +172,198 @@ func readTraefikConfig(yamlString string) (*TraefikConfig, error) {
 	return &config, nil
 }
 
-func maybeUpdateTraefikAdvancedWebConfig(config *TraefikConfig, webAdvancedConfig WebAdvancedConfig) bool {
-	updated := false
+// normalize drops empty transport blocks so configs can be compared after serialization
+func (tc *TraefikConfig) normalize() {
+	for name, entryPoint := range tc.EntryPoints {
+		if entryPoint.Transport == nil {
+			continue
+		}
 
-	// ensure websecure entrypoint exists
-	websecure, exists := config.EntryPoints["websecure"]
-	if !exists {
-		return false
+		timeouts := entryPoint.Transport.RespondingTimeouts
+		if timeouts != nil && timeouts.ReadTimeout == "" && timeouts.WriteTimeout == "" && timeouts.IdleTimeout == "" && len(timeouts.Extra) == 0 {
+			entryPoint.Transport.RespondingTimeouts = nil
+		}
+
+		if entryPoint.Transport.RespondingTimeouts == nil && len(entryPoint.Transport.Extra) == 0 {
+			entryPoint.Transport = nil
+		}
+
+		tc.EntryPoints[name] = entryPoint
+	}
+}
+
+// resolverEmail picks the acme email for the host. proxy.email always wins, otherwise the existing resolver's
+// email is kept so apps with different emails don't restart traefik on every deploy. new hosts use the app's email.
+func resolverEmail(current *TraefikConfig, proxyEmail string, email string) string {
+	if proxyEmail != "" {
+		return proxyEmail
 	}
 
-	// ensure transport exists
-	if websecure.Transport == nil {
-		websecure.Transport = &EntryPointTransport{}
+	if resolver, exists := current.CertificatesResolvers["theresolver"]; exists && resolver.ACME.Email != "" {
+		return resolver.ACME.Email
 	}
 
-	// ensure responding timeouts exists
-	if websecure.Transport.RespondingTimeouts == nil {
-		websecure.Transport.RespondingTimeouts = &RespondingTimeouts{}
+	return email
+}
+
+// copy returns a deep copy of the config, so a reconciled config can be compared against the one it came from
+func (tc *TraefikConfig) copy() (*TraefikConfig, error) {
+	raw, err := tc.serialize()
+	if err != nil {
+		return nil, err
+	}
+	return readTraefikConfig(raw)
+}
+
+// reconcileTraefikConfig merges the settings lord manages onto the current traefik config of the host. the acme
+// email comes from resolverEmail while the global timeouts and proxy features are the effective values of every
+// app on the host. every key lord doesn't manage is kept as it is, the api and accessLog sections are owned by
+// lord and follow proxy.dashboard and proxy.accesslog.
+func reconcileTraefikConfig(current *TraefikConfig, email string, effective EffectiveProxySettings) (*TraefikConfig, error) {
+	managed := buildTraefikConfig(email, WebAdvancedConfig{
+		ReadTimeout:  effective.ReadTimeout.Value,
+		WriteTimeout: effective.WriteTimeout.Value,
+		IdleTimeout:  effective.IdleTimeout.Value,
+	})
+
+	applyProxyFeatures(managed, ProxyConfig{
+		Dashboard: effective.Dashboard.Enabled,
+		AccessLog: effective.AccessLog.Enabled,
+	})
+
+	desired, err := current.copy()
+	if err != nil {
+		return nil, err
 	}
 
-	timeouts := websecure.Transport.RespondingTimeouts
+	if desired.EntryPoints == nil {
+		desired.EntryPoints = map[string]EntryPoint{}
+	}
+	for name, entryPoint := range managed.EntryPoints {
+		merged := desired.EntryPoints[name]
+		merged.Address = entryPoint.Address
 
-	// helper function to parse timeout strings like "60s" to int
-	parseTimeout := func(s string) int {
-		if s == "" {
-			return -1
+		var timeouts *RespondingTimeouts
+		if entryPoint.Transport != nil {
+			timeouts = entryPoint.Transport.RespondingTimeouts
+		}
+		if merged.Transport != nil && merged.Transport.RespondingTimeouts != nil {
+			if timeouts == nil {
+				timeouts = &RespondingTimeouts{}
+			}
+			timeouts.Extra = merged.Transport.RespondingTimeouts.Extra
 		}
-		if s == "0s" || s == "0" {
-			return 0
+		if merged.Transport == nil && timeouts != nil {
+			merged.Transport = &EntryPointTransport{}
 		}
-		var val int
-		fmt.Sscanf(s, "%ds", &val)
-		return val
+		if merged.Transport != nil {
+			merged.Transport.RespondingTimeouts = timeouts
+		}
+
+		desired.EntryPoints[name] = merged
 	}
 
-	// helper function to compare and update timeout (0 = unlimited, higher values win)
-	updateIfGreater := func(current string, newValue int) (string, bool) {
-		if newValue == -1 {
-			// not set in new config, keep current
-			return current, false
-		}
+	if desired.CertificatesResolvers == nil {
+		desired.CertificatesResolvers = map[string]CertificateResolver{}
+	}
+	for name, resolver := range managed.CertificatesResolvers {
+		merged := desired.CertificatesResolvers[name]
+		merged.ACME.Email = resolver.ACME.Email
+		merged.ACME.Storage = resolver.ACME.Storage
+		merged.ACME.HTTPChallenge.EntryPoint = resolver.ACME.HTTPChallenge.EntryPoint
+		desired.CertificatesResolvers[name] = merged
+	}
 
-		currentVal := parseTimeout(current)
+	desired.Providers.Docker.ExposedByDefault = managed.Providers.Docker.ExposedByDefault
 
-		// if current is 0 (unlimited), keep it
-		if currentVal == 0 {
-			return current, false
-		}
+	desired.API = managed.API
+	desired.AccessLog = managed.AccessLog
 
-		// if new value is 0 (unlimited) or greater than current, update
-		if newValue == 0 || (currentVal != -1 && newValue > currentVal) || currentVal == -1 {
-			return fmt.Sprintf("%ds", newValue), true
-		}
+	desired.normalize()
+
+	return desired, nil
+}
+
+// diffTraefikConfigs returns a unified diff of the serialized configs, empty if they are equivalent
+func diffTraefikConfigs(current *TraefikConfig, desired *TraefikConfig) ([]string, error) {
+	current.normalize()
+	desired.normalize()
+
+	currentRaw, err := current.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	desiredRaw, err := desired.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	if currentRaw == desiredRaw {
+		return []string{}, nil
+	}
+
+	return generateUnifiedDiff(strings.Split(currentRaw, "\n"), strings.Split(desiredRaw, "\n")), nil
+}
+
+func traefikImage(version string) string {
+	if version == "" {
+		version = defaultTraefikVersion
+	}
+	return fmt.Sprintf("traefik:%s", version)
+}
+
+// desiredTraefikImage is the pinned version if one is configured, otherwise whatever the host already runs so
+// an unpinned config never asks to switch versions. new hosts get the default version.
+func (r *remote) desiredTraefikImage(runningImage string) string {
+	if r.config.Proxy.Version == "" && runningImage != "" {
+		return runningImage
+	}
+	return traefikImage(r.config.Proxy.Version)
+}
 
-		return current, false
+// upgradeTraefikImage is the image lord proxy --upgrade moves to. it never follows the running image, which is
+// latest on older hosts, so an unpinned config upgrades to the default version instead of a surprise release.
+func upgradeTraefikImage(version string) (string, error) {
+	if version == "latest" {
+		return "", fmt.Errorf("proxy.version must pin a traefik version to upgrade to, not latest")
 	}
+	return traefikImage(version), nil
+}
 
-	// update read timeout
-	if newVal, changed := updateIfGreater(timeouts.ReadTimeout, webAdvancedConfig.ReadTimeout); changed {
-		timeouts.ReadTimeout = newVal
-		updated = true
+// the dashboard port is only published on localhost and only when the dashboard is enabled
+func traefikRunCommand(containerName string, image string, dashboard bool) string {
+	args := []string{
+		"sudo", "docker", "run", "-d", "--restart", "unless-stopped", "--name", containerName,
+		"-v", "/var/run/docker.sock:/var/run/docker.sock",
+		"-v", "/etc/traefik/traefik.yml:/etc/traefik/traefik.yml",
+		"-v", "/etc/traefik/acme.json:/acme.json",
+		"-v", "/var/log/traefik:/var/log/traefik",
+		"-p", "80:80", "-p", "443:443",
 	}
 
-	// update write timeout
-	if newVal, changed := updateIfGreater(timeouts.WriteTimeout, webAdvancedConfig.WriteTimeout); changed {
-		timeouts.WriteTimeout = newVal
-		updated = true
+	if dashboard {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:8080", traefikDashboardPort))
 	}
 
-	// update idle timeout
-	if newVal, changed := updateIfGreater(timeouts.IdleTimeout, webAdvancedConfig.IdleTimeout); changed {
-		timeouts.IdleTimeout = newVal
-		updated = true
+	return shellCommand(append(args, "--network", "traefik", image)...)
+}
+
+// ensureTraefikLogRotation installs a logrotate drop-in for the access log unless the host already has one
+func ensureTraefikLogRotation(client *ssh.Client) error {
+	_, _, err := runSSHQuery(client, shellCommand("test", "-d", "/etc/logrotate.d"), "")
+	if err != nil {
+		fmt.Println("warning: /etc/logrotate.d not found on server, the traefik access log is not rotated")
+		return nil
 	}
 
-	// write back the updated values
-	websecure.Transport.RespondingTimeouts = timeouts
-	config.EntryPoints["websecure"] = websecure
+	_, _, err = runSSHQuery(client, shellCommand("test", "-f", traefikLogrotatePath), "")
+	if err == nil {
+		return nil
+	}
 
-	return updated
+	fmt.Println("installing traefik access log rotation")
+	return writeRemoteFile(client, traefikLogrotatePath, traefikLogrotateConfig)
 }
 
 func (r *remote) traefikNeedsAdvancedConfig() bool {
@@ -208,63 +372,146 @@ func (r *remote) traefikNeedsAdvancedConfig() bool {
 		(r.config.WebAdvancedConfig.IdleTimeout != -1)
 }
 
-func (r *remote) ensureTraefikSetup(email string) error {
-	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
-		stdOut, _, err := runSSHCommand(client, "sudo docker ps --filter name=traefik --format \"{{.Names}}\"", "")
+func getRunningTraefikImage(client *ssh.Client) (string, error) {
+	stdOut, _, err := runSSHQuery(client, "sudo docker inspect --format '{{.Config.Image}}' traefik", "")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdOut), nil
+}
+
+// ensureTraefikConfigReconciled records this app's global proxy settings (or releases them when the app is
+// being destroyed), recomputes the effective settings for every app on the host and applies any changes
+func (r *remote) ensureTraefikConfigReconciled(client *ssh.Client, email string, release bool) error {
+	currentTraefikConfigRaw, _, err := runSSHQuery(client, "sudo cat /etc/traefik/traefik.yml", "")
+	if err != nil {
+		return fmt.Errorf("error reading traefik config: %s", err)
+	}
+
+	currentTraefikConfig, err := readTraefikConfig(currentTraefikConfigRaw)
+	if err != nil {
+		return fmt.Errorf("error parsing traefik config for reconciliation: %s", err)
+	}
+
+	effective, err := r.updateProxySettings(client, currentTraefikConfig, release)
+	if err != nil {
+		return fmt.Errorf("error computing global proxy settings: %s", err)
+	}
+
+	email = resolverEmail(currentTraefikConfig, r.config.Proxy.Email, email)
+	if release {
+		// a destroyed app doesn't get to change the email of the apps left on the host
+		email = resolverEmail(currentTraefikConfig, "", defaultEmail)
+	}
+
+	desiredTraefikConfig, err := reconcileTraefikConfig(currentTraefikConfig, email, effective)
+	if err != nil {
+		return fmt.Errorf("error reconciling traefik config: %s", err)
+	}
+
+	diff, err := diffTraefikConfigs(currentTraefikConfig, desiredTraefikConfig)
+	if err != nil {
+		return fmt.Errorf("error comparing traefik configs: %s", err)
+	}
+
+	if effective.Dashboard.Enabled || effective.AccessLog.Enabled {
+		setup, _, err := runSSHQuery(client, "sudo docker inspect --format '{{range .Mounts}}{{.Destination}} {{end}}{{range $port, $bindings := .HostConfig.PortBindings}}{{$port}} {{end}}' traefik", "")
+		if err == nil && !strings.Contains(setup, "/var/log/traefik") {
+			fmt.Println("warning: the running traefik container predates dashboard/access log support, run lord proxy --upgrade to recreate it")
+		} else if err == nil && effective.Dashboard.Enabled && !strings.Contains(setup, "8080/tcp") {
+			fmt.Println("warning: the running traefik container doesn't publish the dashboard port, run lord proxy --upgrade to recreate it")
+		}
+	}
+
+	if effective.AccessLog.Enabled {
+		err = ensureTraefikLogRotation(client)
 		if err != nil {
-			return err
+			return fmt.Errorf("error setting up traefik log rotation: %v", err)
 		}
+	}
 
-		if strings.Contains(stdOut, "traefik") {
-			fmt.Println("traefik already running...")
+	if len(diff) == 0 {
+		fmt.Println("traefik configuration is up to date")
+		return nil
+	}
 
-			if r.traefikNeedsAdvancedConfig() {
-				currentTraefikConfigRaw, _, err := runSSHCommand(client, "sudo cat /etc/traefik/traefik.yml", "")
-				if err != nil {
-					return fmt.Errorf("error reading traefik config: %s", err)
-				}
+	fmt.Println("updating traefik configuration:")
+	for _, line := range diff {
+		fmt.Println(line)
+	}
 
-				traefikConfig, err := readTraefikConfig(currentTraefikConfigRaw)
-				if err != nil {
-					return fmt.Errorf("error parsing traefik config to check for advanced config: %s", err)
-				}
+	if planning() {
+		planTraefikChange("/etc/traefik/traefik.yml", diff)
+	}
 
-				updated := maybeUpdateTraefikAdvancedWebConfig(traefikConfig, r.config.WebAdvancedConfig)
-				if updated {
-					fmt.Println("updating traefik timeout configuration")
+	newTraefikConfig, err := desiredTraefikConfig.serialize()
+	if err != nil {
+		return fmt.Errorf("error serializing new traefik config: %s", err)
+	}
 
-					newTraefikConfig, err := traefikConfig.serialize()
-					if err != nil {
-						return fmt.Errorf("error serializing new traefik config: %s", err)
-					}
+	_, _, err = runSSHCommand(client, "sudo cp /etc/traefik/traefik.yml /etc/traefik/traefik.yml.bak", "")
+	if err != nil {
+		return err
+	}
 
-					cmds := []string{
-						fmt.Sprintf("sudo cat > /etc/traefik/traefik.yml <<EOF\n%v\nEOF", newTraefikConfig),
-						"sudo docker restart traefik",
-					}
+	err = writeRemoteFile(client, "/etc/traefik/traefik.yml", newTraefikConfig)
+	if err != nil {
+		return err
+	}
 
-					for _, cmd := range cmds {
-						_, _, err := runSSHCommand(client, cmd, "")
-						if err != nil {
-							return err
-						}
-					}
+	_, _, err = runSSHCommand(client, "sudo docker restart traefik", "")
+	if err != nil {
+		return err
+	}
 
-					fmt.Println("traefik configuration updated and restarted")
-				}
+	fmt.Println("traefik configuration updated and restarted")
+
+	return nil
+}
+
+func (r *remote) ensureTraefikSetup(email string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		stdOut, _, err := runSSHQuery(client, "sudo docker ps --filter name=traefik --format \"{{.Names}}\"", "")
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(stdOut, "traefik") {
+			fmt.Println("traefik already running...")
+
+			runningImage, err := getRunningTraefikImage(client)
+			if err == nil && runningImage != r.desiredTraefikImage(runningImage) {
+				fmt.Printf("warning: traefik is running %s but %s is pinned, run lord proxy --upgrade to switch versions\n", runningImage, r.desiredTraefikImage(runningImage))
 			}
 
-			return nil
+			return r.ensureTraefikConfigReconciled(client, email, false)
+		}
+
+		effective, err := r.updateProxySettings(client, &TraefikConfig{}, false)
+		if err != nil {
+			return fmt.Errorf("error computing global proxy settings: %s", err)
 		}
 
-		traefikConfig, err := createTraefikConfig(email, r.config.WebAdvancedConfig)
+		desiredTraefikConfig, err := reconcileTraefikConfig(&TraefikConfig{}, resolverEmail(&TraefikConfig{}, r.config.Proxy.Email, email), effective)
+		if err != nil {
+			return fmt.Errorf("error creating traefik config: %s", err)
+		}
+		traefikConfig, err := desiredTraefikConfig.serialize()
 		if err != nil {
 			return fmt.Errorf("error creating traefik config: %s", err)
 		}
 
+		if planning() {
+			diff, err := diffTraefikConfigs(&TraefikConfig{}, desiredTraefikConfig)
+			if err != nil {
+				return fmt.Errorf("error comparing traefik configs: %s", err)
+			}
+			planTraefikChange("/etc/traefik/traefik.yml", diff)
+		}
+
 		fmt.Println("checking for traefik docker network")
 
-		stdOut, _, err = runSSHCommand(client, "sudo docker network ls --format '{{.Name}}'", "")
+		stdOut, _, err = runSSHQuery(client, "sudo docker network ls --format '{{.Name}}'", "")
 		if err != nil {
 			return err
 		}
@@ -278,13 +525,21 @@ func (r *remote) ensureTraefikSetup(email string) error {
 
 		fmt.Println("setting up traefik on server")
 
+		_, _, err = runSSHCommand(client, shellAnd("sudo mkdir -p /etc/traefik", "sudo mkdir -p /var/log/traefik"), "")
+		if err != nil {
+			return err
+		}
+
+		err = writeRemoteFile(client, "/etc/traefik/traefik.yml", traefikConfig)
+		if err != nil {
+			return err
+		}
+
 		cmds := []string{
-			"sudo mkdir -p /etc/traefik",
-			fmt.Sprintf("sudo cat > /etc/traefik/traefik.yml <<EOF\n %v \nEOF", traefikConfig),
 			"sudo touch /etc/traefik/acme.json",
 			"sudo chmod 600 /etc/traefik/acme.json",
 			"sudo docker rm --force traefik",
-			"sudo docker run -d --restart unless-stopped --name traefik -v /var/run/docker.sock:/var/run/docker.sock -v /etc/traefik/traefik.yml:/etc/traefik/traefik.yml -v /etc/traefik/acme.json:/acme.json -p 80:80 -p 443:443 --network traefik traefik:latest",
+			traefikRunCommand("traefik", r.desiredTraefikImage(""), effective.Dashboard.Enabled),
 		}
 
 		for _, cmd := range cmds {
@@ -294,6 +549,174 @@ func (r *remote) ensureTraefikSetup(email string) error {
 			}
 		}
 
+		if effective.AccessLog.Enabled {
+			err = ensureTraefikLogRotation(client)
+			if err != nil {
+				return fmt.Errorf("error setting up traefik log rotation: %v", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// waitForContainerRunning gives a freshly started container a few seconds to crash on bad config
+func waitForContainerRunning(client *ssh.Client, name string) error {
+	// nothing was started in plan mode
+	if planning() {
+		return nil
+	}
+
+	time.Sleep(5 * time.Second)
+
+	stdOut, _, err := runSSHQuery(client, shellCommand("sudo", "docker", "inspect", "--format", "{{.State.Running}}", name), "")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(stdOut) != "true" {
+		logs, _, _ := runSSHQuery(client, shellCommand("sudo", "docker", "logs", "--tail", "20", name)+" 2>&1", "")
+		return fmt.Errorf("container %s exited after start:\n%s", name, logs)
+	}
+
+	return nil
+}
+
+// releaseTraefikSettings removes this app's global proxy settings after it has been destroyed so the
+// effective settings can go back down. the host's resolver email is left as it is.
+func (r *remote) releaseTraefikSettings() error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		stdOut, _, err := runSSHQuery(client, "sudo docker ps --filter name=traefik --format \"{{.Names}}\"", "")
+		if err != nil {
+			return err
+		}
+
+		if !strings.Contains(stdOut, "traefik") {
+			return nil
+		}
+
+		return r.ensureTraefikConfigReconciled(client, defaultEmail, true)
+	})
+}
+
+// upgradeTraefik pulls the pinned traefik version, validates the reconciled config against it in a
+// throwaway container and then swaps the running proxy, rolling back to the previous image on failure
+func (r *remote) upgradeTraefik(email string) error {
+	return withSSHClient(r.address, r.config, func(client *ssh.Client) error {
+		previousImage, err := getRunningTraefikImage(client)
+		if err != nil {
+			return fmt.Errorf("traefik is not running on this server, run lord proxy to set it up: %v", err)
+		}
+
+		newImage, err := upgradeTraefikImage(r.config.Proxy.Version)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("upgrading traefik from %s to %s\n", previousImage, newImage)
+
+		_, _, err = runSSHCommand(client, shellCommand("sudo", "docker", "pull", newImage), "")
+		if err != nil {
+			return fmt.Errorf("failed to pull %s: %v", newImage, err)
+		}
+
+		currentTraefikConfigRaw, _, err := runSSHQuery(client, "sudo cat /etc/traefik/traefik.yml", "")
+		if err != nil {
+			return fmt.Errorf("error reading traefik config: %s", err)
+		}
+
+		currentTraefikConfig, err := readTraefikConfig(currentTraefikConfigRaw)
+		if err != nil {
+			return fmt.Errorf("error parsing traefik config: %s", err)
+		}
+
+		effective, err := r.updateProxySettings(client, currentTraefikConfig, false)
+		if err != nil {
+			return fmt.Errorf("error computing global proxy settings: %s", err)
+		}
+
+		desiredTraefikConfig, err := reconcileTraefikConfig(currentTraefikConfig, resolverEmail(currentTraefikConfig, r.config.Proxy.Email, email), effective)
+		if err != nil {
+			return fmt.Errorf("error reconciling traefik config: %s", err)
+		}
+
+		newTraefikConfig, err := desiredTraefikConfig.serialize()
+		if err != nil {
+			return fmt.Errorf("error serializing new traefik config: %s", err)
+		}
+
+		fmt.Println("validating traefik config against new version")
+
+		err = writeRemoteFile(client, "/etc/traefik/traefik.yml.next", newTraefikConfig)
+		if err != nil {
+			return err
+		}
+
+		// the validation container gets no docker socket or ports so it cannot route traffic or request certificates
+		validateCmds := []string{
+			"sudo docker rm --force traefik-validate",
+			shellCommand("sudo", "docker", "run", "-d", "--name", "traefik-validate", "-v", "/etc/traefik/traefik.yml.next:/etc/traefik/traefik.yml", newImage),
+		}
+
+		for _, cmd := range validateCmds {
+			_, _, err := runSSHCommand(client, cmd, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		validateErr := waitForContainerRunning(client, "traefik-validate")
+		_, _, _ = runSSHCommand(client, "sudo docker rm --force traefik-validate", "")
+		if validateErr != nil {
+			return fmt.Errorf("new traefik version rejected the config, running proxy left untouched: %v", validateErr)
+		}
+
+		fmt.Println("swapping traefik container")
+
+		swapCmds := []string{
+			"sudo mkdir -p /var/log/traefik",
+			"sudo cp /etc/traefik/traefik.yml /etc/traefik/traefik.yml.bak",
+			"sudo mv /etc/traefik/traefik.yml.next /etc/traefik/traefik.yml",
+			"sudo docker rm --force traefik",
+			traefikRunCommand("traefik", newImage, effective.Dashboard.Enabled),
+		}
+
+		for _, cmd := range swapCmds {
+			_, _, err := runSSHCommand(client, cmd, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		err = waitForContainerRunning(client, "traefik")
+		if err != nil {
+			fmt.Printf("new traefik container failed, rolling back to %s\n", previousImage)
+
+			rollbackCmds := []string{
+				"sudo cp /etc/traefik/traefik.yml.bak /etc/traefik/traefik.yml",
+				"sudo docker rm --force traefik",
+				traefikRunCommand("traefik", previousImage, effective.Dashboard.Enabled),
+			}
+
+			for _, cmd := range rollbackCmds {
+				_, _, rollbackErr := runSSHCommand(client, cmd, "")
+				if rollbackErr != nil {
+					return fmt.Errorf("rollback failed: %v (upgrade error: %v)", rollbackErr, err)
+				}
+			}
+
+			return fmt.Errorf("upgrade failed and was rolled back: %v", err)
+		}
+
+		if effective.AccessLog.Enabled {
+			err = ensureTraefikLogRotation(client)
+			if err != nil {
+				return fmt.Errorf("error setting up traefik log rotation: %v", err)
+			}
+		}
+
+		fmt.Printf("traefik upgraded to %s\n", newImage)
+
 		return nil
 	})
 }
@@ -124,225 +124,6 @@ invalid: yaml: structure:
 	})
 }
 
-func TestMaybeUpdateTraefikAdvancedWebConfig(t *testing.T) {
-	t.Run("no existing timeouts, add new ones", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  60,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.True(t, updated)
-		assert.NotNil(t, config.EntryPoints["websecure"].Transport)
-		assert.NotNil(t, config.EntryPoints["websecure"].Transport.RespondingTimeouts)
-		assert.Equal(t, "60s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("existing timeouts are lower, update them", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "30s",
-							WriteTimeout: "60s",
-							IdleTimeout:  "90s",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  60,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.True(t, updated)
-		assert.Equal(t, "60s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("existing timeouts are higher, keep them", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "120s",
-							WriteTimeout: "240s",
-							IdleTimeout:  "360s",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  60,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.False(t, updated)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "240s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "360s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("existing timeout is 0 (unlimited), keep it", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "0s",
-							WriteTimeout: "60s",
-							IdleTimeout:  "180s",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  120,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.True(t, updated) // only writetimeout updates
-		assert.Equal(t, "0s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("new timeout is 0 (unlimited), update existing", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "60s",
-							WriteTimeout: "120s",
-							IdleTimeout:  "180s",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  0,
-			WriteTimeout: -1,
-			IdleTimeout:  -1,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.True(t, updated)
-		assert.Equal(t, "0s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("new config has -1 (not set), keep existing", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "60s",
-							WriteTimeout: "120s",
-							IdleTimeout:  "180s",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  -1,
-			WriteTimeout: -1,
-			IdleTimeout:  -1,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.False(t, updated)
-		assert.Equal(t, "60s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
-		assert.Equal(t, "120s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)
-	})
-
-	t.Run("mixed scenario - some update, some keep", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"websecure": {
-					Address: ":443",
-					Transport: &EntryPointTransport{
-						RespondingTimeouts: &RespondingTimeouts{
-							ReadTimeout:  "30s",
-							WriteTimeout: "240s",
-							IdleTimeout:  "",
-						},
-					},
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  60,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.True(t, updated)
-		assert.Equal(t, "60s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)   // updated from 30s to 60s
-		assert.Equal(t, "240s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.WriteTimeout) // kept at 240s (higher)
-		assert.Equal(t, "180s", config.EntryPoints["websecure"].Transport.RespondingTimeouts.IdleTimeout)  // added (was empty)
-	})
-
-	t.Run("no websecure entrypoint, return false", func(t *testing.T) {
-		config := &TraefikConfig{
-			EntryPoints: map[string]EntryPoint{
-				"web": {
-					Address: ":80",
-				},
-			},
-		}
-
-		webAdvancedConfig := WebAdvancedConfig{
-			ReadTimeout:  60,
-			WriteTimeout: 120,
-			IdleTimeout:  180,
-		}
-
-		updated := maybeUpdateTraefikAdvancedWebConfig(config, webAdvancedConfig)
-		assert.False(t, updated)
-	})
-}
-
 func TestTraefikConfigSerialize(t *testing.T) {
 	t.Run("serialize basic config", func(t *testing.T) {
 		config := TraefikConfig{
@@ -503,4 +284,184 @@ func TestTraefikNeedsAdvancedConfig(t *testing.T) {
 
 		assert.True(t, r.traefikNeedsAdvancedConfig())
 	})
-}
\ No newline at end of file
+}
+
+func TestReconcileTraefikConfig(t *testing.T) {
+	unsetTimeouts := WebAdvancedConfig{ReadTimeout: -1, WriteTimeout: -1, IdleTimeout: -1}
+	noSettings := computeEffectiveProxySettings([]ProxySettingsRecord{})
+
+	t.Run("another app's email keeps the existing email", func(t *testing.T) {
+		current := buildTraefikConfig("old@example.com", unsetTimeouts)
+
+		desired, err := reconcileTraefikConfig(current, resolverEmail(current, "", "new@example.com"), noSettings)
+		assert.NoError(t, err)
+		assert.Equal(t, "old@example.com", desired.CertificatesResolvers["theresolver"].ACME.Email)
+
+		diff, err := diffTraefikConfigs(current, desired)
+		assert.NoError(t, err)
+		assert.Empty(t, diff)
+	})
+
+	t.Run("proxy email replaces the existing email", func(t *testing.T) {
+		current := buildTraefikConfig("old@example.com", unsetTimeouts)
+
+		desired, err := reconcileTraefikConfig(current, resolverEmail(current, "new@example.com", defaultEmail), noSettings)
+		assert.NoError(t, err)
+		assert.Equal(t, "new@example.com", desired.CertificatesResolvers["theresolver"].ACME.Email)
+
+		diff, err := diffTraefikConfigs(current, desired)
+		assert.NoError(t, err)
+		assert.Contains(t, diff, "-            email: old@example.com")
+		assert.Contains(t, diff, "+            email: new@example.com")
+	})
+
+	t.Run("new host uses the app's email", func(t *testing.T) {
+		assert.Equal(t, "app@example.com", resolverEmail(&TraefikConfig{}, "", "app@example.com"))
+	})
+
+	t.Run("timeouts follow effective settings and can go back down", func(t *testing.T) {
+		current := buildTraefikConfig("test@example.com", WebAdvancedConfig{ReadTimeout: 0, WriteTimeout: 600, IdleTimeout: -1})
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{
+			{App: "app1", ReadTimeout: 60, WriteTimeout: 120, IdleTimeout: -1},
+		})
+
+		desired, err := reconcileTraefikConfig(current, "test@example.com", effective)
+		assert.NoError(t, err)
+		timeouts := desired.EntryPoints["websecure"].Transport.RespondingTimeouts
+		assert.Equal(t, "60s", timeouts.ReadTimeout)
+		assert.Equal(t, "120s", timeouts.WriteTimeout)
+		assert.Equal(t, "", timeouts.IdleTimeout)
+	})
+
+	t.Run("no timeouts removes transport block", func(t *testing.T) {
+		current := buildTraefikConfig("test@example.com", WebAdvancedConfig{ReadTimeout: 0, WriteTimeout: -1, IdleTimeout: -1})
+
+		desired, err := reconcileTraefikConfig(current, "test@example.com", noSettings)
+		assert.NoError(t, err)
+		assert.Nil(t, desired.EntryPoints["websecure"].Transport)
+	})
+
+	t.Run("keys lord doesn't manage are kept", func(t *testing.T) {
+		current, err := readTraefikConfig(`
+log:
+  level: DEBUG
+entryPoints:
+  web:
+    address: ":80"
+  websecure:
+    address: ":443"
+    http3: {}
+  metrics:
+    address: ":8082"
+certificatesResolvers:
+  theresolver:
+    acme:
+      email: test@example.com
+      storage: acme.json
+      keyType: EC384
+      httpChallenge:
+        entryPoint: web
+providers:
+  docker:
+    exposedByDefault: false
+    network: web
+  file:
+    directory: /etc/traefik/dynamic
+`)
+		assert.NoError(t, err)
+
+		desired, err := reconcileTraefikConfig(current, "test@example.com", noSettings)
+		assert.NoError(t, err)
+
+		diff, err := diffTraefikConfigs(current, desired)
+		assert.NoError(t, err)
+		assert.Empty(t, diff)
+
+		serialized, err := desired.serialize()
+		assert.NoError(t, err)
+		assert.Contains(t, serialized, "level: DEBUG")
+		assert.Contains(t, serialized, "http3: {}")
+		assert.Contains(t, serialized, "address: :8082")
+		assert.Contains(t, serialized, "keyType: EC384")
+		assert.Contains(t, serialized, "network: web")
+		assert.Contains(t, serialized, "directory: /etc/traefik/dynamic")
+	})
+
+	t.Run("managed settings change without touching unknown keys", func(t *testing.T) {
+		current, err := readTraefikConfig(`
+log:
+  level: DEBUG
+entryPoints:
+  web:
+    address: ":80"
+  websecure:
+    address: ":443"
+certificatesResolvers:
+  theresolver:
+    acme:
+      email: test@example.com
+      storage: acme.json
+      httpChallenge:
+        entryPoint: web
+providers:
+  docker:
+    exposedByDefault: false
+`)
+		assert.NoError(t, err)
+
+		effective := computeEffectiveProxySettings([]ProxySettingsRecord{
+			{App: "app1", ReadTimeout: 60, WriteTimeout: -1, IdleTimeout: -1},
+		})
+		desired, err := reconcileTraefikConfig(current, "test@example.com", effective)
+		assert.NoError(t, err)
+		assert.Equal(t, "60s", desired.EntryPoints["websecure"].Transport.RespondingTimeouts.ReadTimeout)
+
+		// the current config is left untouched
+		assert.Nil(t, current.EntryPoints["websecure"].Transport)
+
+		serialized, err := desired.serialize()
+		assert.NoError(t, err)
+		assert.Contains(t, serialized, "level: DEBUG")
+	})
+
+	t.Run("identical config has no diff", func(t *testing.T) {
+		current := buildTraefikConfig("test@example.com", unsetTimeouts)
+
+		desired, err := reconcileTraefikConfig(current, "test@example.com", noSettings)
+		assert.NoError(t, err)
+		diff, err := diffTraefikConfigs(current, desired)
+		assert.NoError(t, err)
+		assert.Empty(t, diff)
+	})
+}
+
+func TestUpgradeTraefikImage(t *testing.T) {
+	image, err := upgradeTraefikImage("")
+	assert.NoError(t, err)
+	assert.Equal(t, "traefik:"+defaultTraefikVersion, image)
+
+	image, err = upgradeTraefikImage("v3.4")
+	assert.NoError(t, err)
+	assert.Equal(t, "traefik:v3.4", image)
+
+	_, err = upgradeTraefikImage("latest")
+	assert.Error(t, err)
+}
+
+func TestTraefikImage(t *testing.T) {
+	assert.Equal(t, "traefik:v3.1", traefikImage("v3.1"))
+	assert.Equal(t, "traefik:"+defaultTraefikVersion, traefikImage(""))
+
+	// without a pinned version the running image is kept
+	r := &remote{config: &Config{}}
+	assert.Equal(t, "traefik:latest", r.desiredTraefikImage("traefik:latest"))
+	assert.Equal(t, "traefik:"+defaultTraefikVersion, r.desiredTraefikImage(""))
+
+	r.config.Proxy.Version = "v3.1"
+	assert.Equal(t, "traefik:v3.1", r.desiredTraefikImage("traefik:latest"))
+}
+
+func TestTraefikRunCommand(t *testing.T) {
+	assert.NotContains(t, traefikRunCommand("traefik", "traefik:v3.3", false), "8080")
+	assert.Contains(t, traefikRunCommand("traefik", "traefik:v3.3", true), "-p 127.0.0.1:8080:8080 --network traefik traefik:v3.3")
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigIssue is a single validation problem found in a config file
+type ConfigIssue struct {
+	// dotted lowercase key path, i.e. webadvancedconfig.readtimeout
+	Path string `json:"path,omitempty"`
+
+	// file the offending value was read from when it differs from the loaded config, i.e. an extended base
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+
+	// yaml node the issue was found at, used to look up its source file
+	node *yaml.Node
+}
+
+// ConfigIssues is every problem found in a config file, reported together
+type ConfigIssues struct {
+	File   string
+	Issues []ConfigIssue
+}
+
+func (ci *ConfigIssues) Error() string {
+	lines := []string{}
+	for _, issue := range ci.Issues {
+		file := ci.File
+		if issue.File != "" {
+			file = issue.File
+		}
+
+		if issue.Line > 0 {
+			lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", file, issue.Line, issue.Column, issue.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", file, issue.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidationReport is the result of lord validate --json
+type ValidationReport struct {
+	Valid  bool          `json:"valid"`
+	Issues []ConfigIssue `json:"issues"`
+}
+
+// validationReport turns the result of loading the config into a report. errors other than config issues,
+// i.e. a missing file or broken yaml, are reported as a single issue.
+func validationReport(err error) ValidationReport {
+	report := ValidationReport{Valid: err == nil, Issues: []ConfigIssue{}}
+
+	var configIssues *ConfigIssues
+	if errors.As(err, &configIssues) {
+		for _, issue := range configIssues.Issues {
+			if issue.File == "" {
+				issue.File = configIssues.File
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+	} else if err != nil {
+		report.Issues = append(report.Issues, ConfigIssue{Message: err.Error()})
+	}
+
+	return report
+}
+
+// docker container names, which lord uses for app names
+var appNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// optionalEnvironmentFiles skips the existence check of env files, lord secrets set creates them
+var optionalEnvironmentFiles bool
+
+var platformPattern = regexp.MustCompile(`^linux/(amd64|arm64|arm|386|ppc64le|s390x|riscv64)(/v[5-8])?$`)
+
+// configKeyPositions maps dotted key paths to the yaml key node they were set by
+type configKeyPositions struct {
+	keys    map[string]*yaml.Node
+	sources configSources
+}
+
+func (cp configKeyPositions) get(path string) (*yaml.Node, bool) {
+	node, exists := cp.keys[path]
+	return node, exists
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+func yamlKindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+
+	switch node.Tag {
+	case "!!bool":
+		return "a boolean"
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	}
+	return "a string"
+}
+
+// levenshtein is used to suggest the intended key for typos
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(cur[j-1]+1, prev[j]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func suggestKey(key string, known []string) string {
+	best := ""
+	bestDistance := 3
+	for _, candidate := range known {
+		distance := levenshtein(key, candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// validateConfigNode checks a yaml node against the config struct type, reporting unknown keys and type
+// mismatches. keys are matched case insensitively, the same way viper reads them.
+func validateConfigNode(node *yaml.Node, t reflect.Type, path string, positions configKeyPositions) []ConfigIssue {
+	node = resolveAlias(node)
+	issues := []ConfigIssue{}
+
+	// empty values fall back to the defaults
+	if node.Tag == "!!null" {
+		return issues
+	}
+
+	typeIssue := func(expected string) []ConfigIssue {
+		return []ConfigIssue{{
+			node:    node,
+			Path:    path,
+			Line:    node.Line,
+			Column:  node.Column,
+			Message: fmt.Sprintf("%s must be %s, got %s", path, expected, yamlKindName(node)),
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			if path == "" {
+				return []ConfigIssue{{node: node, Line: node.Line, Column: node.Column, Message: "config must be a mapping of keys to values"}}
+			}
+			return typeIssue("a mapping")
+		}
+
+		fields := map[string]reflect.StructField{}
+		known := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.ToLower(field.Name)
+			fields[name] = field
+			known = append(known, name)
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			valueNode := node.Content[i+1]
+			key := strings.ToLower(keyNode.Value)
+
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			field, exists := fields[key]
+			if !exists {
+				message := fmt.Sprintf("unknown key %q", keyPath)
+				suggestion := suggestKey(key, known)
+				if suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				issues = append(issues, ConfigIssue{node: keyNode, Path: keyPath, Line: keyNode.Line, Column: keyNode.Column, Message: message})
+				continue
+			}
+
+			positions.keys[keyPath] = keyNode
+			issues = append(issues, validateConfigNode(valueNode, field.Type, keyPath, positions)...)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return typeIssue("a list")
+		}
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			positions.keys[itemPath] = item
+			issues = append(issues, validateConfigNode(item, t.Elem(), itemPath, positions)...)
+		}
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			return typeIssue("true or false")
+		}
+
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			return typeIssue("an integer")
+		}
+
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			return typeIssue("a string")
+		}
+	}
+
+	return issues
+}
+
+func checkFileExists(path string, file string, wantDir bool) *ConfigIssue {
+	info, err := os.Stat(file)
+	if err != nil {
+		return &ConfigIssue{Path: path, Message: fmt.Sprintf("%s %q not found", path, file)}
+	}
+	if wantDir && !info.IsDir() {
+		return &ConfigIssue{Path: path, Message: fmt.Sprintf("%s %q must be a directory", path, file)}
+	}
+	if !wantDir && info.IsDir() {
+		return &ConfigIssue{Path: path, Message: fmt.Sprintf("%s %q must be a file, not a directory", path, file)}
+	}
+	return nil
+}
+
+// validateConfigRules checks the values of a loaded config: required fields, rules between fields, value
+// formats and that referenced local files exist
+func validateConfigRules(c *Config) []ConfigIssue {
+	issues := []ConfigIssue{}
+	add := func(path string, format string, args ...interface{}) {
+		issues = append(issues, ConfigIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Name == "" {
+		add("name", "name is required")
+	} else if !appNamePattern.MatchString(c.Name) {
+		add("name", "name %q must start with a letter or number and only contain letters, numbers, _, . or -", c.Name)
+	}
+
+	if c.Server == "" {
+		add("server", "server is required")
+	}
+
+	if c.Web && c.Hostname == "" {
+		// reported at the web key since hostname is missing from the file
+		add("web", "hostname is required when web is true")
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		add("port", "port %d must be between 1 and 65535", c.Port)
+	}
+
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		add("email", "email %q is not a valid email address", c.Email)
+	}
+
+	if c.Proxy.Email != "" && !strings.Contains(c.Proxy.Email, "@") {
+		add("proxy.email", "email %q is not a valid email address", c.Proxy.Email)
+	}
+
+	if c.Proxy.Version == "latest" {
+		add("proxy.version", "proxy.version must pin a traefik version, i.e. %s, not latest", defaultTraefikVersion)
+	}
+
+	for _, platform := range strings.Split(c.Platform, ",") {
+		if c.Platform != "" && !platformPattern.MatchString(platform) {
+			add("platform", "platform %q is not a valid linux platform, i.e. linux/amd64 or linux/arm64", platform)
+		}
+	}
+
+	if multiPlatform(c) && c.Registry == "" {
+		add("platform", "building for multiple platforms needs a registry, images loaded directly onto the server have a single platform")
+	}
+
+	if strings.HasPrefix(c.Registry, registryLordScheme) {
+		_, ok := parseLordRegistry(c.Registry)
+		if !ok {
+			add("registry", "registry %q must name the server hosting the registry, i.e. lord://10.0.0.5", c.Registry)
+		}
+	}
+
+	for i, volume := range c.Volumes {
+		path := fmt.Sprintf("volumes[%d]", i)
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			add(path, "volume %q must be host_path:container_path with optional :ro or :rw", volume)
+			continue
+		}
+		if !strings.HasPrefix(parts[0], "/") || !strings.HasPrefix(parts[1], "/") {
+			add(path, "volume %q must use absolute host and container paths", volume)
+		}
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			add(path, "volume %q has unknown mode %q, expected ro or rw", volume, parts[2])
+		}
+	}
+
+	wac := c.WebAdvancedConfig
+	advanced := map[string]int{
+		"webadvancedconfig.readtimeout":          wac.ReadTimeout,
+		"webadvancedconfig.writetimeout":         wac.WriteTimeout,
+		"webadvancedconfig.idletimeout":          wac.IdleTimeout,
+		"webadvancedconfig.maxrequestbodybytes":  wac.MaxRequestBodyBytes,
+		"webadvancedconfig.maxresponsebodybytes": wac.MaxResponseBodyBytes,
+		"webadvancedconfig.memrequestbodybytes":  wac.MemRequestBodyBytes,
+	}
+	advancedKeys := []string{}
+	for key := range advanced {
+		advancedKeys = append(advancedKeys, key)
+	}
+	sort.Strings(advancedKeys)
+	for _, key := range advancedKeys {
+		if advanced[key] < -1 {
+			add(key, "%s must be 0 or greater", key)
+		}
+	}
+
+	if c.Maintenance.RetryAfter < 0 {
+		add("maintenance.retryafter", "maintenance.retryafter must be 0 or greater")
+	}
+
+	if c.Prune.Keep < 1 {
+		add("prune.keep", "prune.keep must be at least 1")
+	}
+
+	if c.Image != "" && c.Build.Remote {
+		add("build.remote", "build.remote can't be used with image, prebuilt images are not built")
+	}
+
+	for i, label := range c.Build.Labels {
+		if !strings.Contains(label, "=") {
+			add(fmt.Sprintf("build.labels[%d]", i), "label %q must be key=value", label)
+		}
+	}
+
+	files := []struct {
+		path    string
+		value   string
+		wantDir bool
+	}{
+		{"environmentfile", c.EnvironmentFile, false},
+		{"buildargfile", c.BuildArgFile, false},
+		{"hostenvironmentfile", c.HostEnvironmentFile, false},
+		{"varsfile", c.VarsFile, false},
+		{"authfile", c.AuthFile, false},
+		{"sshkeyfile", c.SshKeyFile, false},
+		{"maintenance.page", c.Maintenance.Page, false},
+		{"build.dockerfile", c.Build.Dockerfile, false},
+		{"build.context", c.Build.Context, true},
+	}
+
+	for _, file := range files {
+		if file.value == "" {
+			continue
+		}
+		if optionalEnvironmentFiles && (file.path == "environmentfile" || file.path == "hostenvironmentfile") {
+			continue
+		}
+		issue := checkFileExists(file.path, file.value, file.wantDir)
+		if issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+
+	for i, secret := range c.Build.Secrets {
+		_, err := buildSecretFlag(secret)
+		if err != nil {
+			add(fmt.Sprintf("build.secrets[%d]", i), "%v", err)
+		}
+	}
+
+	return issues
+}
+
+// positionIssues attaches the file position of the key each issue refers to, falling back to the closest
+// parent key that is set in the config
+func positionIssues(issues []ConfigIssue, positions configKeyPositions) []ConfigIssue {
+	for i := range issues {
+		if issues[i].Line > 0 {
+			continue
+		}
+
+		path := issues[i].Path
+		for path != "" {
+			keyNode, exists := positions.get(path)
+			if exists {
+				issues[i].Line = keyNode.Line
+				issues[i].Column = keyNode.Column
+				issues[i].File = positions.sources[keyNode]
+				break
+			}
+
+			// volumes[0] -> volumes, build.labels -> build
+			if index := strings.LastIndexAny(path, ".["); index > 0 {
+				path = path[:index]
+			} else {
+				path = ""
+			}
+		}
+	}
+
+	return issues
+}
+
+// validateConfigSchema checks a loaded config tree for unknown keys and mistyped values before it is
+// unmarshalled, returning where each key is set for later rule checks
+func validateConfigSchema(configFile string, root *yaml.Node, sources configSources) (configKeyPositions, error) {
+	positions := configKeyPositions{keys: map[string]*yaml.Node{}, sources: sources}
+
+	issues := validateConfigNode(root, reflect.TypeOf(Config{}), "", positions)
+	if len(issues) > 0 {
+		for i := range issues {
+			issues[i].File = sources[issues[i].node]
+		}
+		return positions, &ConfigIssues{File: configFile, Issues: issues}
+	}
+
+	return positions, nil
+}
+
+// validateConfigValues checks the loaded config against the value rules, reporting issues at the position
+// of the offending key
+func validateConfigValues(configFile string, c *Config, positions configKeyPositions) error {
+	issues := positionIssues(validateConfigRules(c), positions)
+	if len(issues) > 0 {
+		return &ConfigIssues{File: configFile, Issues: issues}
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chdirTemp runs the test from a temp directory, the way lord is run from a project root
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return dir
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	chdirTemp(t)
+	assert.NoError(t, os.WriteFile("lord.yml", []byte(content), 0644))
+	return "lord.yml"
+}
+
+func loadTestConfigSchema(path string) (configKeyPositions, error) {
+	sources := configSources{}
+	root, err := loadConfigTree(path, sources, []string{})
+	if err != nil {
+		return configKeyPositions{}, err
+	}
+	return validateConfigSchema(path, root, sources)
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	path := writeTestConfig(t, `name: myapp
+server: 10.0.0.5
+hostnmae: myapp.example.com
+web: yes please
+volumes: /data:/data
+webadvancedconfig:
+  readtimeout: 60s
+maintenance:
+  allowips:
+    - 10.0.0.1
+prune:
+  keep: 3
+  unknownthing: true
+`)
+
+	_, err := loadTestConfigSchema(path)
+	assert.Error(t, err)
+	assert.Equal(t, `lord.yml:3:1: unknown key "hostnmae", did you mean "hostname"?
+lord.yml:4:6: web must be true or false, got a string
+lord.yml:5:10: volumes must be a list, got a string
+lord.yml:7:16: webadvancedconfig.readtimeout must be an integer, got a string
+lord.yml:13:3: unknown key "prune.unknownthing"`, err.Error())
+}
+
+func TestValidateConfigSchemaValid(t *testing.T) {
+	path := writeTestConfig(t, `Name: myapp
+server: 10.0.0.5
+web: true
+hostname:
+volumes:
+  - /data:/data
+`)
+
+	positions, err := loadTestConfigSchema(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, positions.keys["name"].Line)
+	assert.Equal(t, 6, positions.keys["volumes[0]"].Line)
+}
+
+func TestValidateConfigSchemaSyntaxError(t *testing.T) {
+	path := writeTestConfig(t, "name: myapp\n  server: [\n")
+
+	_, err := loadTestConfigSchema(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "lord.yml: yaml:")
+}
+
+func TestValidateConfigValues(t *testing.T) {
+	path := writeTestConfig(t, `name: my app
+server: 10.0.0.5
+web: true
+platform: linux/amd65
+environmentfile: missing.env
+volumes:
+  - /data:/data
+  - data:/data
+  - /data
+`)
+
+	positions, err := loadTestConfigSchema(path)
+	assert.NoError(t, err)
+
+	c := &Config{
+		Name:            "my app",
+		Server:          "10.0.0.5",
+		Web:             true,
+		Platform:        "linux/amd65",
+		EnvironmentFile: "missing.env",
+		Volumes:         []string{"/data:/data", "data:/data", "/data"},
+		Port:            defaultWebPort,
+		Prune:           PruneConfig{Keep: 3},
+	}
+
+	err = validateConfigValues(path, c, positions)
+	assert.Error(t, err)
+	assert.Equal(t, `lord.yml:1:1: name "my app" must start with a letter or number and only contain letters, numbers, _, . or -
+lord.yml:3:1: hostname is required when web is true
+lord.yml:4:1: platform "linux/amd65" is not a valid linux platform, i.e. linux/amd64 or linux/arm64
+lord.yml:8:5: volume "data:/data" must use absolute host and container paths
+lord.yml:9:5: volume "/data" must be host_path:container_path with optional :ro or :rw
+lord.yml:5:1: environmentfile "missing.env" not found`, err.Error())
+}
+
+func TestValidateConfigRules(t *testing.T) {
+	c := &Config{
+		Name:   "myapp",
+		Server: "10.0.0.5",
+		Port:   defaultWebPort,
+		Prune:  PruneConfig{Keep: 3},
+	}
+	assert.Empty(t, validateConfigRules(c))
+
+	c.Port = 0
+	issues := validateConfigRules(c)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "port 0 must be between 1 and 65535", issues[0].Message)
+	}
+
+	c.Port = defaultWebPort
+	c.Proxy.Version = "latest"
+	issues = validateConfigRules(c)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "proxy.version", issues[0].Path)
+	}
+
+	c.Proxy.Version = ""
+	c.Server = ""
+	c.Prune.Keep = 0
+	c.Registry = "lord://"
+	c.WebAdvancedConfig.ReadTimeout = -5
+	c.Image = "grafana/grafana"
+	c.Build.Remote = true
+
+	paths := []string{}
+	for _, issue := range validateConfigRules(c) {
+		paths = append(paths, issue.Path)
+	}
+	assert.Equal(t, []string{"server", "registry", "webadvancedconfig.readtimeout", "prune.keep", "build.remote"}, paths)
+}
+
+func TestValidateConfigRulesPlatforms(t *testing.T) {
+	c := &Config{
+		Name:     "myapp",
+		Server:   "10.0.0.5",
+		Platform: "linux/amd64,linux/arm64",
+		Registry: "registry.example.com",
+		Port:     defaultWebPort,
+		Prune:    PruneConfig{Keep: 3},
+	}
+	assert.Empty(t, validateConfigRules(c))
+
+	c.Platform = "linux/amd64,linux/amd65"
+	issues := validateConfigRules(c)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, `platform "linux/amd65" is not a valid linux platform, i.e. linux/amd64 or linux/arm64`, issues[0].Message)
+	}
+
+	c.Platform = "linux/amd64,linux/arm64"
+	c.Registry = ""
+	issues = validateConfigRules(c)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "platform", issues[0].Path)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := []string{"name", "server", "hostname", "environmentfile"}
+	assert.Equal(t, "hostname", suggestKey("hostnmae", known))
+	assert.Equal(t, "environmentfile", suggestKey("enviromentfile", known))
+	assert.Equal(t, "", suggestKey("completelydifferent", known))
+}
+
+func TestValidationReport(t *testing.T) {
+	assert.Equal(t, ValidationReport{Valid: true, Issues: []ConfigIssue{}}, validationReport(nil))
+
+	report := validationReport(&ConfigIssues{File: "lord.yml", Issues: []ConfigIssue{
+		{Path: "port", Line: 3, Column: 1, Message: "port 0 must be between 1 and 65535"},
+		{Path: "hostname", File: "base.lord.yml", Message: "hostname is required when web is true"},
+	}})
+	assert.False(t, report.Valid)
+	assert.Equal(t, []ConfigIssue{
+		{Path: "port", File: "lord.yml", Line: 3, Column: 1, Message: "port 0 must be between 1 and 65535"},
+		{Path: "hostname", File: "base.lord.yml", Message: "hostname is required when web is true"},
+	}, report.Issues)
+
+	report = validationReport(fmt.Errorf("lord.yml not found"))
+	assert.False(t, report.Valid)
+	assert.Equal(t, []ConfigIssue{{Message: "lord.yml not found"}}, report.Issues)
+}